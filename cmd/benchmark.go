@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/uploader"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+var benchmarkSizeMB int
+
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Measure the performance of the environment fws runs in",
+}
+
+var benchmarkUploadCmd = &cobra.Command{
+	Use:   "upload",
+	Short: "Measure upload throughput and latency to the remote (uploader mode only)",
+	Long: `Upload a payload of random data to the configured storage, remove it
+again and report the connection time, latency and throughput. This
+measures the network on its own, without building or saving an image.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		benchmarkUpload()
+	},
+}
+
+func init() {
+	benchmarkUploadCmd.Flags().IntVar(&benchmarkSizeMB, "size", 100, "payload size in MiB")
+	benchmarkCmd.AddCommand(benchmarkUploadCmd)
+	rootCmd.AddCommand(benchmarkCmd)
+}
+
+func benchmarkUpload() {
+	cfg, err := config.LoadConfig(configFile, profile)
+	if err != nil {
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
+	}
+	if verbose {
+		cfg.LogLevel = "debug"
+	}
+	if mode != "" {
+		cfg.Mode = mode
+	}
+	if cfg.Mode != "uploader" {
+		exitWithCode(exitConfigInvalid, "Benchmark upload command is only available in uploader mode")
+	}
+	if err := cfg.Validate(); err != nil {
+		exitWithCode(exitConfigInvalid, "Configuration validation failed:%s", numberedList(validationMessages(err)))
+	}
+	if benchmarkSizeMB <= 0 {
+		exitWithCode(exitFailure, "--size must be positive")
+	}
+
+	logger := newLogger(cfg)
+	up := uploader.NewUploader(&cfg.Uploader, logger)
+	result, err := up.Benchmark(int64(benchmarkSizeMB) << 20)
+	if err != nil {
+		exitWithCode(exitUploadFailed, "Benchmark failed: %v", err)
+	}
+
+	printResult(result, func() {
+		fmt.Printf("Destination: %s\n", result.Destination)
+		fmt.Printf("Connect:     %.3fs\n", result.ConnectSeconds)
+		fmt.Printf("Latency:     %.1fms (average of listing the upload directory)\n", result.LatencySeconds*1000)
+		fmt.Printf("Upload:      %s in %.2fs\n", utils.FormatBytes(result.Bytes), result.UploadSeconds)
+		fmt.Printf("Throughput:  %s/s (%.1f Mbit/s)\n", utils.FormatBytes(int64(result.BytesPerSecond)), result.BytesPerSecond*8/1e6)
+	})
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/watcher"
+)
+
+var (
+	dashboardInterval time.Duration
+	dashboardLines    int
+)
+
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Show a live view of the running watcher (watcher mode only)",
+	Long: `Show a live view of the running watcher, read from its control API
+(control_listen): the container and queue state, recently handled files,
+the last deploys and the container's latest log lines. The view is redrawn
+every --interval until interrupted with Ctrl-C.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDashboard()
+	},
+}
+
+func init() {
+	dashboardCmd.Flags().DurationVar(&dashboardInterval, "interval", 2*time.Second, "how often the view is refreshed")
+	dashboardCmd.Flags().IntVar(&dashboardLines, "lines", 10, "number of container log lines shown")
+	rootCmd.AddCommand(dashboardCmd)
+}
+
+// controlClient talks to the control API of a running watcher
+type controlClient struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// newControlClient connects to the control API configured in cfg
+func newControlClient(cfg *config.WatcherConfig) (*controlClient, error) {
+	if cfg.ControlListen == "" {
+		return nil, fmt.Errorf("control_listen is not configured, the dashboard reads from the control API")
+	}
+
+	transport := &http.Transport{}
+	scheme := "http"
+	host := cfg.ControlListen
+	if path, isUnix := strings.CutPrefix(cfg.ControlListen, "unix:"); isUnix {
+		host = "localhost"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+	} else if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+
+	if cfg.TLSCertFile != "" {
+		// Trust the server's own certificate, which is often self-signed
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.TLSCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls_cert_file: %w", err)
+		}
+		pool.AppendCertsFromPEM(pem)
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		scheme = "https"
+	}
+
+	// The dashboard only reads, so a read-only token is enough
+	token := cfg.AuthToken
+	for _, t := range cfg.AuthTokens {
+		if t.Scope == config.ScopeRead {
+			token = t.Token
+			break
+		}
+	}
+
+	return &controlClient{
+		base:   scheme + "://" + host,
+		token:  token,
+		client: &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}, nil
+}
+
+// get decodes the JSON response of a GET request into v
+func (c *controlClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach control API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("control API returned %s: %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("control API returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode control API response: %w", err)
+	}
+	return nil
+}
+
+func runDashboard() {
+	cfg, err := config.LoadConfig(configFile, profile)
+	if err != nil {
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
+	}
+	if cfg.Mode != "watcher" {
+		exitWithCode(exitConfigInvalid, "Dashboard command is only available in watcher mode")
+	}
+	if dashboardInterval <= 0 || dashboardLines < 0 {
+		exitWithError("--interval must be positive and --lines must not be negative")
+	}
+
+	client, err := newControlClient(&cfg.Watcher)
+	if err != nil {
+		exitWithCode(exitConfigInvalid, "%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+	for {
+		// Clear the screen and draw from the top left corner
+		fmt.Print("\033[H\033[2J" + renderDashboard(client))
+		select {
+		case <-ctx.Done():
+			fmt.Println()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderDashboard fetches the watcher state and lays it out as text. A
+// failing request is shown in place of its section, so the view recovers
+// once the watcher is reachable again.
+func renderDashboard(client *controlClient) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "fws dashboard - %s (every %v, Ctrl-C to quit)\n\n", time.Now().Format("2006-01-02 15:04:05"), dashboardInterval)
+
+	var status watcher.Status
+	if err := client.get("/status", &status); err != nil {
+		fmt.Fprintf(&b, "Error: %v\n", err)
+		return b.String()
+	}
+
+	state := "watching"
+	switch {
+	case status.Deploying:
+		state = "deploying"
+	case status.Paused:
+		state = "paused"
+	}
+	fmt.Fprintf(&b, "Container:  %s (%s)\n", status.Container, status.ContainerStatus)
+	fmt.Fprintf(&b, "Watcher:    %s, %d file(s) settling\n", state, status.Pending)
+	if d := status.LastDeploy; d != nil {
+		fmt.Fprintf(&b, "Last:       %s %s %s in %.1fs\n", d.StartedAt.Format("15:04:05"), d.Outcome, d.Image, d.DurationSeconds)
+		if d.Error != "" {
+			fmt.Fprintf(&b, "            %s\n", d.Error)
+		}
+	}
+
+	b.WriteString("\nRecent files\n")
+	if len(status.RecentEvents) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for i, event := range status.RecentEvents {
+		if i == 5 {
+			break
+		}
+		fmt.Fprintf(&b, "  %s  %-13s %s\n", event.Time.Format("15:04:05"), event.Action, event.Path)
+	}
+
+	b.WriteString("\nDeploy history\n")
+	var history struct {
+		Deploys []watcher.DeployResult `json:"deploys"`
+	}
+	if err := client.get("/history?limit=5", &history); err != nil {
+		fmt.Fprintf(&b, "  Error: %v\n", err)
+	} else if len(history.Deploys) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, d := range history.Deploys {
+		fmt.Fprintf(&b, "  %s  %-11s %6.1fs  %s\n", d.StartedAt.Format("01-02 15:04:05"), d.Outcome, d.DurationSeconds, d.Image)
+	}
+
+	if dashboardLines > 0 {
+		fmt.Fprintf(&b, "\nContainer logs (last %d lines)\n", dashboardLines)
+		var logs struct {
+			Logs string `json:"logs"`
+		}
+		if err := client.get(fmt.Sprintf("/logs?lines=%d", dashboardLines), &logs); err != nil {
+			fmt.Fprintf(&b, "  Error: %v\n", err)
+		} else if strings.TrimSpace(logs.Logs) == "" {
+			b.WriteString("  (no output)\n")
+		}
+		for _, line := range strings.Split(strings.TrimRight(logs.Logs, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "  %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/tracing"
+	"github.com/ahsanumar/fws/internal/utils"
+	"github.com/ahsanumar/fws/internal/watcher"
+)
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy <tarball>",
+	Short: "Deploy a tarball once (watcher mode only)",
+	Long:  `Run the watcher deploy pipeline for a single tarball without watching the directory.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deployTarball(args[0])
+	},
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [index|filename]",
+	Short: "List or redeploy archived tarballs (watcher mode only)",
+	Long: `Without arguments, list the tarballs in the archive directory, newest first.
+Given an index from that list or a file name, redeploy that tarball.
+The archived file is left in place.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			listArchive()
+		} else {
+			replayTarball(args[0])
+		}
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{deployCmd, replayCmd} {
+		cmd.Flags().IntVar(&showLogsAfterDeploy, "show-logs-after-deploy", 0, "log the last N lines of the container after the deploy (overrides show_logs_after_deploy)")
+	}
+	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(replayCmd)
+}
+
+// newWatcherForCommand loads the configuration for a watcher-only command
+func newWatcherForCommand(name string) (*config.Config, *watcher.Watcher) {
+	cfg, err := config.LoadConfig(configFile, profile)
+	if err != nil {
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
+	}
+	if verbose {
+		cfg.LogLevel = "debug"
+	}
+
+	if cfg.Mode != "watcher" {
+		exitWithCode(exitConfigInvalid, "%s command is only available in watcher mode", name)
+	}
+	if showLogsAfterDeploy > 0 {
+		cfg.Watcher.ShowLogsAfterDeploy = showLogsAfterDeploy
+	}
+	if err := cfg.Validate(); err != nil {
+		exitWithCode(exitConfigInvalid, "Configuration validation failed:%s", numberedList(validationMessages(err)))
+	}
+
+	logger := newLogger(cfg)
+	checkConfigPermissions(cfg, logger)
+	w := newWatcher(cfg, logger)
+	w.SetTracer(tracing.NewExporter(cfg.OTLPEndpoint))
+	return cfg, w
+}
+
+func deployTarball(path string) {
+	_, w := newWatcherForCommand("Deploy")
+
+	result, err := w.Deploy(path)
+	if err != nil {
+		exitWithCode(failureExitCode(exitDeployFailed), "Deploy failed: %v", err)
+	}
+	printResult(result, func() {
+		fmt.Printf("Deployed %s as %s in %.1fs\n", path, result.Image, result.DurationSeconds)
+	})
+}
+
+func listArchive() {
+	_, w := newWatcherForCommand("Replay")
+
+	tarballs, err := w.ListArchive()
+	if err != nil {
+		exitWithError("Failed to list archive: %v", err)
+	}
+
+	printResult(tarballs, func() {
+		if len(tarballs) == 0 {
+			fmt.Println("No archived tarballs")
+			return
+		}
+		for i, t := range tarballs {
+			fmt.Printf("%3d  %s  %10s  %s\n", i+1, t.ModTime.Format("2006-01-02 15:04:05"), utils.FormatBytes(t.Size), t.Name)
+		}
+	})
+}
+
+func replayTarball(selector string) {
+	_, w := newWatcherForCommand("Replay")
+
+	tarballs, err := w.ListArchive()
+	if err != nil {
+		exitWithError("Failed to list archive: %v", err)
+	}
+
+	var selected *watcher.ArchivedTarball
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 1 || index > len(tarballs) {
+			exitWithError("No archived tarball with index %d (have %d)", index, len(tarballs))
+		}
+		selected = &tarballs[index-1]
+	} else {
+		for i := range tarballs {
+			if tarballs[i].Name == selector {
+				selected = &tarballs[i]
+				break
+			}
+		}
+		if selected == nil {
+			exitWithError("No archived tarball named %s", selector)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Replaying %s\n", selected.Name)
+	result, err := w.Replay(selected.Path)
+	if err != nil {
+		exitWithCode(failureExitCode(exitDeployFailed), "Replay failed: %v", err)
+	}
+	printResult(result, func() {
+		fmt.Printf("Replayed %s as %s in %.1fs\n", selected.Name, result.Image, result.DurationSeconds)
+	})
+}
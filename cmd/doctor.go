@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// DoctorCheck is the outcome of a single doctor check
+type DoctorCheck struct {
+	Name    string   `json:"name"`
+	OK      bool     `json:"ok"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"` // Individual problems when there are several
+}
+
+// DoctorResult is the output of the doctor command
+type DoctorResult struct {
+	Mode    string        `json:"mode"`
+	Healthy bool          `json:"healthy"`
+	Checks  []DoctorCheck `json:"checks"`
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment for common problems",
+	Long:  `Check the configuration, Docker availability and mode-specific prerequisites.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDoctor()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor() {
+	result := DoctorResult{Healthy: true}
+	check := func(name string, err error, okMessage string) {
+		c := DoctorCheck{Name: name, OK: err == nil, Message: okMessage}
+		if err != nil {
+			c.Message = err.Error()
+			result.Healthy = false
+		}
+		result.Checks = append(result.Checks, c)
+	}
+
+	cfg, err := config.LoadConfig(configFile, profile)
+	check("config", err, "configuration loaded")
+	if err == nil {
+		if mode != "" {
+			cfg.Mode = mode
+		}
+		result.Mode = cfg.Mode
+		err := cfg.Validate()
+		check("validate", err, "configuration is valid")
+		if messages := validationMessages(err); len(messages) > 1 {
+			c := &result.Checks[len(result.Checks)-1]
+			c.Message = fmt.Sprintf("%d problems found", len(messages))
+			c.Details = messages
+		}
+		secrets := cfg.HasSecrets()
+		permissions := "config file is only writable by its owner"
+		if secrets {
+			permissions = "config file with secrets is only readable and writable by its owner"
+		}
+		check("config_permissions", config.CheckFilePermissions(configFile, secrets), permissions)
+	}
+
+	version, err := utils.DockerServerVersion(context.Background())
+	check("docker", err, "docker daemon "+version)
+
+	if cfg != nil {
+		switch cfg.Mode {
+		case "watcher":
+			check("watch_directory", checkWritableDir(cfg.Watcher.WatchDirectory), cfg.Watcher.WatchDirectory+" is writable")
+		case "uploader":
+			if cfg.Uploader.GitRepo != "" {
+				_, err := exec.LookPath("git")
+				check("git", err, "git is installed for cloning "+cfg.Uploader.GitRepo)
+			} else {
+				check("docker_build_path", cfg.Uploader.CheckBuildContext(), cfg.Uploader.DockerBuildPath+" is a valid build context")
+			}
+			if cfg.Uploader.RemoteKeyPath != "" {
+				check("remote_key_path", checkExists(cfg.Uploader.RemoteKeyPath), cfg.Uploader.RemoteKeyPath+" exists")
+			}
+		}
+	}
+
+	printResult(result, func() {
+		for _, c := range result.Checks {
+			mark := "OK  "
+			if !c.OK {
+				mark = "FAIL"
+			}
+			fmt.Printf("[%s] %-18s %s\n", mark, c.Name, c.Message)
+			for i, detail := range c.Details {
+				fmt.Printf("       %-18s %d. %s\n", "", i+1, detail)
+			}
+		}
+	})
+
+	if !result.Healthy {
+		os.Exit(1)
+	}
+}
+
+func checkExists(path string) error {
+	if path == "" {
+		return fmt.Errorf("not configured")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkWritableDir(path string) error {
+	if err := checkExists(path); err != nil {
+		return err
+	}
+
+	probe, err := os.CreateTemp(path, ".fws-doctor-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", path, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
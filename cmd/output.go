@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// outputFormat is the value of the global --output flag
+var outputFormat string
+
+// dockerEnv is the environment docker commands need to reach the daemon
+// of the watcher's docker_host, set by newWatcher
+var dockerEnv []string
+
+// jsonOutput reports whether machine-readable output was requested
+func jsonOutput() bool {
+	return outputFormat == "json"
+}
+
+// printResult writes result as JSON when --output json is set and calls
+// text to print the human-readable form otherwise
+func printResult(result interface{}, text func()) {
+	if !jsonOutput() {
+		text()
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Exit codes. Scripts rely on these, so existing values must not change.
+const (
+	exitFailure           = 1 // Any failure not covered below
+	exitContainerNotFound = 2 // status and logs: the container does not exist
+	exitContainerStopped  = 3 // status: the container exists but is not running
+	exitConfigInvalid     = 4 // The config could not be loaded, is invalid or does not fit the command
+	exitDockerUnavailable = 5 // The docker daemon cannot be reached
+	exitUploadFailed      = 6 // The uploader workflow failed
+	exitDeployFailed      = 7 // A deploy or replay failed
+	exitIdleTimeout       = 8 // The watcher exited because nothing was deployed within idle_timeout
+)
+
+// failureExitCode returns exitDockerUnavailable if the docker daemon
+// cannot be reached, which is the likely cause of the failure, and code
+// otherwise
+func failureExitCode(code int) int {
+	if _, err := utils.DockerServerVersion(utils.WithEnv(context.Background(), dockerEnv...)); err != nil {
+		return exitDockerUnavailable
+	}
+	return code
+}
+
+// errorResult is printed in JSON mode when a command fails
+type errorResult struct {
+	Error string `json:"error"`
+}
+
+// exitWithError prints a failure message in the requested output format
+// and exits with exitFailure
+func exitWithError(format string, args ...interface{}) {
+	exitWithCode(exitFailure, format, args...)
+}
+
+// exitWithCode prints a failure message in the requested output format
+// and exits with code
+func exitWithCode(code int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	printResult(errorResult{Error: msg}, func() {
+		fmt.Println(msg)
+	})
+	os.Exit(code)
+}
+
+// validationMessages returns the individual problems of a Validate error
+func validationMessages(err error) []string {
+	var messages []string
+	for _, e := range config.ValidationErrors(err) {
+		messages = append(messages, e.Error())
+	}
+	return messages
+}
+
+// numberedList formats items as an indented numbered list on their own
+// lines. A single item is returned on the same line.
+func numberedList(items []string) string {
+	if len(items) == 1 {
+		return " " + items[0]
+	}
+	var b strings.Builder
+	for i, item := range items {
+		fmt.Fprintf(&b, "\n  %d. %s", i+1, item)
+	}
+	return b.String()
+}
+
+// validateOutputFormat checks the --output flag value
+func validateOutputFormat() error {
+	switch outputFormat {
+	case "text", "json":
+		return nil
+	default:
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", outputFormat)
+	}
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the deploy steps and estimated downtime (watcher mode only)",
+	Long: `Show the steps the next deploy runs and estimate how long the container
+will be down, based on the recorded downtime of previous deploys.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		showPlan()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+}
+
+func showPlan() {
+	_, w := newWatcherForCommand("Plan")
+
+	plan, err := w.Plan()
+	if err != nil {
+		exitWithError("Failed to build deploy plan: %v", err)
+	}
+
+	printResult(plan, func() {
+		fmt.Printf("Deploy plan for container '%s':\n", plan.Container)
+		for i, step := range plan.Steps {
+			marker := ""
+			if step.Downtime {
+				marker = "  [down]"
+			}
+			fmt.Printf("%3d. %-10s %s%s\n", i+1, step.Phase, step.Description, marker)
+		}
+
+		fmt.Println()
+		if plan.Downtime == nil {
+			fmt.Println("Estimated downtime: unknown, no successful deploys recorded yet")
+			return
+		}
+		d := plan.Downtime
+		fmt.Printf("Estimated downtime: %.1fs typical, %.1fs p90, %.1fs max (last %d deploys)\n",
+			d.MedianSeconds, d.P90Seconds, d.MaxSeconds, d.Deploys)
+	})
+}
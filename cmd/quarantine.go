@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/utils"
+	"github.com/ahsanumar/fws/internal/watcher"
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "List or clear quarantined files (watcher mode only)",
+	Long:  `List or clear the files of failed deploys kept in the quarantine directory.`,
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List quarantined files, newest first",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listQuarantine()
+	},
+}
+
+var quarantineClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all quarantined files",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		clearQuarantine()
+	},
+}
+
+func init() {
+	quarantineCmd.AddCommand(quarantineListCmd)
+	quarantineCmd.AddCommand(quarantineClearCmd)
+	rootCmd.AddCommand(quarantineCmd)
+}
+
+func listQuarantine() {
+	_, w := newWatcherForCommand("Quarantine")
+
+	files, err := w.ListQuarantine()
+	if err != nil {
+		exitWithError("Failed to list quarantine: %v", err)
+	}
+
+	printResult(files, func() {
+		if len(files) == 0 {
+			fmt.Println("No quarantined files")
+			return
+		}
+		printQuarantinedFiles(files)
+	})
+}
+
+func clearQuarantine() {
+	_, w := newWatcherForCommand("Quarantine")
+
+	removed, err := w.ClearQuarantine()
+	if err != nil {
+		exitWithError("Failed to clear quarantine: %v", err)
+	}
+
+	printResult(removed, func() {
+		if len(removed) == 0 {
+			fmt.Println("No quarantined files")
+			return
+		}
+		printQuarantinedFiles(removed)
+		fmt.Printf("Removed %d file(s)\n", len(removed))
+	})
+}
+
+func printQuarantinedFiles(files []watcher.QuarantinedFile) {
+	var total int64
+	for _, f := range files {
+		fmt.Printf("%s  %10s  %s\n", f.ModTime.Format("2006-01-02 15:04:05"), utils.FormatBytes(f.Size), f.Name)
+		total += f.Size
+	}
+	fmt.Printf("%d file(s), %s\n", len(files), utils.FormatBytes(total))
+}
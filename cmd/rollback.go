@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/watcher"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Return the container to the previous deploy (watcher mode only)",
+	Long: `Return the container to the previous deploy, using the fastest way available:
+
+  1. start the container kept by keep_previous_container
+  2. start a new container from the previous deploy's image, if docker still has it
+  3. redeploy the previous deploy's tarball from the archive directory
+
+The rolled back container is checked for readiness. Running rollback again
+switches forward.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		rollbackContainer()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+// rollbackMethods describes the rollback methods in text output
+var rollbackMethods = map[string]string{
+	watcher.RollbackPreviousContainer: "started the previous container",
+	watcher.RollbackPreviousImage:     "started the previous image",
+	watcher.RollbackPreviousTarball:   "redeployed the previous tarball",
+}
+
+func rollbackContainer() {
+	_, w := newWatcherForCommand("Rollback")
+
+	result, err := w.Rollback()
+	if result == nil {
+		exitWithCode(failureExitCode(exitFailure), "Rollback failed: %v", err)
+	}
+	printResult(result, func() {
+		fmt.Printf("Rolled back %s: %s\n", result.Container, rollbackMethods[result.Method])
+		if result.Tarball != "" {
+			fmt.Printf("  Tarball: %s\n", result.Tarball)
+		}
+		fmt.Printf("  Image:   %s\n", result.ImageID)
+		fmt.Printf("  State:   %s\n", result.State)
+		if result.Ready {
+			fmt.Println("  Ready:   yes")
+		} else {
+			fmt.Printf("  Ready:   no (%s)\n", result.Error)
+		}
+	})
+	if err != nil {
+		os.Exit(failureExitCode(exitDeployFailed))
+	}
+}
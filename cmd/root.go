@@ -1,14 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/server"
+	"github.com/ahsanumar/fws/internal/tracing"
 	"github.com/ahsanumar/fws/internal/uploader"
 	"github.com/ahsanumar/fws/internal/utils"
 	"github.com/ahsanumar/fws/internal/watcher"
@@ -16,9 +22,17 @@ import (
 
 var (
 	configFile string
+	profile    string
 	mode       string
 	daemon     bool
 	verbose    bool
+	wait       bool
+
+	imageFromStdin bool
+
+	idleTimeout time.Duration
+
+	showLogsAfterDeploy int
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -46,17 +60,26 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "config file path (default: ./config.json)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "config profile to apply on top of the base settings")
 	rootCmd.PersistentFlags().StringVarP(&mode, "mode", "m", "", "operation mode: uploader or watcher")
 	rootCmd.PersistentFlags().BoolVarP(&daemon, "daemon", "d", false, "run as daemon in background")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output (debug level)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "output format: text or json")
+	rootCmd.Flags().BoolVar(&wait, "wait", false, "uploader: wait for the next upload window instead of exiting")
+	rootCmd.Flags().BoolVar(&imageFromStdin, "image-from-stdin", false, "uploader: upload the docker save archive piped to stdin instead of building the image")
+	rootCmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "watcher: exit after this long without a deploy (overrides idle_timeout)")
+	rootCmd.Flags().IntVar(&showLogsAfterDeploy, "show-logs-after-deploy", 0, "watcher: log the last N lines of the container after each deploy (overrides show_logs_after_deploy)")
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return validateOutputFormat()
+	}
 }
 
 func runApplication() {
 	// Load configuration
-	cfg, err := config.LoadConfig(configFile)
+	cfg, err := config.LoadConfig(configFile, profile)
 	if err != nil {
-		fmt.Printf("Failed to load config: %v\n", err)
-		os.Exit(1)
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
 	}
 
 	// Override config with command line flags
@@ -66,15 +89,33 @@ func runApplication() {
 	if verbose {
 		cfg.LogLevel = "debug"
 	}
+	if wait {
+		cfg.Uploader.WaitForWindow = true
+	}
+	if imageFromStdin {
+		cfg.Uploader.ImageFromStdin = true
+	}
+	if idleTimeout > 0 {
+		cfg.Watcher.IdleTimeout = config.Duration(idleTimeout)
+	}
+	if showLogsAfterDeploy > 0 {
+		cfg.Watcher.ShowLogsAfterDeploy = showLogsAfterDeploy
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
-		fmt.Printf("Configuration validation failed: %v\n", err)
-		os.Exit(1)
+		exitWithCode(exitConfigInvalid, "Configuration validation failed:%s", numberedList(validationMessages(err)))
 	}
 
 	// Create logger
-	logger := utils.NewLogger(cfg.LogLevel)
+	logger := newLogger(cfg)
+
+	// Hooks in the config run arbitrary commands, so make sure others cannot edit it
+	checkConfigPermissions(cfg, logger)
+
+	if cfg.Profile != "" {
+		logger.Info("Using config profile %s", cfg.Profile)
+	}
 
 	// Run based on mode
 	switch cfg.Mode {
@@ -83,41 +124,126 @@ func runApplication() {
 	case "watcher":
 		runWatcher(cfg, logger, daemon)
 	default:
-		fmt.Printf("Invalid mode: %s. Must be 'uploader' or 'watcher'\n", cfg.Mode)
-		os.Exit(1)
+		exitWithCode(exitConfigInvalid, "Invalid mode: %s. Must be 'uploader' or 'watcher'", cfg.Mode)
 	}
 }
 
+// checkConfigPermissions warns about, or with strict_config_permissions
+// refuses, a config file that other users could modify, or read if it
+// holds secrets
+func checkConfigPermissions(cfg *config.Config, logger *utils.Logger) {
+	err := config.CheckFilePermissions(configFile, cfg.HasSecrets())
+	if err == nil {
+		return
+	}
+	if cfg.StrictConfigPermissions {
+		exitWithCode(exitConfigInvalid, "Insecure config file: %v", err)
+	}
+	logger.Warn("%v", err)
+}
+
+// newLogger creates the logger for cfg, sampling debug messages and
+// capping command output if configured
+func newLogger(cfg *config.Config) *utils.Logger {
+	logger := utils.NewLogger(cfg.LogLevel)
+	logger.SetSampling(utils.LogSampling{
+		First:      cfg.LogSampling.First,
+		Thereafter: cfg.LogSampling.Thereafter,
+		Interval:   cfg.LogSampling.Interval.Duration(),
+	})
+	utils.SetOutputLimit(cfg.MaxOutputLength, cfg.OutputLogFile)
+	return logger
+}
+
+// newWatcher creates the watcher of cfg and points the docker daemon
+// checks of failed commands at its docker_host
+func newWatcher(cfg *config.Config, logger *utils.Logger) *watcher.Watcher {
+	dockerEnv = cfg.Watcher.DockerEnv()
+	return watcher.NewWatcher(&cfg.Watcher, logger)
+}
+
 func runUploader(cfg *config.Config, logger *utils.Logger) {
 	logger.Info("Starting in uploader mode...")
 
 	up := uploader.NewUploader(&cfg.Uploader, logger)
-	if err := up.Run(); err != nil {
-		logger.Fatal("Uploader failed: %v", err)
+	up.SetTracer(tracing.NewExporter(cfg.OTLPEndpoint))
+
+	// An interrupt kills the running build or save instead of orphaning it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Keep rebuilding on source changes until interrupted
+	if cfg.Uploader.WatchSource {
+		if err := up.WatchSource(ctx); err != nil {
+			logger.Error("Source watcher failed: %v", err)
+			os.Exit(failureExitCode(exitFailure))
+		}
+		return
+	}
+
+	if err := up.Run(ctx); err != nil {
+		logger.Error("Uploader failed: %v", err)
+		os.Exit(failureExitCode(exitUploadFailed))
 	}
 }
 
 func runWatcher(cfg *config.Config, logger *utils.Logger, isDaemon bool) {
 	logger.Info("Starting in watcher mode...")
 
-	w := watcher.NewWatcher(&cfg.Watcher, logger)
+	w := newWatcher(cfg, logger)
+	w.SetConfigReloader(reloadWatcherConfig)
+	w.SetTracer(tracing.NewExporter(cfg.OTLPEndpoint))
 
+	// Start the optional control and metrics APIs
+	srv := server.NewServer(&cfg.Watcher, w, logger)
+	if err := srv.Start(); err != nil {
+		logger.Fatal("Failed to start API server: %v", err)
+	}
+	defer srv.Shutdown()
+
+	var err error
 	if isDaemon {
 		// Run as daemon
-		err := utils.Daemonize(func() error {
+		err = utils.Daemonize(func() error {
 			return runWatcherWithSignalHandling(w, logger)
 		}, logger)
-		if err != nil {
-			logger.Fatal("Failed to start daemon: %v", err)
-		}
 	} else {
 		// Run in foreground
-		if err := runWatcherWithSignalHandling(w, logger); err != nil {
-			logger.Fatal("Watcher failed: %v", err)
-		}
+		err = runWatcherWithSignalHandling(w, logger)
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, watcher.ErrIdleTimeout):
+		// Scale-to-zero workers exit on purpose, with their own exit code
+		srv.Shutdown()
+		os.Exit(exitIdleTimeout)
+	default:
+		logger.Error("Watcher failed: %v", err)
+		srv.Shutdown()
+		os.Exit(failureExitCode(exitFailure))
+	}
+}
+
+// reloadWatcherConfig loads and validates the watcher settings for a
+// reload_config file
+func reloadWatcherConfig() (*config.WatcherConfig, error) {
+	cfg, err := config.LoadConfig(configFile, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	// The mode may have come from --mode
+	cfg.Mode = "watcher"
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
 	}
+	return &cfg.Watcher, nil
 }
 
+// shutdownTimeout bounds how long a stopping watcher may take to finish
+// the file it is handling
+const shutdownTimeout = 30 * time.Second
+
 func runWatcherWithSignalHandling(w *watcher.Watcher, logger *utils.Logger) error {
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -134,6 +260,12 @@ func runWatcherWithSignalHandling(w *watcher.Watcher, logger *utils.Logger) erro
 	case sig := <-sigChan:
 		logger.Info("Received signal: %v", sig)
 		w.Stop()
+		// Stopping kills the commands of a running deploy, so it ends promptly
+		select {
+		case <-errChan:
+		case <-time.After(shutdownTimeout):
+			logger.Warn("Watcher did not stop within %v, exiting anyway", shutdownTimeout)
+		}
 		return nil
 	case err := <-errChan:
 		return err
@@ -174,109 +306,174 @@ func init() {
 	rootCmd.AddCommand(logsCmd)
 }
 
+// InitResult is the output of the init command
+type InitResult struct {
+	ConfigFile string `json:"config_file"`
+	Format     string `json:"format"` // JSON, YAML or TOML
+}
+
 func initConfig() {
 	configPath := "config.json"
 	if configFile != "" {
 		configPath = configFile
 	}
 
-	// Create default config
-	cfg := &config.Config{
-		Mode:     "watcher",
-		LogLevel: "info",
-		Uploader: config.UploaderConfig{
-			DockerBuildPath:  "./",
-			ImageName:        "myapp",
-			ImageTag:         "latest",
-			TarballPath:      "./tarballs",
-			RemoteHost:       "destination.server.com",
-			RemotePort:       22,
-			RemoteUser:       "deploy",
-			RemoteKeyPath:    "~/.ssh/id_rsa",
-			RemoteUploadPath: "/opt/docker-uploads",
-			PreBuildCommands: []string{
-				"echo 'Starting build process...'",
-			},
-			PostBuildCommands: []string{
-				"echo 'Build process completed.'",
-			},
-		},
-		Watcher: config.WatcherConfig{
-			WatchDirectory:   "/opt/docker-uploads",
-			ContainerName:    "myapp",
-			ContainerPort:    []string{"8080:8080"},
-			ContainerEnv:     []string{"NODE_ENV=production"},
-			ContainerVolumes: []string{},
-			PreLoadCommands: []string{
-				"echo 'Preparing to load new image...'",
-			},
-			PostLoadCommands: []string{
-				"echo 'New container deployed successfully.'",
-			},
-			RestartPolicy: "unless-stopped",
-		},
-	}
+	// Start from the defaults and fill in an example deployment
+	cfg := config.DefaultConfig()
+	cfg.Uploader.DockerBuildPath = "./"
+	cfg.Uploader.ImageName = "myapp"
+	cfg.Uploader.ImageTag = "latest"
+	cfg.Uploader.TarballPath = "./tarballs"
+	cfg.Uploader.RemoteHost = "destination.server.com"
+	cfg.Uploader.RemoteUser = "deploy"
+	cfg.Uploader.RemoteKeyPath = "~/.ssh/id_rsa"
+	cfg.Uploader.RemoteUploadPath = "/opt/docker-uploads"
+	cfg.Uploader.PreBuildCommands = config.Commands("echo 'Starting build process...'")
+	cfg.Uploader.PostBuildCommands = config.Commands("echo 'Build process completed.'")
+	cfg.Watcher.WatchDirectory = "/opt/docker-uploads"
+	cfg.Watcher.ContainerName = "myapp"
+	cfg.Watcher.ContainerPort = []string{"8080:8080"}
+	cfg.Watcher.ContainerEnv = []string{"NODE_ENV=production"}
+	cfg.Watcher.ContainerVolumes = []string{}
+	cfg.Watcher.PreLoadCommands = config.Commands("echo 'Preparing to load new image...'")
+	cfg.Watcher.PostLoadCommands = config.Commands("echo 'New container deployed successfully.'")
 
 	if err := cfg.SaveConfig(configPath); err != nil {
-		fmt.Printf("Failed to save config: %v\n", err)
-		os.Exit(1)
+		exitWithError("Failed to save config: %v", err)
 	}
 
-	fmt.Printf("Configuration file created: %s\n", configPath)
-	fmt.Println("Please edit the configuration file before running the application.")
+	result := InitResult{ConfigFile: configPath, Format: config.FileFormat(configPath)}
+	printResult(result, func() {
+		fmt.Printf("Configuration file created: %s\n", result.ConfigFile)
+		fmt.Println("Please edit the configuration file before running the application.")
+	})
+}
+
+// StatusResult is the output of the status command
+type StatusResult struct {
+	Container string `json:"container"`
+	State     string `json:"state"` // "running", "stopped" or "not_found"
+	Found     bool   `json:"found"`
+	Status    string `json:"status,omitempty"`
+
+	Ports []watcher.PortMapping `json:"ports,omitempty"` // Published ports with the host ports docker assigned
 }
 
 func showStatus() {
 	// Load configuration
-	cfg, err := config.LoadConfig(configFile)
+	cfg, err := config.LoadConfig(configFile, profile)
 	if err != nil {
-		fmt.Printf("Failed to load config: %v\n", err)
-		os.Exit(1)
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
 	}
 
 	if cfg.Mode != "watcher" {
-		fmt.Println("Status command is only available in watcher mode")
-		os.Exit(1)
+		exitWithCode(exitConfigInvalid, "Status command is only available in watcher mode")
 	}
 
-	logger := utils.NewLogger(cfg.LogLevel)
-	w := watcher.NewWatcher(&cfg.Watcher, logger)
+	logger := newLogger(cfg)
+	w := newWatcher(cfg, logger)
 
-	status, err := w.GetContainerStatus()
+	info, err := w.InspectContainer()
 	if err != nil {
-		fmt.Printf("Failed to get container status: %v\n", err)
-		os.Exit(1)
+		exitWithCode(failureExitCode(exitFailure), "Failed to get container status from docker: %v", err)
 	}
 
-	if status == "" {
-		fmt.Printf("Container '%s' not found\n", cfg.Watcher.ContainerName)
-	} else {
-		fmt.Printf("Container '%s' status: %s\n", cfg.Watcher.ContainerName, status)
+	result := StatusResult{
+		Container: info.Name,
+		State:     info.State,
+		Found:     info.State != watcher.ContainerNotFound,
+		Status:    info.Status,
+		Ports:     info.Ports,
 	}
+	printResult(result, func() {
+		switch result.State {
+		case watcher.ContainerRunning:
+			fmt.Printf("Container '%s' is running: %s\n", result.Container, result.Status)
+			for _, port := range result.Ports {
+				fmt.Printf("  %s\n", port)
+			}
+		case watcher.ContainerStopped:
+			fmt.Printf("Container '%s' is not running: %s\n", result.Container, result.Status)
+		default:
+			fmt.Println(notDeployedMessage(result.Container))
+		}
+	})
+	os.Exit(containerExitCode(result.State))
+}
+
+// notDeployedMessage explains a missing container to first-time users
+func notDeployedMessage(container string) string {
+	if container == "" {
+		return "No container has been deployed yet. Drop a tarball into the watch directory to deploy one."
+	}
+	return fmt.Sprintf("Container '%s' does not exist. It has not been deployed yet or was removed; drop a tarball into the watch directory to deploy it.", container)
+}
+
+// containerExitCode maps a container state to the exit code of the status
+// and logs commands
+func containerExitCode(state string) int {
+	switch state {
+	case watcher.ContainerRunning:
+		return 0
+	case watcher.ContainerStopped:
+		return exitContainerStopped
+	default:
+		return exitContainerNotFound
+	}
+}
+
+// LogsResult is the output of the logs command
+type LogsResult struct {
+	Container string `json:"container"`
+	State     string `json:"state"`
+	Logs      string `json:"logs"`
 }
 
 func showLogs() {
 	// Load configuration
-	cfg, err := config.LoadConfig(configFile)
+	cfg, err := config.LoadConfig(configFile, profile)
 	if err != nil {
-		fmt.Printf("Failed to load config: %v\n", err)
-		os.Exit(1)
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
 	}
 
 	if cfg.Mode != "watcher" {
-		fmt.Println("Logs command is only available in watcher mode")
-		os.Exit(1)
+		exitWithCode(exitConfigInvalid, "Logs command is only available in watcher mode")
 	}
 
-	logger := utils.NewLogger(cfg.LogLevel)
-	w := watcher.NewWatcher(&cfg.Watcher, logger)
+	logger := newLogger(cfg)
+	w := newWatcher(cfg, logger)
 
-	logs, err := w.GetContainerLogs(50)
+	info, err := w.InspectContainer()
 	if err != nil {
-		fmt.Printf("Failed to get container logs: %v\n", err)
-		os.Exit(1)
+		exitWithCode(failureExitCode(exitFailure), "Failed to get container status from docker: %v", err)
 	}
 
-	fmt.Printf("Container '%s' logs:\n", cfg.Watcher.ContainerName)
-	fmt.Println(logs)
+	result := LogsResult{
+		Container: info.Name,
+		State:     info.State,
+	}
+	if info.State == watcher.ContainerNotFound {
+		printResult(result, func() {
+			fmt.Println(notDeployedMessage(info.Name))
+		})
+		os.Exit(exitContainerNotFound)
+	}
+
+	result.Logs, err = w.GetContainerLogs(50)
+	if err != nil {
+		exitWithCode(failureExitCode(exitFailure), "Failed to get container logs: %v", err)
+	}
+
+	printResult(result, func() {
+		if result.State == watcher.ContainerStopped {
+			fmt.Printf("Container '%s' is not running, showing its last logs:\n", result.Container)
+		} else {
+			fmt.Printf("Container '%s' logs:\n", result.Container)
+		}
+		if strings.TrimSpace(result.Logs) == "" {
+			fmt.Println("(no output)")
+			return
+		}
+		fmt.Println(result.Logs)
+	})
 }
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/state"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect or reset watcher state (watcher mode only)",
+	Long:  `Inspect or reset the persistent watcher state, such as completed run-once commands.`,
+}
+
+var stateShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the watcher state",
+	Run: func(cmd *cobra.Command, args []string) {
+		showState()
+	},
+}
+
+var stateResetOnceCmd = &cobra.Command{
+	Use:   "reset-once",
+	Short: "Forget completed run-once commands",
+	Long:  `Forget completed run-once pre-load commands so they run again on the next deploy.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		resetOnceCommands()
+	},
+}
+
+func init() {
+	stateCmd.AddCommand(stateShowCmd)
+	stateCmd.AddCommand(stateResetOnceCmd)
+	rootCmd.AddCommand(stateCmd)
+}
+
+// StateResult is the output of the state show command
+type StateResult struct {
+	StateFile string       `json:"state_file"`
+	State     *state.State `json:"state"`
+}
+
+// StateResetOnceResult is the output of the state reset-once command
+type StateResetOnceResult struct {
+	StateFile string   `json:"state_file"`
+	Reset     []string `json:"reset"` // Run-once commands that will run again
+}
+
+func loadWatcherState() (*state.State, string) {
+	cfg, err := config.LoadConfig(configFile, profile)
+	if err != nil {
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
+	}
+
+	if cfg.Mode != "watcher" {
+		exitWithCode(exitConfigInvalid, "State command is only available in watcher mode")
+	}
+
+	path := cfg.Watcher.StatePath()
+	st, err := state.Load(path)
+	if err != nil {
+		exitWithError("Failed to load state: %v", err)
+	}
+	return st, path
+}
+
+func showState() {
+	st, path := loadWatcherState()
+
+	result := StateResult{StateFile: path, State: st}
+	printResult(result, func() {
+		data, err := json.MarshalIndent(st, "", "  ")
+		if err != nil {
+			exitWithError("Failed to encode state: %v", err)
+		}
+		fmt.Println(string(data))
+	})
+}
+
+func resetOnceCommands() {
+	st, path := loadWatcherState()
+
+	result := StateResetOnceResult{StateFile: path, Reset: []string{}}
+	for cmd := range st.OnceCommands {
+		result.Reset = append(result.Reset, cmd)
+	}
+	sort.Strings(result.Reset)
+	st.ResetOnce()
+
+	if err := st.Save(); err != nil {
+		exitWithError("Failed to save state: %v", err)
+	}
+	printResult(result, func() {
+		fmt.Println("Run-once commands reset; they will run again on the next deploy.")
+	})
+}
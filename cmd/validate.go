@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ahsanumar/fws/internal/config"
+)
+
+// ValidateResult is the output of the validate command
+type ValidateResult struct {
+	ConfigFile string   `json:"config_file"`
+	Mode       string   `json:"mode"`
+	Profile    string   `json:"profile,omitempty"` // Applied config profile
+	Valid      bool     `json:"valid"`
+	Error      string   `json:"error,omitempty"`
+	Errors     []string `json:"errors,omitempty"` // Every problem found
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration file",
+	Long:  `Load the configuration file and check it for errors without running anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateConfig()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+func validateConfig() {
+	cfg, err := config.LoadConfig(configFile, profile)
+	if err != nil {
+		exitWithCode(exitConfigInvalid, "Failed to load config: %v", err)
+	}
+	if mode != "" {
+		cfg.Mode = mode
+	}
+
+	result := ValidateResult{
+		ConfigFile: configFile,
+		Mode:       cfg.Mode,
+		Profile:    cfg.Profile,
+		Valid:      true,
+	}
+	if err := cfg.Validate(); err != nil {
+		result.Valid = false
+		result.Error = err.Error()
+		result.Errors = validationMessages(err)
+	}
+
+	printResult(result, func() {
+		if result.Valid && result.Profile != "" {
+			fmt.Printf("Configuration is valid (mode: %s, profile: %s)\n", result.Mode, result.Profile)
+		} else if result.Valid {
+			fmt.Printf("Configuration is valid (mode: %s)\n", result.Mode)
+		} else {
+			fmt.Printf("Configuration is invalid:%s\n", numberedList(result.Errors))
+		}
+	})
+
+	if !result.Valid {
+		os.Exit(exitConfigInvalid)
+	}
+}
@@ -3,13 +3,18 @@ module github.com/ahsanumar/fws
 go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/fsnotify/fsnotify v1.7.0
+	github.com/klauspost/compress v1.17.4
+	github.com/pkg/sftp v1.13.7
 	github.com/spf13/cobra v1.8.0
 	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 )
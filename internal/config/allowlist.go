@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// shellOperators are the characters that let a command run further
+// commands, which a prefix entry of allowed_commands does not permit
+const shellOperators = ";&|<>$`()\n"
+
+// commandAllowlist restricts the shell commands a config may run
+type commandAllowlist struct {
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+// parseAllowedCommands compiles allowed_commands. Entries starting with
+// "re:" are regular expressions the whole command must match; other
+// entries are prefixes.
+func parseAllowedCommands(entries []string) (*commandAllowlist, []error) {
+	var errs []error
+	allowlist := &commandAllowlist{}
+	for _, entry := range entries {
+		if expr, ok := strings.CutPrefix(entry, "re:"); ok {
+			re, err := regexp.Compile(`^(?:` + expr + `)$`)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid allowed_commands pattern %q: %w", expr, err))
+				continue
+			}
+			allowlist.patterns = append(allowlist.patterns, re)
+			continue
+		}
+		if strings.TrimSpace(entry) == "" {
+			errs = append(errs, fmt.Errorf("allowed_commands entries must not be empty"))
+			continue
+		}
+		allowlist.prefixes = append(allowlist.prefixes, entry)
+	}
+	return allowlist, errs
+}
+
+// allows reports whether command matches an entry. A prefix must end in a
+// space or "/" or be followed by the end of the command or a space, and
+// the command must not contain shell operators, so "docker" allows neither
+// "dockerd" nor "docker ps; rm -rf /". A directory prefix such as
+// "/opt/hooks/" does not allow leaving the directory with "..".
+func (a *commandAllowlist) allows(command string) bool {
+	for _, re := range a.patterns {
+		if re.MatchString(command) {
+			return true
+		}
+	}
+	if strings.ContainsAny(command, shellOperators) {
+		return false
+	}
+	for _, prefix := range a.prefixes {
+		rest, ok := strings.CutPrefix(command, prefix)
+		switch {
+		case !ok:
+		case strings.HasSuffix(prefix, "/"):
+			if !strings.Contains(rest, "..") {
+				return true
+			}
+		case rest == "" || strings.HasPrefix(rest, " ") || strings.HasSuffix(prefix, " "):
+			return true
+		}
+	}
+	return false
+}
+
+// validateAllowedCommands checks every shell command the config runs in
+// its mode against allowed_commands. Hook scripts are checked by path.
+func (c *Config) validateAllowedCommands() []error {
+	if len(c.AllowedCommands) == 0 {
+		return nil
+	}
+	allowlist, errs := parseAllowedCommands(c.AllowedCommands)
+
+	type setting struct {
+		name     string
+		commands []Command
+	}
+	var settings []setting
+	if c.Mode == "uploader" {
+		settings = []setting{
+			{"build_command", Commands(c.Uploader.BuildCommand)},
+			{"pre_build_commands", c.Uploader.PreBuildCommands},
+			{"post_build_commands", c.Uploader.PostBuildCommands},
+		}
+	} else {
+		settings = []setting{
+			{"pre_load_commands", c.Watcher.PreLoadCommands},
+			{"post_load_commands", c.Watcher.PostLoadCommands},
+			{"image_name_command", Commands(c.Watcher.ImageNameCommand)},
+			{"post_load_transform_command", Commands(c.Watcher.PostLoadTransformCommand)},
+			{"readiness_command", Commands(c.Watcher.ReadinessCommand)},
+			{"smoke_test_command", Commands(c.Watcher.SmokeTestCommand)},
+			{"pre_deploy_gate_command", Commands(c.Watcher.PreDeployGateCommand)},
+		}
+		for _, action := range c.Watcher.FileActions {
+			if action.Action == ActionRunScript {
+				errs = append(errs, fmt.Errorf("file action run_script for %s is not allowed with allowed_commands, it runs files from the watch directory", action.Pattern))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		for _, cmd := range s.commands {
+			command := cmd.Cmd
+			if cmd.Script != "" {
+				command = cmd.ScriptPath()
+			}
+			if command != "" && !allowlist.allows(command) {
+				errs = append(errs, fmt.Errorf("%s: %q is not in allowed_commands", s.name, command))
+			}
+		}
+	}
+	return errs
+}
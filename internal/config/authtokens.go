@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Scopes of control API tokens
+const (
+	ScopeRead  = "read"  // GET /healthz, /status, /logs, /history and /metrics
+	ScopeAdmin = "admin" // Everything, including POST /deploy, /pause, /resume and /reload
+)
+
+// AuthToken is a bearer token for the control and metrics APIs limited to
+// a scope
+type AuthToken struct {
+	Token string `json:"token" yaml:"token" toml:"token"`
+	Scope string `json:"scope" yaml:"scope" toml:"scope"` // "read" or "admin"
+}
+
+// ScopeAllows reports whether a token of scope granted may use an endpoint
+// requiring scope required
+func ScopeAllows(granted, required string) bool {
+	return granted == ScopeAdmin || granted == required
+}
+
+// validateAuthTokens checks the scoped tokens and that no token is listed
+// twice, including as auth_token
+func validateAuthTokens(tokens []AuthToken, authToken string) []error {
+	var errs []error
+	seen := map[string]bool{authToken: authToken != ""}
+	for i, token := range tokens {
+		if token.Token == "" {
+			errs = append(errs, fmt.Errorf("auth_tokens entry %d has no token", i+1))
+			continue
+		}
+		if token.Scope != ScopeRead && token.Scope != ScopeAdmin {
+			errs = append(errs, fmt.Errorf("invalid scope of auth_tokens entry %d: %q (must be '%s' or '%s')", i+1, token.Scope, ScopeRead, ScopeAdmin))
+		}
+		if seen[token.Token] {
+			errs = append(errs, fmt.Errorf("auth_tokens entry %d repeats a token", i+1))
+		}
+		seen[token.Token] = true
+	}
+	return errs
+}
+
+// isLoopbackAddress reports whether a control_listen or metrics_listen
+// address can only be reached from this host: a Unix socket or a TCP
+// address bound to localhost or a loopback IP
+func isLoopbackAddress(addr string) bool {
+	if strings.HasPrefix(addr, "unix:") {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
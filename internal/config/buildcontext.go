@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckBuildContext checks that docker_build_path is a directory holding
+// a Dockerfile, so a mistyped path is reported clearly instead of by docker
+// build. Nothing is checked when fws does not run docker build itself or
+// the context is not a local directory (a URL, "-" or a path in git_repo,
+// which is checked after cloning).
+func (c *UploaderConfig) CheckBuildContext() error {
+	if c.BuildCommand != "" || c.ImageFromStdin || c.ImageDigest != "" || c.GitRepo != "" {
+		return nil
+	}
+	path := c.DockerBuildPath
+	if path == "-" || strings.Contains(path, "://") || strings.HasPrefix(path, "git@") {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		abs, _ := filepath.Abs(path)
+		return fmt.Errorf("docker_build_path %s does not exist (resolved to %s), check the path in the config", path, abs)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to access docker_build_path: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("docker_build_path %s is not a directory, set it to the directory containing the Dockerfile", path)
+	}
+
+	// docker build falls back to a lower case name
+	for _, name := range []string{"Dockerfile", "dockerfile"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no Dockerfile in docker_build_path %s, set docker_build_path to the directory containing it or use build_command for a Dockerfile elsewhere", path)
+}
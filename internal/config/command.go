@@ -0,0 +1,190 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// Command is a single hook command. In the config file it can be written
+// either as a plain string or as an object carrying extra options:
+//
+//	"echo hello"
+//	{ "cmd": "docker network create app", "once": true }
+//	{ "cmd": "./manage.py migrate", "in_container": true }
+//	{ "script": "./hooks/pre.sh" }
+//	{ "cmd": "grep -q ERROR app.log", "success_codes": [0, 1] }
+type Command struct {
+	Cmd         string `json:"cmd,omitempty" yaml:"cmd,omitempty" toml:"cmd,omitempty"`                            // Shell command to execute
+	Script      string `json:"script,omitempty" yaml:"script,omitempty" toml:"script,omitempty"`                   // Executable script to run instead of cmd, relative to the config file
+	Once        bool   `json:"once,omitempty" yaml:"once,omitempty" toml:"once,omitempty"`                         // Run only until the first successful deploy
+	InContainer bool   `json:"in_container,omitempty" yaml:"in_container,omitempty" toml:"in_container,omitempty"` // Run inside the managed container via docker exec (post-load only)
+
+	// Exit codes that count as success (default: only 0)
+	SuccessCodes []int `json:"success_codes,omitempty" yaml:"success_codes,omitempty" toml:"success_codes,omitempty"`
+
+	// Directory relative script paths are resolved against
+	baseDir string
+}
+
+// UnmarshalJSON accepts both the string and the object form
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = Command{Cmd: s}
+		return nil
+	}
+
+	type plain Command
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("command must be a string or an object with a \"cmd\" or \"script\" field: %w", err)
+	}
+	*c = Command(p)
+	return nil
+}
+
+// UnmarshalYAML accepts both the string and the mapping form
+func (c *Command) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = Command{Cmd: value.Value}
+		return nil
+	}
+
+	type plain Command
+	var p plain
+	if err := value.Decode(&p); err != nil {
+		return fmt.Errorf("command must be a string or a mapping with a \"cmd\" or \"script\" field: %w", err)
+	}
+	*c = Command(p)
+	return nil
+}
+
+// UnmarshalTOML accepts both the string and the table form
+func (c *Command) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*c = Command{Cmd: v}
+		return nil
+	case map[string]interface{}:
+		// The options are plain values, which read the same from JSON
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		type plain Command
+		var p plain
+		if err := json.Unmarshal(data, &p); err != nil {
+			return fmt.Errorf("command must be a string or a table with a \"cmd\" or \"script\" field: %w", err)
+		}
+		*c = Command(p)
+		return nil
+	default:
+		return fmt.Errorf("command must be a string or a table with a \"cmd\" or \"script\" field")
+	}
+}
+
+// MarshalJSON writes commands without options back as plain strings
+func (c Command) MarshalJSON() ([]byte, error) {
+	if c.Script == "" && !c.Once && !c.InContainer && len(c.SuccessCodes) == 0 {
+		return json.Marshal(c.Cmd)
+	}
+
+	type plain Command
+	return json.Marshal(plain(c))
+}
+
+// Commands creates plain commands from shell strings
+func Commands(cmds ...string) []Command {
+	commands := make([]Command, 0, len(cmds))
+	for _, cmd := range cmds {
+		commands = append(commands, Command{Cmd: cmd})
+	}
+	return commands
+}
+
+// String identifies the command in logs and in the run-once state
+func (c Command) String() string {
+	if c.Script != "" {
+		return "script:" + c.Script
+	}
+	return c.Cmd
+}
+
+// ScriptPath returns the path of the command's script, resolved against
+// the directory of the config file
+func (c Command) ScriptPath() string {
+	if c.Script == "" || filepath.IsAbs(c.Script) {
+		return c.Script
+	}
+	return filepath.Join(c.baseDir, c.Script)
+}
+
+// Shell returns the shell command line that runs the command
+func (c Command) Shell() string {
+	if c.Script != "" {
+		return "'" + strings.ReplaceAll(c.ScriptPath(), "'", `'\''`) + "'"
+	}
+	return c.Cmd
+}
+
+// validate checks that exactly one of cmd and script is set and that the
+// script is an executable file
+func (c Command) validate() error {
+	if (c.Cmd == "") == (c.Script == "") {
+		return fmt.Errorf("command must set exactly one of cmd and script: %s", c)
+	}
+	for _, code := range c.SuccessCodes {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("invalid success code %d (must be between 0 and 255): %s", code, c)
+		}
+	}
+	if c.Script == "" {
+		return nil
+	}
+	if c.InContainer {
+		return fmt.Errorf("scripts cannot run in_container: %s", c.Script)
+	}
+
+	path := c.ScriptPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("hook script not found: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("hook script is not a regular file: %s", path)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("hook script is not executable: %s (run chmod +x)", path)
+	}
+	return nil
+}
+
+// setBaseDir resolves relative script paths of commands against dir
+func setBaseDir(commands []Command, dir string) {
+	for i := range commands {
+		commands[i].baseDir = dir
+	}
+}
+
+// ShellCommand returns the command line and success codes the command is
+// run with
+func (c Command) ShellCommand() utils.ShellCommand {
+	return utils.ShellCommand{Line: c.Shell(), SuccessCodes: c.SuccessCodes}
+}
+
+// ShellCommands returns the shell commands that run commands
+func ShellCommands(commands []Command) []utils.ShellCommand {
+	shellCommands := make([]utils.ShellCommand, 0, len(commands))
+	for _, cmd := range commands {
+		shellCommands = append(shellCommands, cmd.ShellCommand())
+	}
+	return shellCommands
+}
@@ -1,127 +1,993 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 )
 
+// BlobDirName is the directory below the upload/watch directory that holds
+// layer blobs for incremental uploads
+const BlobDirName = ".fws-blobs"
+
+// BaseDirName is the directory below the upload/watch directory that holds
+// base image tarballs shared by the tarballs of base_image uploads
+const BaseDirName = ".fws-bases"
+
 type Config struct {
 	// Common settings
-	Mode     string `json:"mode"`      // "uploader" or "watcher"
-	LogLevel string `json:"log_level"` // "debug", "info", "warn", "error"
+	Mode     string `json:"mode" yaml:"mode" toml:"mode"`                // "uploader" or "watcher"
+	LogLevel string `json:"log_level" yaml:"log_level" toml:"log_level"` // "debug", "info", "warn", "error"
+
+	// Refuse to start if the config file could be modified by other users
+	// instead of warning
+	StrictConfigPermissions bool `json:"strict_config_permissions" yaml:"strict_config_permissions" toml:"strict_config_permissions"`
+
+	// Fail to load the config if a path setting uses an unset environment
+	// variable, instead of expanding it to nothing
+	StrictPathExpansion bool `json:"strict_path_expansion" yaml:"strict_path_expansion" toml:"strict_path_expansion"`
+
+	// Sample repeated debug messages (optional)
+	LogSampling LogSamplingConfig `json:"log_sampling" yaml:"log_sampling" toml:"log_sampling"`
+
+	// Cap log messages and the command output in errors at this many bytes,
+	// appending the full output of longer commands to output_log_file if
+	// set; 0 keeps everything
+	MaxOutputLength int    `json:"max_output_length" yaml:"max_output_length" toml:"max_output_length"`
+	OutputLogFile   string `json:"output_log_file" yaml:"output_log_file" toml:"output_log_file"`
+
+	// Send deploy and upload traces to this OpenTelemetry collector (OTLP
+	// over HTTP, e.g. "http://localhost:4318"), disabled when empty
+	OTLPEndpoint string `json:"otlp_endpoint" yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+
+	// Shell commands the config may run, as prefixes or "re:" regular
+	// expressions; unrestricted when empty
+	AllowedCommands []string `json:"allowed_commands" yaml:"allowed_commands" toml:"allowed_commands"`
 
 	// Uploader settings
-	Uploader UploaderConfig `json:"uploader"`
+	Uploader UploaderConfig `json:"uploader" yaml:"uploader" toml:"uploader"`
 
 	// Watcher settings
-	Watcher WatcherConfig `json:"watcher"`
+	Watcher WatcherConfig `json:"watcher" yaml:"watcher" toml:"watcher"`
+
+	// Named overrides of the settings above, e.g. per environment, selected
+	// with --profile
+	Profiles map[string]Profile `json:"profiles,omitempty" yaml:"profiles,omitempty" toml:"profiles,omitempty"`
+	Profile  string             `json:"-" yaml:"-" toml:"-"` // Name of the applied profile
 }
 
 type UploaderConfig struct {
-	DockerBuildPath   string   `json:"docker_build_path"`   // Path to Dockerfile
-	ImageName         string   `json:"image_name"`          // Docker image name
-	ImageTag          string   `json:"image_tag"`           // Docker image tag
-	TarballPath       string   `json:"tarball_path"`        // Local path to save tarball
-	RemoteHost        string   `json:"remote_host"`         // SSH host
-	RemotePort        int      `json:"remote_port"`         // SSH port
-	RemoteUser        string   `json:"remote_user"`         // SSH username
-	RemoteKeyPath     string   `json:"remote_key_path"`     // SSH private key path
-	RemoteUploadPath  string   `json:"remote_upload_path"`  // Remote upload directory
-	BuildCommand      string   `json:"build_command"`       // Custom build command (optional)
-	PreBuildCommands  []string `json:"pre_build_commands"`  // Commands before build
-	PostBuildCommands []string `json:"post_build_commands"` // Commands after build
+	DockerBuildPath    string    `json:"docker_build_path" yaml:"docker_build_path" toml:"docker_build_path"`          // Path to Dockerfile
+	ImageName          string    `json:"image_name" yaml:"image_name" toml:"image_name"`                               // Docker image name
+	ImageTag           string    `json:"image_tag" yaml:"image_tag" toml:"image_tag"`                                  // Docker image tag
+	TarballPath        string    `json:"tarball_path" yaml:"tarball_path" toml:"tarball_path"`                         // Local path to save tarball
+	RemoteHost         string    `json:"remote_host" yaml:"remote_host" toml:"remote_host"`                            // SSH host
+	RemotePort         int       `json:"remote_port" yaml:"remote_port" toml:"remote_port"`                            // SSH port
+	RemoteUser         string    `json:"remote_user" yaml:"remote_user" toml:"remote_user"`                            // SSH username
+	RemoteKeyPath      string    `json:"remote_key_path" yaml:"remote_key_path" toml:"remote_key_path"`                // SSH private key path
+	RemoteUploadPath   string    `json:"remote_upload_path" yaml:"remote_upload_path" toml:"remote_upload_path"`       // Remote upload directory
+	BuildCommand       string    `json:"build_command" yaml:"build_command" toml:"build_command"`                      // Custom build command (optional)
+	PreBuildCommands   []Command `json:"pre_build_commands" yaml:"pre_build_commands" toml:"pre_build_commands"`       // Commands before build
+	PostBuildCommands  []Command `json:"post_build_commands" yaml:"post_build_commands" toml:"post_build_commands"`    // Commands after build
+	MetricsSink        string    `json:"metrics_sink" yaml:"metrics_sink" toml:"metrics_sink"`                         // Where to send run metrics: "file" or "pushgateway" (optional)
+	MetricsFile        string    `json:"metrics_file" yaml:"metrics_file" toml:"metrics_file"`                         // File to append run metrics to (JSON lines)
+	PushgatewayURL     string    `json:"pushgateway_url" yaml:"pushgateway_url" toml:"pushgateway_url"`                // Prometheus Pushgateway base URL
+	IncrementalUpload  bool      `json:"incremental_upload" yaml:"incremental_upload" toml:"incremental_upload"`       // Skip uploading layers already present on the remote
+	RemoteKeepTarballs int       `json:"remote_keep_tarballs" yaml:"remote_keep_tarballs" toml:"remote_keep_tarballs"` // Keep only the N newest tarballs of this image remotely (0 keeps all)
+
+	// Remote layer blobs of incremental_upload, absolute or relative to
+	// remote_upload_path (default: .fws-blobs)
+	RemoteBlobDirectory string `json:"remote_blob_directory" yaml:"remote_blob_directory" toml:"remote_blob_directory"`
+
+	// Image platform
+	Platform string `json:"platform" yaml:"platform" toml:"platform"` // Required image platform, e.g. "linux/arm64" (optional)
+
+	// Storage backend
+	Storage string   `json:"storage" yaml:"storage" toml:"storage"` // Where tarballs are uploaded: "ssh" (default) or "s3"
+	S3      S3Config `json:"s3" yaml:"s3" toml:"s3"`                // Bucket settings for the "s3" storage
+
+	// Transfer protocol of the "ssh" storage: "scp" (default) or "sftp"
+	UploadProtocol string `json:"upload_protocol" yaml:"upload_protocol" toml:"upload_protocol"`
+
+	// Upload scheduling
+	UploadWindows []string `json:"upload_windows" yaml:"upload_windows" toml:"upload_windows"`    // Daily local time windows for uploads, e.g. "22:00-06:00" (optional)
+	WaitForWindow bool     `json:"wait_for_window" yaml:"wait_for_window" toml:"wait_for_window"` // Wait for the next window instead of failing outside one
+
+	// Streaming
+	StreamSaveToRemote bool `json:"stream_save_to_remote" yaml:"stream_save_to_remote" toml:"stream_save_to_remote"` // Pipe docker save over SSH instead of writing a local tarball
+
+	// Image reference
+	ImageDigest string `json:"image_digest" yaml:"image_digest" toml:"image_digest"` // Save image_name@<digest> instead of a tag, e.g. "sha256:..." (optional)
+
+	// SSH settings
+	StrictKeyPermissions bool `json:"strict_key_permissions" yaml:"strict_key_permissions" toml:"strict_key_permissions"` // Refuse keys readable by group/others instead of warning
+	SSHDebug             bool `json:"ssh_debug" yaml:"ssh_debug" toml:"ssh_debug"`                                        // Log the SSH handshake, host key and authentication steps at debug level
+
+	// SSH keepalive
+	SSHKeepAliveInterval Duration `json:"ssh_keepalive_interval" yaml:"ssh_keepalive_interval" toml:"ssh_keepalive_interval"` // Send SSH keepalives this often during uploads (default: 30s, 0 disables)
+
+	// SSH authentication besides remote_key_path, tried after the key
+	UseSSHAgent    bool   `json:"use_ssh_agent" yaml:"use_ssh_agent" toml:"use_ssh_agent"`       // Also offer the keys of the ssh-agent at SSH_AUTH_SOCK
+	RemotePassword string `json:"remote_password" yaml:"remote_password" toml:"remote_password"` // Password of remote_user, tried after the keys (optional)
+
+	// Passphrase of an encrypted remote_key_path (default: $FWS_KEY_PASSPHRASE)
+	RemoteKeyPassphrase string `json:"remote_key_passphrase" yaml:"remote_key_passphrase" toml:"remote_key_passphrase"`
+
+	// Host key pinning
+	RemoteHostKeyFingerprint string `json:"remote_host_key_fingerprint" yaml:"remote_host_key_fingerprint" toml:"remote_host_key_fingerprint"` // Accept only this host key, e.g. "SHA256:..." from ssh-keygen -lf, instead of using known_hosts (optional)
+
+	// Retries
+	Retry RetryConfig `json:"retry" yaml:"retry" toml:"retry"` // Retry transient upload failures
+
+	// Local image retention
+	LocalKeepImages int `json:"local_keep_images" yaml:"local_keep_images" toml:"local_keep_images"` // Keep only the N newest local images of image_name after an upload (0 keeps all)
+
+	// Tarball cache
+	CacheTarballs bool `json:"cache_tarballs" yaml:"cache_tarballs" toml:"cache_tarballs"` // Reuse the saved tarball while the image ID is unchanged instead of running docker save
+
+	// Compression
+	Compression     string `json:"compression" yaml:"compression" toml:"compression"`                // Compress the tarball before uploading: "zstd" or "gzip" (optional)
+	CompressTarball bool   `json:"compress_tarball" yaml:"compress_tarball" toml:"compress_tarball"` // Shorthand for compression "gzip"
+
+	// Hook concurrency
+	PreBuildParallelism  int `json:"pre_build_parallelism" yaml:"pre_build_parallelism" toml:"pre_build_parallelism"`    // Run up to N pre-build commands at once (0 or 1: one after another)
+	PostBuildParallelism int `json:"post_build_parallelism" yaml:"post_build_parallelism" toml:"post_build_parallelism"` // Run up to N post-build commands at once (0 or 1: one after another)
+
+	// Image source
+	ImageFromStdin bool `json:"image_from_stdin" yaml:"image_from_stdin" toml:"image_from_stdin"` // Upload a docker save archive read from stdin instead of building and saving the image
+
+	// Source watching
+	WatchSource     bool     `json:"watch_source" yaml:"watch_source" toml:"watch_source"`             // Keep running and rebuild and upload whenever the source directory changes
+	SourceDirectory string   `json:"source_directory" yaml:"source_directory" toml:"source_directory"` // Directory watched for changes (default: docker_build_path)
+	SourceDebounce  Duration `json:"source_debounce" yaml:"source_debounce" toml:"source_debounce"`    // Quiet period after the last change before rebuilding
+
+	// Save options
+	SaveArgs []string `json:"save_args" yaml:"save_args" toml:"save_args"` // Extra docker save flags, e.g. "--platform=linux/arm64"
+
+	// Git build context
+	GitRepo string        `json:"git_repo" yaml:"git_repo" toml:"git_repo"` // Clone this repository and build from it, docker_build_path being relative to its root (optional)
+	GitRef  string        `json:"git_ref" yaml:"git_ref" toml:"git_ref"`    // Branch, tag or commit to build (default: the remote's default branch)
+	GitAuth GitAuthConfig `json:"git_auth" yaml:"git_auth" toml:"git_auth"` // Credentials for cloning git_repo (optional)
+
+	// Duplicate uploads
+	SkipUploadIfUnchanged bool `json:"skip_upload_if_unchanged" yaml:"skip_upload_if_unchanged" toml:"skip_upload_if_unchanged"` // Skip the upload when the tarball's checksum matches the last one uploaded
+
+	// Integrity check
+	ChecksumFile bool `json:"checksum_file" yaml:"checksum_file" toml:"checksum_file"` // Upload "<tarball>.sha256" ahead of the tarball for the watcher to verify it before loading
+
+	// Base image
+	BaseImage string `json:"base_image" yaml:"base_image" toml:"base_image"` // Upload this image's layers once and leave them out of every tarball, e.g. "node:20-slim" (optional)
 }
 
 type WatcherConfig struct {
-	WatchDirectory   string   `json:"watch_directory"`    // Directory to watch for tarballs
-	ContainerName    string   `json:"container_name"`     // Container name to manage
-	ContainerPort    []string `json:"container_ports"`    // Port mappings
-	ContainerEnv     []string `json:"container_env"`      // Environment variables
-	ContainerVolumes []string `json:"container_volumes"`  // Volume mappings
-	PreLoadCommands  []string `json:"pre_load_commands"`  // Commands before loading image
-	PostLoadCommands []string `json:"post_load_commands"` // Commands after loading image
-	RestartPolicy    string   `json:"restart_policy"`     // Docker restart policy
-}
-
-func LoadConfig(configPath string) (*Config, error) {
-	config := &Config{
+	WatchDirectory   string    `json:"watch_directory" yaml:"watch_directory" toml:"watch_directory"`          // Directory to watch for tarballs
+	ContainerName    string    `json:"container_name" yaml:"container_name" toml:"container_name"`             // Container name to manage, may use {{.Image}}, {{.Tag}} and {{.GitSHA}}
+	ContainerPort    []string  `json:"container_ports" yaml:"container_ports" toml:"container_ports"`          // Port mappings
+	ContainerEnv     []string  `json:"container_env" yaml:"container_env" toml:"container_env"`                // Environment variables
+	ContainerVolumes []string  `json:"container_volumes" yaml:"container_volumes" toml:"container_volumes"`    // Volume mappings
+	PreLoadCommands  []Command `json:"pre_load_commands" yaml:"pre_load_commands" toml:"pre_load_commands"`    // Commands before loading image
+	PostLoadCommands []Command `json:"post_load_commands" yaml:"post_load_commands" toml:"post_load_commands"` // Commands after loading image
+	RestartPolicy    string    `json:"restart_policy" yaml:"restart_policy" toml:"restart_policy"`             // Docker restart policy
+	PullPolicy       string    `json:"pull_policy" yaml:"pull_policy" toml:"pull_policy"`                      // Docker run pull policy: "always", "missing" or "never"
+	StateFile        string    `json:"state_file" yaml:"state_file" toml:"state_file"`                         // Watcher state file (default: <watch_directory>/.fws-state.json)
+	JournalFile      string    `json:"journal_file" yaml:"journal_file" toml:"journal_file"`                   // Deploy history, one JSON line per deploy (default: <watch_directory>/.fws-journal.jsonl)
+	Recursive        bool      `json:"recursive" yaml:"recursive" toml:"recursive"`                            // Also watch subdirectories, following symlinks
+	BlobDirectory    string    `json:"blob_directory" yaml:"blob_directory" toml:"blob_directory"`             // Layer blobs for incremental uploads (default: <watch_directory>/.fws-blobs)
+
+	// File event handling
+	TriggerOn   []string `json:"trigger_on" yaml:"trigger_on" toml:"trigger_on"`       // File events that trigger a deploy: "create", "write", "rename", "chmod"
+	SettleDelay Duration `json:"settle_delay" yaml:"settle_delay" toml:"settle_delay"` // Quiet period after the last event for a file before it is processed
+
+	// S3 delivery
+	S3             S3Config `json:"s3" yaml:"s3" toml:"s3"`                                           // Pull tarballs from this bucket into the watch directory (optional)
+	S3PollInterval Duration `json:"s3_poll_interval" yaml:"s3_poll_interval" toml:"s3_poll_interval"` // How often to check the bucket
+
+	// Distributed deploy lock
+	DeployLock DeployLockConfig `json:"deploy_lock" yaml:"deploy_lock" toml:"deploy_lock"` // Let only one of several watchers sharing the watch directory deploy each file (optional)
+
+	// Upload coordination
+	LockTimeout Duration `json:"lock_timeout" yaml:"lock_timeout" toml:"lock_timeout"` // Ignore "<file>.lock" files older than this (0: never)
+
+	// Watch mode
+	WatchMode    string   `json:"watch_mode" yaml:"watch_mode" toml:"watch_mode"`          // "auto" (default), "inotify" or "poll"
+	PollInterval Duration `json:"poll_interval" yaml:"poll_interval" toml:"poll_interval"` // How often the watch directory is listed in poll mode
+
+	// Event queue
+	EventBufferSize uint `json:"event_buffer_size" yaml:"event_buffer_size" toml:"event_buffer_size"` // Events buffered between the OS and the watcher (0: unbuffered)
+
+	// Idle shutdown
+	IdleTimeout Duration `json:"idle_timeout" yaml:"idle_timeout" toml:"idle_timeout"` // Exit when nothing was deployed for this long, for scale-to-zero workers (0: never)
+
+	// Trigger files
+	TriggerFilePattern string `json:"trigger_file_pattern" yaml:"trigger_file_pattern" toml:"trigger_file_pattern"` // React to trigger files matching this pattern (e.g. "*.deploy.json") instead of tarballs (optional)
+
+	// Deploy rate limiting
+	MaxDeploysPerMinute int `json:"max_deploys_per_minute" yaml:"max_deploys_per_minute" toml:"max_deploys_per_minute"` // Pause processing when exceeded (0 disables)
+
+	// Image resolution
+	ImageNameCommand string `json:"image_name_command" yaml:"image_name_command" toml:"image_name_command"` // Command given the tarball path that prints the image to run
+
+	ImageNameFromFilenameRegex string `json:"image_name_from_filename_regex" yaml:"image_name_from_filename_regex" toml:"image_name_from_filename_regex"` // Regex with "repo" and optional "tag" groups matched against the tarball file name
+
+	// Image transform
+	PostLoadTransformCommand string `json:"post_load_transform_command" yaml:"post_load_transform_command" toml:"post_load_transform_command"` // Command given the loaded image that prints the image to run, e.g. after re-tagging it (optional)
+
+	// Stable image alias
+	StableAlias string `json:"stable_alias" yaml:"stable_alias" toml:"stable_alias"` // Repository to tag loaded images as <alias>:current (the one before as <alias>:previous) and run from (optional)
+
+	// Artifact handling
+	QuarantineDirectory string `json:"quarantine_directory" yaml:"quarantine_directory" toml:"quarantine_directory"` // Where tarballs of failed deploys are kept (default: <watch_directory>/quarantine)
+	ArchiveDirectory    string `json:"archive_directory" yaml:"archive_directory" toml:"archive_directory"`          // Keep deployed tarballs here for replay instead of deleting them (optional)
+
+	// Control and metrics API
+	ControlListen string `json:"control_listen" yaml:"control_listen" toml:"control_listen"` // Control API address, "host:port" or "unix:/path" (optional)
+	MetricsListen string `json:"metrics_listen" yaml:"metrics_listen" toml:"metrics_listen"` // Prometheus metrics address, "host:port" or "unix:/path" (optional)
+	TLSCertFile   string `json:"tls_cert_file" yaml:"tls_cert_file" toml:"tls_cert_file"`    // Serve the APIs over TLS with this certificate
+	TLSKeyFile    string `json:"tls_key_file" yaml:"tls_key_file" toml:"tls_key_file"`       // Private key for tls_cert_file
+	AuthToken     string `json:"auth_token" yaml:"auth_token" toml:"auth_token"`             // Bearer token required by both APIs (optional)
+
+	// Tokens limited to reading or administering the APIs (optional)
+	AuthTokens []AuthToken `json:"auth_tokens" yaml:"auth_tokens" toml:"auth_tokens"`
+
+	// Readiness settings
+	WarmupDelay          Duration `json:"warmup_delay" yaml:"warmup_delay" toml:"warmup_delay"`                               // Wait after start before checking readiness
+	ReadinessCommand     string   `json:"readiness_command" yaml:"readiness_command" toml:"readiness_command"`                // Command that exits 0 once the app is ready
+	ReadinessInContainer bool     `json:"readiness_in_container" yaml:"readiness_in_container" toml:"readiness_in_container"` // Run the readiness command via docker exec
+	ReadinessTimeout     Duration `json:"readiness_timeout" yaml:"readiness_timeout" toml:"readiness_timeout"`                // How long to retry the readiness command
+	RollbackOnFailure    bool     `json:"rollback_on_failure" yaml:"rollback_on_failure" toml:"rollback_on_failure"`          // Restart the previous image if the new one is not ready
+
+	// Retries
+	Retry RetryConfig `json:"retry" yaml:"retry" toml:"retry"` // Retry transient docker load/run failures
+
+	// Hardware access
+	GPUs    string   `json:"gpus" yaml:"gpus" toml:"gpus"`          // GPUs to expose: "all", a count, or "device=0,1" (optional)
+	Devices []string `json:"devices" yaml:"devices" toml:"devices"` // Host devices to expose: "/dev/host[:/dev/container[:rwm]]"
+
+	// Container labels
+	Labels    []string `json:"labels" yaml:"labels" toml:"labels"`             // Labels for the container ("key=value"), overriding label_file
+	LabelFile string   `json:"label_file" yaml:"label_file" toml:"label_file"` // File of "key=value" lines passed as --label-file, relative to the config file (optional)
+
+	// Smoke test
+	SmokeTestCommand string   `json:"smoke_test_command" yaml:"smoke_test_command" toml:"smoke_test_command"` // Command run once the container is ready; non-zero exit fails the deploy (optional)
+	SmokeTestTimeout Duration `json:"smoke_test_timeout" yaml:"smoke_test_timeout" toml:"smoke_test_timeout"` // Time limit for the smoke test command
+
+	// Deploy ordering
+	DeployStrategy string `json:"deploy_strategy" yaml:"deploy_strategy" toml:"deploy_strategy"` // When the old container is stopped: "stop-after-load" (default), "stop-before-load", "stop-first" or "blue-green"
+
+	// Name collisions
+	ForceReplace bool `json:"force_replace" yaml:"force_replace" toml:"force_replace"` // Force-remove a container that still holds the container name before starting, instead of failing
+
+	// Hook concurrency
+	PreLoadParallelism  int `json:"pre_load_parallelism" yaml:"pre_load_parallelism" toml:"pre_load_parallelism"`    // Run up to N pre-load commands at once (0 or 1: one after another)
+	PostLoadParallelism int `json:"post_load_parallelism" yaml:"post_load_parallelism" toml:"post_load_parallelism"` // Run up to N post-load commands at once (0 or 1: one after another)
+
+	// Minimum file age
+	MinFileAge Duration `json:"min_file_age" yaml:"min_file_age" toml:"min_file_age"` // Only process deploy files last modified at least this long ago (optional)
+
+	// File size stability
+	StableFileQuiet   Duration `json:"stable_file_quiet" yaml:"stable_file_quiet" toml:"stable_file_quiet"`       // Only process deploy files whose size did not change for this long (optional)
+	StableFileTimeout Duration `json:"stable_file_timeout" yaml:"stable_file_timeout" toml:"stable_file_timeout"` // Warn about a file whose size did not settle after this long
+
+	// Deploy metadata
+	MetadataFilenameRegex string `json:"metadata_filename_regex" yaml:"metadata_filename_regex" toml:"metadata_filename_regex"` // Regex whose named groups are taken from the tarball file name as metadata (optional)
+	MetadataSidecar       bool   `json:"metadata_sidecar" yaml:"metadata_sidecar" toml:"metadata_sidecar"`                      // Read metadata from "<tarball>.meta.json", a JSON object of strings
+
+	// Previous container
+	KeepPreviousContainer bool `json:"keep_previous_container" yaml:"keep_previous_container" toml:"keep_previous_container"` // Keep the replaced container stopped as "<container>-previous" for fast rollback instead of removing it
+
+	// Untagged images
+	UntaggedImages string `json:"untagged_images" yaml:"untagged_images" toml:"untagged_images"` // How to run an image loaded without repo tags: "tag" as <container_name>:latest (default) or "id"
+
+	// File actions
+	FileActions []FileAction `json:"file_actions" yaml:"file_actions" toml:"file_actions"` // Map file name patterns to actions, first match wins (default: tarballs, or trigger files, are deployed)
+
+	// Image garbage collection
+	KeepImages int `json:"keep_images" yaml:"keep_images" toml:"keep_images"` // Keep only the images of the N newest deploys to the container, removing older ones fws deployed (0 keeps all)
+
+	// Tarball cleanup
+	CleanupRetries      int  `json:"cleanup_retries" yaml:"cleanup_retries" toml:"cleanup_retries"`                   // Retry removing or archiving a deployed tarball N times, waiting 1s, 2s, 4s, ... in between
+	CleanupFailureFatal bool `json:"cleanup_failure_fatal" yaml:"cleanup_failure_fatal" toml:"cleanup_failure_fatal"` // Fail the deploy command and stop the watcher when cleanup still fails
+
+	// Quarantine retention
+	QuarantineKeep   int      `json:"quarantine_keep" yaml:"quarantine_keep" toml:"quarantine_keep"`          // Keep only the N newest quarantined files (0 keeps all)
+	QuarantineMaxAge Duration `json:"quarantine_max_age" yaml:"quarantine_max_age" toml:"quarantine_max_age"` // Remove quarantined files older than this (0 keeps them)
+
+	// Secrets
+	Secrets          []SecretSpec `json:"secrets" yaml:"secrets" toml:"secrets"`                               // Secrets mounted into the container as read-only files
+	SecretsDirectory string       `json:"secrets_directory" yaml:"secrets_directory" toml:"secrets_directory"` // Host directory the secret files are written to, preferably on tmpfs
+
+	// Deploy feedback
+	ShowLogsAfterDeploy int `json:"show_logs_after_deploy" yaml:"show_logs_after_deploy" toml:"show_logs_after_deploy"` // Log the last N lines of the new container's output after a successful deploy (0 disables)
+
+	// Remote deploy host
+	DockerHost            string          `json:"docker_host" yaml:"docker_host" toml:"docker_host"`                                        // Docker daemon to deploy to, e.g. "ssh://deploy@app1" (default: DOCKER_HOST or the local daemon)
+	SSHSource             SSHSourceConfig `json:"ssh_source" yaml:"ssh_source" toml:"ssh_source"`                                           // Pull tarballs from a directory on another host into the watch directory (optional)
+	SSHSourcePollInterval Duration        `json:"ssh_source_poll_interval" yaml:"ssh_source_poll_interval" toml:"ssh_source_poll_interval"` // How often to check the remote directory
+
+	// Built-in proxy
+	ProxyListen      string `json:"proxy_listen" yaml:"proxy_listen" toml:"proxy_listen"`                   // Address the proxy accepts connections on, e.g. ":80" (optional)
+	ProxyBackendPort int    `json:"proxy_backend_port" yaml:"proxy_backend_port" toml:"proxy_backend_port"` // Port inside the container the proxy forwards to
+
+	// Base images
+	BaseDirectory string `json:"base_directory" yaml:"base_directory" toml:"base_directory"` // Base image tarballs of base_image uploads (default: <watch_directory>/.fws-bases)
+
+	// Version ordering
+	DeployOnlyNewer bool `json:"deploy_only_newer" yaml:"deploy_only_newer" toml:"deploy_only_newer"` // Skip tarballs whose file name timestamp is not newer than the deployed one's
+
+	// Deploy gate
+	PreDeployGateCommand    string   `json:"pre_deploy_gate_command" yaml:"pre_deploy_gate_command" toml:"pre_deploy_gate_command"`          // Command run before each deploy; a non-zero exit skips the deploy (optional)
+	PreDeployGateTimeout    Duration `json:"pre_deploy_gate_timeout" yaml:"pre_deploy_gate_timeout" toml:"pre_deploy_gate_timeout"`          // Time limit for the gate command; running longer skips the deploy
+	PreDeployGateQuarantine bool     `json:"pre_deploy_gate_quarantine" yaml:"pre_deploy_gate_quarantine" toml:"pre_deploy_gate_quarantine"` // Quarantine skipped tarballs for a later replay instead of leaving them in place
+
+	// Runtime config inheritance
+	InheritRuntimeConfig bool `json:"inherit_runtime_config" yaml:"inherit_runtime_config" toml:"inherit_runtime_config"` // Take container_ports, container_env and container_volumes left empty from the running container
+}
+
+// ImageRef returns the image reference to build and save, either
+// name:tag or name@digest
+func (c *UploaderConfig) ImageRef() string {
+	if c.ImageDigest != "" {
+		return c.ImageName + "@" + c.ImageDigest
+	}
+	return c.ImageName + ":" + c.ImageTag
+}
+
+// SourcePath returns the directory watched with watch_source
+func (c *UploaderConfig) SourcePath() string {
+	if c.SourceDirectory != "" {
+		return c.SourceDirectory
+	}
+	return c.DockerBuildPath
+}
+
+// ImageLabel returns a file name safe form of the tag or digest, used in
+// tarball names
+func (c *UploaderConfig) ImageLabel() string {
+	if c.ImageDigest != "" {
+		digest := strings.TrimPrefix(c.ImageDigest, "sha256:")
+		if len(digest) > 12 {
+			digest = digest[:12]
+		}
+		return "sha256-" + digest
+	}
+	return c.ImageTag
+}
+
+// CompressionFormat returns the format tarballs are compressed with, ""
+// for none. compress_tarball stands for gzip.
+func (c *UploaderConfig) CompressionFormat() string {
+	if c.Compression == "" && c.CompressTarball {
+		return "gzip"
+	}
+	return c.Compression
+}
+
+// StatePath returns the location of the watcher state file
+func (c *WatcherConfig) StatePath() string {
+	if c.StateFile != "" {
+		return c.StateFile
+	}
+	return filepath.Join(c.WatchDirectory, ".fws-state.json")
+}
+
+// JournalPath returns the location of the deploy journal
+func (c *WatcherConfig) JournalPath() string {
+	if c.JournalFile != "" {
+		return c.JournalFile
+	}
+	return filepath.Join(c.WatchDirectory, ".fws-journal.jsonl")
+}
+
+// BlobPath returns the directory holding layer blobs for incremental uploads
+func (c *WatcherConfig) BlobPath() string {
+	if c.BlobDirectory != "" {
+		return c.BlobDirectory
+	}
+	return filepath.Join(c.WatchDirectory, BlobDirName)
+}
+
+// RemoteBlobPath returns the remote directory incremental uploads put layer
+// blobs in, relative to remote_upload_path unless absolute
+func (c *UploaderConfig) RemoteBlobPath() string {
+	if c.RemoteBlobDirectory != "" {
+		return c.RemoteBlobDirectory
+	}
+	return BlobDirName
+}
+
+// BasePath returns the directory holding base image tarballs
+func (c *WatcherConfig) BasePath() string {
+	if c.BaseDirectory != "" {
+		return c.BaseDirectory
+	}
+	return filepath.Join(c.WatchDirectory, BaseDirName)
+}
+
+// QuarantinePath returns the directory that keeps tarballs of failed deploys
+func (c *WatcherConfig) QuarantinePath() string {
+	if c.QuarantineDirectory != "" {
+		return c.QuarantineDirectory
+	}
+	return filepath.Join(c.WatchDirectory, "quarantine")
+}
+
+// DefaultTriggerOn returns the file events that trigger a deploy by default.
+// Rename is included because many upload tools move the finished file into
+// place.
+func DefaultTriggerOn() []string {
+	return []string{"create", "write", "rename"}
+}
+
+// DefaultConfig returns the settings used for everything a config file
+// leaves out. Defaults that depend on other settings are only applied by
+// LoadConfig.
+func DefaultConfig() *Config {
+	return &Config{
 		Mode:     "watcher",
 		LogLevel: "info",
 		Uploader: UploaderConfig{
-			RemotePort: 22,
-			ImageTag:   "latest",
+			RemotePort:           22,
+			Retry:                DefaultRetry(),
+			SSHKeepAliveInterval: Duration(30 * time.Second),
+			SourceDebounce:       Duration(2 * time.Second),
 		},
 		Watcher: WatcherConfig{
-			RestartPolicy: "unless-stopped",
+			RestartPolicy:    "unless-stopped",
+			PullPolicy:       "never",
+			TriggerOn:        DefaultTriggerOn(),
+			SettleDelay:      Duration(2 * time.Second),
+			S3PollInterval:   Duration(30 * time.Second),
+			WatchMode:        "auto",
+			LockTimeout:      Duration(time.Hour),
+			DeployLock:       DeployLockConfig{KeyPrefix: "fws/deploy-lock/", TTL: Duration(30 * time.Second)},
+			PollInterval:     Duration(5 * time.Second),
+			ReadinessTimeout: Duration(time.Minute),
+			SmokeTestTimeout: Duration(5 * time.Minute),
+			DeployStrategy:   StopAfterLoad,
+			Retry:            DefaultRetry(),
+			SecretsDirectory: "/dev/shm/fws-secrets",
+
+			SSHSourcePollInterval: Duration(30 * time.Second),
+			PreDeployGateTimeout:  Duration(30 * time.Second),
+			StableFileTimeout:     Duration(10 * time.Minute),
 		},
+		LogSampling: LogSamplingConfig{Interval: Duration(time.Second)},
 	}
+}
 
+// LoadConfig reads the config file and, if profile is set, applies the
+// profile of that name on top of the base settings
+func LoadConfig(configPath, profile string) (*Config, error) {
+	config := DefaultConfig()
 	if configPath == "" {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %q not found in config (available: none)", profile)
+		}
+		applyDefaults(config)
 		return config, nil
 	}
 
-	file, err := os.Open(configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open config file: %w", err)
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(config); err != nil {
-		return nil, fmt.Errorf("failed to decode config file: %w", err)
+	format := FileFormat(configPath)
+	if err := decode(data, format, config); err != nil {
+		return nil, fmt.Errorf("failed to decode %s config file %s: %w", format, configPath, err)
+	}
+
+	if profile != "" {
+		if err := applyProfile(config, profile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := expandPaths(config); err != nil {
+		return nil, err
+	}
+
+	// Hook scripts, the label file and the output log file are relative to
+	// the config file
+	configDir := filepath.Dir(configPath)
+	setBaseDir(config.Uploader.PreBuildCommands, configDir)
+	setBaseDir(config.Uploader.PostBuildCommands, configDir)
+	setBaseDir(config.Watcher.PreLoadCommands, configDir)
+	setBaseDir(config.Watcher.PostLoadCommands, configDir)
+	if key := config.Uploader.GitAuth.SSHKey; key != "" && !filepath.IsAbs(key) {
+		config.Uploader.GitAuth.SSHKey = filepath.Join(configDir, key)
+	}
+	if key := config.Watcher.SSHSource.KeyPath; key != "" && !filepath.IsAbs(key) {
+		config.Watcher.SSHSource.KeyPath = filepath.Join(configDir, key)
+	}
+	if config.Watcher.LabelFile != "" && !filepath.IsAbs(config.Watcher.LabelFile) {
+		config.Watcher.LabelFile = filepath.Join(configDir, config.Watcher.LabelFile)
+	}
+	setSecretBaseDir(config.Watcher.Secrets, configDir)
+	if config.OutputLogFile != "" && !filepath.IsAbs(config.OutputLogFile) {
+		config.OutputLogFile = filepath.Join(configDir, config.OutputLogFile)
 	}
 
+	applyDefaults(config)
 	return config, nil
 }
 
+// applyDefaults sets the defaults that depend on other settings, once the
+// config file was read
+func applyDefaults(config *Config) {
+	// Images are saved by tag unless pinned by digest
+	if config.Uploader.ImageTag == "" && config.Uploader.ImageDigest == "" {
+		config.Uploader.ImageTag = "latest"
+	}
+}
+
+// SaveConfig writes the config in the format of its extension, see
+// FileFormat
 func (c *Config) SaveConfig(configPath string) error {
-	file, err := os.Create(configPath)
+	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+	format := FileFormat(configPath)
+	data, err = fromJSON(append(data, '\n'), format)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s config file: %w", format, err)
+	}
+
+	// Passwords and tokens are only readable by the owner. An existing file
+	// keeps its permissions when written, so it is restricted first.
+	perm := os.FileMode(0666)
+	if c.HasSecrets() {
+		perm = 0600
+		if err := os.Chmod(configPath, perm); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to restrict config file permissions: %w", err)
+		}
+	}
+	if err := os.WriteFile(configPath, data, perm); err != nil {
 		return fmt.Errorf("failed to create config file: %w", err)
 	}
-	defer file.Close()
+	return nil
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(c); err != nil {
-		return fmt.Errorf("failed to encode config file: %w", err)
+// validateFingerprint checks a host key fingerprint in the SHA256 format of
+// ssh-keygen -lf
+func validateFingerprint(fp string) error {
+	hash, ok := strings.CutPrefix(fp, "SHA256:")
+	if !ok {
+		return fmt.Errorf("invalid remote_host_key_fingerprint: %s (expected SHA256:<base64>, as printed by ssh-keygen -lf)", fp)
+	}
+	if sum, err := base64.RawStdEncoding.DecodeString(hash); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("invalid remote_host_key_fingerprint: %s (not a SHA256 hash)", fp)
 	}
+	return nil
+}
+
+// LogSamplingConfig limits how often the same debug message is logged
+type LogSamplingConfig struct {
+	First      int      `json:"first" yaml:"first" toml:"first"`                // Messages of each kind logged per interval; 0 disables sampling
+	Thereafter int      `json:"thereafter" yaml:"thereafter" toml:"thereafter"` // Then log every Nth message (0: none until the next interval)
+	Interval   Duration `json:"interval" yaml:"interval" toml:"interval"`       // Length of a sampling interval (default: 1s)
+}
 
+// Validate checks the sampling settings
+func (s LogSamplingConfig) Validate() error {
+	if s.First < 0 || s.Thereafter < 0 {
+		return fmt.Errorf("log_sampling.first and log_sampling.thereafter must not be negative")
+	}
+	if s.First > 0 && s.Interval <= 0 {
+		return fmt.Errorf("log_sampling.interval must be positive")
+	}
 	return nil
 }
 
+// ValidationErrors splits an error returned by Validate into the
+// individual problems
+func ValidationErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, ValidationErrors(e)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
+
+// Validate checks the configuration of the selected mode. It reports every
+// problem found at once, joined with errors.Join; ValidationErrors splits
+// them again.
 func (c *Config) Validate() error {
 	if c.Mode != "uploader" && c.Mode != "watcher" {
 		return fmt.Errorf("invalid mode: %s (must be 'uploader' or 'watcher')", c.Mode)
 	}
 
+	var errs []error
+
+	if err := c.LogSampling.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.MaxOutputLength < 0 {
+		errs = append(errs, fmt.Errorf("max_output_length must not be negative"))
+	}
+	if c.OutputLogFile != "" && c.MaxOutputLength == 0 {
+		errs = append(errs, fmt.Errorf("output_log_file requires max_output_length, it receives the output of commands longer than that"))
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid otlp_endpoint: %s (expected an http or https URL, e.g. http://localhost:4318)", c.OTLPEndpoint))
+		}
+	}
+
+	errs = append(errs, c.validateAllowedCommands()...)
+
 	if c.Mode == "uploader" {
 		if c.Uploader.DockerBuildPath == "" {
-			return fmt.Errorf("docker_build_path is required for uploader mode")
+			errs = append(errs, fmt.Errorf("docker_build_path is required for uploader mode"))
 		}
 		if c.Uploader.ImageName == "" {
-			return fmt.Errorf("image_name is required for uploader mode")
+			errs = append(errs, fmt.Errorf("image_name is required for uploader mode"))
+		}
+		if c.Uploader.ImageTag != "" && c.Uploader.ImageDigest != "" {
+			errs = append(errs, fmt.Errorf("image_tag and image_digest are mutually exclusive"))
+		}
+		if c.Uploader.ImageDigest != "" && !strings.HasPrefix(c.Uploader.ImageDigest, "sha256:") {
+			errs = append(errs, fmt.Errorf("invalid image_digest: %s (expected sha256:<hex>)", c.Uploader.ImageDigest))
+		}
+		for _, hooks := range []struct {
+			name        string
+			commands    []Command
+			parallelism int
+		}{
+			{"pre_build_commands", c.Uploader.PreBuildCommands, c.Uploader.PreBuildParallelism},
+			{"post_build_commands", c.Uploader.PostBuildCommands, c.Uploader.PostBuildParallelism},
+		} {
+			name := hooks.name
+			if hooks.parallelism < 0 {
+				errs = append(errs, fmt.Errorf("%s parallelism must not be negative", name))
+			}
+			for _, cmd := range hooks.commands {
+				if cmd.Once || cmd.InContainer {
+					errs = append(errs, fmt.Errorf("%s do not support once or in_container: %s", name, cmd))
+					continue
+				}
+				if err := cmd.validate(); err != nil {
+					errs = append(errs, fmt.Errorf("invalid %s entry: %w", name, err))
+				}
+			}
+		}
+		if fp := c.Uploader.RemoteHostKeyFingerprint; fp != "" {
+			if err := validateFingerprint(fp); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if c.Uploader.LocalKeepImages < 0 {
+			errs = append(errs, fmt.Errorf("local_keep_images must not be negative"))
+		}
+		switch c.Uploader.Storage {
+		case "", "ssh":
+			if c.Uploader.RemoteHost == "" {
+				errs = append(errs, fmt.Errorf("remote_host is required for uploader mode"))
+			}
+			if c.Uploader.RemoteUser == "" {
+				errs = append(errs, fmt.Errorf("remote_user is required for uploader mode"))
+			}
+			if c.Uploader.RemoteUploadPath == "" {
+				errs = append(errs, fmt.Errorf("remote_upload_path is required for uploader mode"))
+			}
+		case "s3":
+			if err := c.Uploader.S3.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+			if c.Uploader.IncrementalUpload {
+				errs = append(errs, fmt.Errorf("incremental_upload is only supported with the ssh storage"))
+			}
+			if c.Uploader.UploadProtocol != "" {
+				errs = append(errs, fmt.Errorf("upload_protocol is only supported with the ssh storage"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("invalid storage: %s (must be 'ssh' or 's3')", c.Uploader.Storage))
+		}
+		switch c.Uploader.UploadProtocol {
+		case "", "scp", "sftp":
+		default:
+			errs = append(errs, fmt.Errorf("invalid upload_protocol: %s (must be 'scp' or 'sftp')", c.Uploader.UploadProtocol))
+		}
+		if c.Uploader.Platform != "" && strings.Count(c.Uploader.Platform, "/") < 1 {
+			errs = append(errs, fmt.Errorf("invalid platform: %s (expected os/arch[/variant])", c.Uploader.Platform))
+		}
+		if c.Uploader.StreamSaveToRemote && c.Uploader.IncrementalUpload {
+			errs = append(errs, fmt.Errorf("stream_save_to_remote cannot be combined with incremental_upload"))
+		}
+		if c.Uploader.StreamSaveToRemote && c.Uploader.CacheTarballs {
+			errs = append(errs, fmt.Errorf("stream_save_to_remote cannot be combined with cache_tarballs, which needs a local tarball"))
+		}
+		if c.Uploader.StreamSaveToRemote && c.Uploader.Platform != "" {
+			errs = append(errs, fmt.Errorf("stream_save_to_remote cannot be combined with platform, which checks the local tarball"))
+		}
+		switch c.Uploader.Compression {
+		case "", "zstd", "gzip":
+		default:
+			errs = append(errs, fmt.Errorf("invalid compression: %s (must be 'zstd', 'gzip' or empty)", c.Uploader.Compression))
 		}
-		if c.Uploader.RemoteHost == "" {
-			return fmt.Errorf("remote_host is required for uploader mode")
+		if c.Uploader.CompressTarball && c.Uploader.Compression != "" && c.Uploader.Compression != "gzip" {
+			errs = append(errs, fmt.Errorf("compress_tarball cannot be combined with compression %s, it compresses with gzip", c.Uploader.Compression))
 		}
-		if c.Uploader.RemoteUser == "" {
-			return fmt.Errorf("remote_user is required for uploader mode")
+		if c.Uploader.CompressionFormat() != "" && c.Uploader.IncrementalUpload {
+			errs = append(errs, fmt.Errorf("compression cannot be combined with incremental_upload, which ships layers of the plain tarball"))
 		}
-		if c.Uploader.RemoteUploadPath == "" {
-			return fmt.Errorf("remote_upload_path is required for uploader mode")
+		if c.Uploader.ImageFromStdin && c.Uploader.CacheTarballs {
+			errs = append(errs, fmt.Errorf("image_from_stdin cannot be combined with cache_tarballs, which needs the image in docker"))
+		}
+		if err := validateSaveArgs(c.Uploader.SaveArgs); err != nil {
+			errs = append(errs, err)
+		}
+		if c.Uploader.ImageFromStdin && len(c.Uploader.SaveArgs) > 0 {
+			errs = append(errs, fmt.Errorf("image_from_stdin cannot be combined with save_args, fws does not run docker save"))
+		}
+		if c.Uploader.WatchSource && c.Uploader.ImageFromStdin {
+			errs = append(errs, fmt.Errorf("watch_source cannot be combined with image_from_stdin, there is no source to watch"))
+		}
+		errs = append(errs, c.Uploader.validateGitSource()...)
+		if c.Uploader.SourceDebounce < 0 {
+			errs = append(errs, fmt.Errorf("source_debounce must not be negative"))
+		}
+		if c.Uploader.ImageFromStdin && c.Uploader.LocalKeepImages > 0 {
+			errs = append(errs, fmt.Errorf("image_from_stdin cannot be combined with local_keep_images, fws does not build the image"))
+		}
+		if c.Uploader.SkipUploadIfUnchanged && c.Uploader.StreamSaveToRemote {
+			errs = append(errs, fmt.Errorf("skip_upload_if_unchanged cannot be combined with stream_save_to_remote, which has no local tarball to hash"))
+		}
+		if c.Uploader.ChecksumFile && c.Uploader.StreamSaveToRemote {
+			errs = append(errs, fmt.Errorf("checksum_file cannot be combined with stream_save_to_remote, which has no local tarball to hash"))
+		}
+		if c.Uploader.ChecksumFile && c.Uploader.IncrementalUpload {
+			errs = append(errs, fmt.Errorf("checksum_file cannot be combined with incremental_upload, which uploads a different tarball than the one saved"))
+		}
+		if c.Uploader.CompressionFormat() != "" && c.Uploader.StreamSaveToRemote {
+			errs = append(errs, fmt.Errorf("compression cannot be combined with stream_save_to_remote"))
+		}
+		if c.Uploader.BaseImage != "" {
+			if c.Uploader.Storage != "" && c.Uploader.Storage != "ssh" {
+				errs = append(errs, fmt.Errorf("base_image is only supported with the ssh storage"))
+			}
+			if c.Uploader.IncrementalUpload {
+				errs = append(errs, fmt.Errorf("base_image cannot be combined with incremental_upload, which already skips layers present on the remote"))
+			}
+			if c.Uploader.StreamSaveToRemote {
+				errs = append(errs, fmt.Errorf("base_image cannot be combined with stream_save_to_remote, which has no local tarball to strip"))
+			}
+		}
+		for _, window := range c.Uploader.UploadWindows {
+			if _, err := ParseTimeWindow(window); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := c.Uploader.Retry.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if c.Uploader.RemoteKeepTarballs < 0 {
+			errs = append(errs, fmt.Errorf("remote_keep_tarballs must not be negative"))
+		}
+		switch c.Uploader.MetricsSink {
+		case "":
+		case "file":
+			if c.Uploader.MetricsFile == "" {
+				errs = append(errs, fmt.Errorf("metrics_file is required when metrics_sink is 'file'"))
+			}
+		case "pushgateway":
+			if c.Uploader.PushgatewayURL == "" {
+				errs = append(errs, fmt.Errorf("pushgateway_url is required when metrics_sink is 'pushgateway'"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("invalid metrics_sink: %s (must be 'file' or 'pushgateway')", c.Uploader.MetricsSink))
 		}
 	}
 
 	if c.Mode == "watcher" {
 		if c.Watcher.WatchDirectory == "" {
-			return fmt.Errorf("watch_directory is required for watcher mode")
+			errs = append(errs, fmt.Errorf("watch_directory is required for watcher mode"))
 		}
+		runOptions := c.Watcher.RunOptions()
 		if c.Watcher.ContainerName == "" {
-			return fmt.Errorf("container_name is required for watcher mode")
+			errs = append(errs, fmt.Errorf("container_name is required for watcher mode"))
+			runOptions.Name = "placeholder" // Already reported, don't report the name twice
+		} else if c.Watcher.ContainerNameIsTemplate() {
+			name, err := c.Watcher.RenderContainerName(sampleContainerNameVars)
+			if err != nil {
+				errs = append(errs, err)
+				name = "placeholder" // Already reported
+			}
+			runOptions.Name = name
+		}
+		for _, err := range ValidationErrors(runOptions.Validate()) {
+			errs = append(errs, fmt.Errorf("invalid container options: %w", err))
+		}
+		if len(c.Watcher.TriggerOn) == 0 {
+			errs = append(errs, fmt.Errorf("trigger_on must list at least one event"))
+		}
+		for _, op := range c.Watcher.TriggerOn {
+			switch op {
+			case "create", "write", "rename", "chmod":
+			default:
+				errs = append(errs, fmt.Errorf("invalid trigger_on event: %s (must be 'create', 'write', 'rename' or 'chmod')", op))
+			}
+		}
+		if c.Watcher.IdleTimeout < 0 {
+			errs = append(errs, fmt.Errorf("idle_timeout must not be negative"))
+		}
+		if c.Watcher.DeployLock.Enabled() {
+			if err := c.Watcher.DeployLock.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if c.Watcher.LockTimeout < 0 {
+			errs = append(errs, fmt.Errorf("lock_timeout must not be negative"))
+		}
+		switch c.Watcher.WatchMode {
+		case "", "auto", "inotify", "poll":
+		default:
+			errs = append(errs, fmt.Errorf("invalid watch_mode: %s (must be 'auto', 'inotify' or 'poll')", c.Watcher.WatchMode))
+		}
+		if c.Watcher.WatchMode != "inotify" && c.Watcher.PollInterval <= 0 {
+			errs = append(errs, fmt.Errorf("poll_interval must be positive unless watch_mode is 'inotify'"))
+		}
+		if c.Watcher.StableAlias != "" && !repositoryPattern.MatchString(c.Watcher.StableAlias) {
+			errs = append(errs, fmt.Errorf("invalid stable_alias: %s (expected a lowercase image repository without tag, e.g. \"myapp\")", c.Watcher.StableAlias))
+		}
+		if _, err := DeployPhases(c.Watcher.DeployStrategy); err != nil {
+			errs = append(errs, err)
+		}
+		if _, err := filepath.Match(c.Watcher.TriggerFilePattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid trigger_file_pattern: %s: %w", c.Watcher.TriggerFilePattern, err))
+		}
+		if c.Watcher.ShowLogsAfterDeploy < 0 {
+			errs = append(errs, fmt.Errorf("show_logs_after_deploy must not be negative"))
+		}
+		if c.Watcher.QuarantineKeep < 0 {
+			errs = append(errs, fmt.Errorf("quarantine_keep must not be negative"))
+		}
+		if c.Watcher.QuarantineMaxAge < 0 {
+			errs = append(errs, fmt.Errorf("quarantine_max_age must not be negative"))
+		}
+		if c.Watcher.CleanupRetries < 0 {
+			errs = append(errs, fmt.Errorf("cleanup_retries must not be negative"))
+		}
+		if c.Watcher.KeepImages < 0 {
+			errs = append(errs, fmt.Errorf("keep_images must not be negative"))
+		}
+		for _, action := range c.Watcher.FileActions {
+			if err := action.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, hooks := range []struct {
+			name        string
+			commands    []Command
+			parallelism int
+		}{
+			{"pre_load_commands", c.Watcher.PreLoadCommands, c.Watcher.PreLoadParallelism},
+			{"post_load_commands", c.Watcher.PostLoadCommands, c.Watcher.PostLoadParallelism},
+		} {
+			if hooks.parallelism < 0 {
+				errs = append(errs, fmt.Errorf("%s parallelism must not be negative", hooks.name))
+			}
+			for _, cmd := range hooks.commands {
+				if err := cmd.validate(); err != nil {
+					errs = append(errs, fmt.Errorf("invalid %s entry: %w", hooks.name, err))
+				}
+			}
+		}
+		for _, cmd := range c.Watcher.PreLoadCommands {
+			if cmd.InContainer {
+				errs = append(errs, fmt.Errorf("pre_load_commands cannot run in_container, the new container is not started yet: %s", cmd))
+			}
+		}
+		switch c.Watcher.UntaggedImages {
+		case "", "tag", "id":
+		default:
+			errs = append(errs, fmt.Errorf("invalid untagged_images: %s (must be 'tag' or 'id')", c.Watcher.UntaggedImages))
+		}
+		if pattern := c.Watcher.MetadataFilenameRegex; pattern != "" {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("invalid metadata_filename_regex: %w", err))
+			}
+		}
+		if pattern := c.Watcher.ImageNameFromFilenameRegex; pattern != "" {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid image_name_from_filename_regex: %w", err))
+			} else if re.SubexpIndex("repo") < 0 {
+				errs = append(errs, fmt.Errorf("image_name_from_filename_regex must have a named group \"repo\""))
+			}
+		}
+		if err := validateGPUs(c.Watcher.GPUs); err != nil {
+			errs = append(errs, err)
+		}
+		for _, device := range c.Watcher.Devices {
+			if err := validateDevice(device); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		errs = append(errs, validateSecrets(c.Watcher.Secrets)...)
+		if len(c.Watcher.Secrets) > 0 && c.Watcher.DockerHost != "" && !strings.HasPrefix(c.Watcher.DockerHost, "unix://") {
+			errs = append(errs, fmt.Errorf("secrets cannot be combined with a remote docker_host, the secret files are written on this host"))
+		}
+		if len(c.Watcher.Secrets) > 0 && !filepath.IsAbs(c.Watcher.SecretsDirectory) {
+			errs = append(errs, fmt.Errorf("secrets_directory must be an absolute path"))
+		}
+		if c.Watcher.LabelFile != "" {
+			info, err := os.Stat(c.Watcher.LabelFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("label_file not found: %w", err))
+			} else if !info.Mode().IsRegular() {
+				errs = append(errs, fmt.Errorf("label_file is not a regular file: %s", c.Watcher.LabelFile))
+			}
+		}
+		if c.Watcher.S3.Enabled() {
+			if err := c.Watcher.S3.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+			if c.Watcher.S3PollInterval <= 0 {
+				errs = append(errs, fmt.Errorf("s3_poll_interval must be positive"))
+			}
+		}
+		if c.Watcher.SSHSource.Enabled() {
+			if err := c.Watcher.SSHSource.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+			if c.Watcher.SSHSourcePollInterval <= 0 {
+				errs = append(errs, fmt.Errorf("ssh_source_poll_interval must be positive"))
+			}
+		}
+		if err := validateDockerHost(c.Watcher.DockerHost); err != nil {
+			errs = append(errs, err)
+		}
+		errs = append(errs, c.Watcher.validateProxy()...)
+		if err := c.Watcher.Retry.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if c.Watcher.SettleDelay < 0 {
+			errs = append(errs, fmt.Errorf("settle_delay must not be negative"))
+		}
+		if c.Watcher.StableFileQuiet < 0 {
+			errs = append(errs, fmt.Errorf("stable_file_quiet must not be negative"))
+		}
+		if c.Watcher.StableFileQuiet > 0 && c.Watcher.StableFileTimeout <= c.Watcher.StableFileQuiet {
+			errs = append(errs, fmt.Errorf("stable_file_timeout must be longer than stable_file_quiet"))
+		}
+		if c.Watcher.SmokeTestCommand != "" && c.Watcher.SmokeTestTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("smoke_test_timeout must be positive when smoke_test_command is set"))
+		}
+		if c.Watcher.PreDeployGateCommand != "" && c.Watcher.PreDeployGateTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("pre_deploy_gate_timeout must be positive when pre_deploy_gate_command is set"))
+		}
+		if (c.Watcher.TLSCertFile == "") != (c.Watcher.TLSKeyFile == "") {
+			errs = append(errs, fmt.Errorf("tls_cert_file and tls_key_file must be set together"))
+		}
+		errs = append(errs, validateAuthTokens(c.Watcher.AuthTokens, c.Watcher.AuthToken)...)
+		// The control API deploys and pauses, so only this host may use it
+		// without a token
+		if c.Watcher.ControlListen != "" && !isLoopbackAddress(c.Watcher.ControlListen) && c.Watcher.AuthToken == "" && len(c.Watcher.AuthTokens) == 0 {
+			errs = append(errs, fmt.Errorf("control_listen %s is reachable from other hosts, set auth_token or auth_tokens, or listen on a loopback address or Unix socket", c.Watcher.ControlListen))
+		}
+		if c.Watcher.MaxDeploysPerMinute < 0 {
+			errs = append(errs, fmt.Errorf("max_deploys_per_minute must not be negative"))
+		}
+		if c.Watcher.ReadinessCommand != "" && c.Watcher.ReadinessTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("readiness_timeout must be positive when readiness_command is set"))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
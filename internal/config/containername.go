@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// sampleContainerNameVars are used to check a container_name template
+// when the config is loaded
+var sampleContainerNameVars = map[string]string{
+	"Image":  "app",
+	"Tag":    "latest",
+	"GitSHA": "0123456789ab",
+}
+
+// ContainerNameIsTemplate reports whether container_name contains template
+// variables that are rendered per deploy
+func (c *WatcherConfig) ContainerNameIsTemplate() bool {
+	return strings.Contains(c.ContainerName, "{{")
+}
+
+// RenderContainerName renders container_name with the variables of a
+// deploy. Referencing a variable that is not set is an error.
+func (c *WatcherConfig) RenderContainerName(vars map[string]string) (string, error) {
+	tmpl, err := template.New("container_name").Option("missingkey=error").Parse(c.ContainerName)
+	if err != nil {
+		return "", fmt.Errorf("invalid container_name template: %w", err)
+	}
+
+	var name strings.Builder
+	if err := tmpl.Execute(&name, vars); err != nil {
+		return "", fmt.Errorf("failed to render container_name: %w", err)
+	}
+	return name.String(), nil
+}
+
+// ValidateContainerName checks that name is a legal docker container name
+func ValidateContainerName(name string) error {
+	if !dockerNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid container name: %q (must match %s)", name, dockerNamePattern)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DeployLockConfig configures a distributed lock that lets several
+// watchers share a watch directory without deploying a tarball twice
+type DeployLockConfig struct {
+	Backend   string   `json:"backend" yaml:"backend" toml:"backend"`          // "etcd" or "consul"; empty disables the lock
+	Endpoints []string `json:"endpoints" yaml:"endpoints" toml:"endpoints"`    // Base URLs, e.g. "http://127.0.0.1:2379", tried in order
+	KeyPrefix string   `json:"key_prefix" yaml:"key_prefix" toml:"key_prefix"` // Prefix of the per-file lock keys (default: "fws/deploy-lock/")
+	TTL       Duration `json:"ttl" yaml:"ttl" toml:"ttl"`                      // Lock lease, renewed while the deploy runs; a crashed holder's lock expires after it
+	Token     string   `json:"token" yaml:"token" toml:"token"`                // Consul ACL token (optional)
+}
+
+// Enabled reports whether a lock backend is configured
+func (l DeployLockConfig) Enabled() bool {
+	return l.Backend != ""
+}
+
+// Validate checks the lock settings
+func (l DeployLockConfig) Validate() error {
+	switch l.Backend {
+	case "etcd":
+	case "consul":
+		// Consul rejects session TTLs below 10s
+		if time.Duration(l.TTL) < 10*time.Second {
+			return fmt.Errorf("deploy_lock.ttl must be at least 10s with the consul backend")
+		}
+	default:
+		return fmt.Errorf("invalid deploy_lock.backend: %s (must be 'etcd' or 'consul')", l.Backend)
+	}
+	if time.Duration(l.TTL) < time.Second {
+		return fmt.Errorf("deploy_lock.ttl must be at least 1s")
+	}
+	if len(l.Endpoints) == 0 {
+		return fmt.Errorf("deploy_lock.endpoints must list at least one endpoint")
+	}
+	for _, endpoint := range l.Endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid deploy_lock endpoint: %s (expected http(s)://host:port)", endpoint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// validateGPUs checks a docker --gpus value: "all", a positive count or a
+// "device=" list of GPU indexes or UUIDs
+func validateGPUs(gpus string) error {
+	if gpus == "" || gpus == "all" {
+		return nil
+	}
+	if n, err := strconv.Atoi(gpus); err == nil {
+		if n < 1 {
+			return fmt.Errorf("invalid gpus: %s (count must be positive)", gpus)
+		}
+		return nil
+	}
+	if ids := strings.TrimPrefix(gpus, "device="); ids != gpus {
+		for _, id := range strings.Split(ids, ",") {
+			if id == "" || strings.ContainsAny(id, " \t'\"") {
+				return fmt.Errorf("invalid gpus: %s (bad device %q)", gpus, id)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid gpus: %s (must be 'all', a count or 'device=<ids>')", gpus)
+}
+
+// validateDevice checks a docker --device value of the form
+// /dev/host[:/dev/container][:permissions]
+func validateDevice(device string) error {
+	parts := strings.Split(device, ":")
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid device: %s (expected host[:container][:permissions])", device)
+	}
+
+	// A trailing part that is not a path holds the permissions
+	if last := parts[len(parts)-1]; len(parts) > 1 && !strings.HasPrefix(last, "/") {
+		if last == "" || strings.Trim(last, "rwm") != "" {
+			return fmt.Errorf("invalid device: %s (permissions must be a combination of r, w and m)", device)
+		}
+		parts = parts[:len(parts)-1]
+	}
+
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid device: %s (expected host[:container][:permissions])", device)
+	}
+	for _, path := range parts {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid device: %s (paths must be absolute)", device)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandPaths expands environment variables and a leading ~ in the path
+// settings. remote_upload_path is a path on the remote host, so ~ stands
+// for the remote user's home there, which remote commands start in.
+func expandPaths(config *Config) error {
+	paths := []struct {
+		name   string
+		value  *string
+		remote bool
+	}{
+		{"remote_key_path", &config.Uploader.RemoteKeyPath, false},
+		{"docker_build_path", &config.Uploader.DockerBuildPath, false},
+		{"tarball_path", &config.Uploader.TarballPath, false},
+		{"remote_upload_path", &config.Uploader.RemoteUploadPath, true},
+		{"watch_directory", &config.Watcher.WatchDirectory, false},
+	}
+
+	for _, p := range paths {
+		expanded, err := expandEnv(*p.value, config.StrictPathExpansion)
+		if err != nil {
+			return fmt.Errorf("failed to expand %s: %w", p.name, err)
+		}
+		if p.remote {
+			expanded = expandRemoteHome(expanded)
+		} else if expanded, err = expandHome(expanded); err != nil {
+			return fmt.Errorf("failed to expand %s: %w", p.name, err)
+		}
+		*p.value = expanded
+	}
+	return nil
+}
+
+// expandEnv replaces $VAR and ${VAR} with the value of the environment
+// variable. Unset variables expand to nothing, or are an error if strict.
+func expandEnv(path string, strict bool) (string, error) {
+	var unset []string
+	expanded := os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			unset = append(unset, name)
+		}
+		return value
+	})
+	if strict && len(unset) > 0 {
+		return "", fmt.Errorf("environment variable not set: %s", strings.Join(unset, ", "))
+	}
+	return expanded, nil
+}
+
+// expandHome replaces a leading ~ with the home directory of the user
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// expandRemoteHome makes a remote path starting with ~ relative to the
+// remote user's home directory
+func expandRemoteHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	if rel := strings.TrimLeft(path[1:], "/"); rel != "" {
+		return rel
+	}
+	return "."
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Actions a watched file can be mapped to
+const (
+	ActionDeploy       = "deploy"        // Deploy the tarball, or the trigger file with trigger_file_pattern
+	ActionRunScript    = "run_script"    // Execute the file
+	ActionReloadConfig = "reload_config" // Reload the watcher settings from the config file
+)
+
+// FileAction maps file names matching Pattern to an action
+type FileAction struct {
+	Pattern string `json:"pattern" yaml:"pattern" toml:"pattern"` // Glob matched against the file name, e.g. "*.sh"
+	Action  string `json:"action" yaml:"action" toml:"action"`    // One of "deploy", "run_script" or "reload_config"
+}
+
+// Validate checks the pattern and the action
+func (a FileAction) Validate() error {
+	if a.Pattern == "" {
+		return fmt.Errorf("file action needs a pattern")
+	}
+	if _, err := filepath.Match(a.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid file action pattern: %s: %w", a.Pattern, err)
+	}
+	switch a.Action {
+	case ActionDeploy, ActionRunScript, ActionReloadConfig:
+		return nil
+	default:
+		return fmt.Errorf("invalid file action for %s: %s (must be 'deploy', 'run_script' or 'reload_config')", a.Pattern, a.Action)
+	}
+}
+
+// Match reports whether the base name of path matches the pattern
+func (a FileAction) Match(path string) bool {
+	matched, _ := filepath.Match(a.Pattern, filepath.Base(path))
+	return matched
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats
+const (
+	FormatJSON = "JSON"
+	FormatYAML = "YAML"
+	FormatTOML = "TOML"
+)
+
+// FileFormat returns the format of a config file from its extension,
+// JSON unless it is .yaml, .yml or .toml
+func FileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// decode reads a config file in the given format into config, using the
+// yaml and toml tags for YAML and TOML. Settings missing from the file keep
+// the values config already has.
+func decode(data []byte, format string, config *Config) error {
+	switch format {
+	case FormatYAML:
+		return yaml.Unmarshal(data, config)
+	case FormatTOML:
+		_, err := toml.Decode(string(data), config)
+		return err
+	default:
+		return json.Unmarshal(data, config)
+	}
+}
+
+// fromJSON converts a JSON config to YAML or TOML. Configs are encoded as
+// JSON first, which keeps the order of the keys.
+func fromJSON(data []byte, format string) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		// JSON is YAML, decoding it into a node keeps the order of the keys
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		blockStyle(&doc)
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&doc); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatTOML:
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(integers(doc)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return data, nil
+	}
+}
+
+// blockStyle drops the flow style and quoting a node decoded from JSON
+// has, so it is written as regular YAML. Empty collections stay inline.
+func blockStyle(node *yaml.Node) {
+	if len(node.Content) > 0 || node.Kind == yaml.ScalarNode {
+		node.Style = 0
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// integers turns the whole numbers JSON decodes as float64 back into
+// integers, which TOML keeps apart from floats
+func integers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = integers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = integers(item)
+		}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	}
+	return value
+}
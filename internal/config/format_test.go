@@ -0,0 +1,190 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Unquoted YAML scalars that look like numbers, booleans or dates stay
+// strings as written
+func TestLoadYAMLNumericLookingStrings(t *testing.T) {
+	for _, tag := range []string{"1.10", "2024", "010", "1e3", "0x1F", "true", "2024-01-01"} {
+		path := writeConfig(t, "config.yaml", "uploader:\n  image_name: myapp\n  image_tag: "+tag+"\nwatcher:\n  container_name: "+tag+"\n")
+		cfg, err := LoadConfig(path, "")
+		if err != nil {
+			t.Fatalf("image_tag: %s: %v", tag, err)
+		}
+		if cfg.Uploader.ImageTag != tag {
+			t.Errorf("image_tag: %s read as %q", tag, cfg.Uploader.ImageTag)
+		}
+		if cfg.Watcher.ContainerName != tag {
+			t.Errorf("container_name: %s read as %q", tag, cfg.Watcher.ContainerName)
+		}
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+  "uploader": {"image_name": "myapp", "image_tag": "1.10"},
+  "watcher": {
+    "settle_delay": "5s",
+    "pre_load_commands": ["echo hello", {"cmd": "docker network create app", "once": true}]
+  },
+  "profiles": {"prod": {"uploader": {"image_tag": "2024"}, "watcher": {"container_name": "app-prod"}}}
+}`,
+		"config.yaml": `uploader:
+  image_name: myapp
+  image_tag: 1.10
+watcher:
+  settle_delay: 5s
+  pre_load_commands:
+    - echo hello
+    - cmd: docker network create app
+      once: true
+profiles:
+  prod:
+    uploader:
+      image_tag: 2024
+    watcher:
+      container_name: app-prod
+`,
+		"config.toml": `[uploader]
+image_name = "myapp"
+image_tag = "1.10"
+
+[watcher]
+settle_delay = "5s"
+pre_load_commands = ["echo hello", { cmd = "docker network create app", once = true }]
+
+[profiles.prod.uploader]
+image_tag = "2024"
+
+[profiles.prod.watcher]
+container_name = "app-prod"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, name, content)
+
+			cfg, err := LoadConfig(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Uploader.ImageName != "myapp" || cfg.Uploader.ImageTag != "1.10" {
+				t.Errorf("image = %s:%s, want myapp:1.10", cfg.Uploader.ImageName, cfg.Uploader.ImageTag)
+			}
+			if got := cfg.Watcher.SettleDelay.Duration(); got != 5*time.Second {
+				t.Errorf("settle_delay = %v, want 5s", got)
+			}
+			// Settings missing from the file keep their defaults
+			if cfg.Watcher.RestartPolicy != "unless-stopped" {
+				t.Errorf("restart_policy = %q, want the default", cfg.Watcher.RestartPolicy)
+			}
+			want := []Command{{Cmd: "echo hello"}, {Cmd: "docker network create app", Once: true}}
+			if got := cfg.Watcher.PreLoadCommands; len(got) != 2 || got[0].Cmd != want[0].Cmd || got[1].Cmd != want[1].Cmd || !got[1].Once {
+				t.Errorf("pre_load_commands = %+v, want %+v", got, want)
+			}
+
+			prod, err := LoadConfig(path, "prod")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prod.Uploader.ImageTag != "2024" || prod.Watcher.ContainerName != "app-prod" {
+				t.Errorf("profile prod gave image_tag %q and container_name %q", prod.Uploader.ImageTag, prod.Watcher.ContainerName)
+			}
+			// The profile only overrides the keys it sets
+			if prod.Uploader.ImageName != "myapp" || prod.Watcher.SettleDelay.Duration() != 5*time.Second {
+				t.Errorf("profile prod reset settings it does not set: %+v", prod.Uploader)
+			}
+		})
+	}
+}
+
+func TestLoadReportsFormat(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "uploader:\n  image_tag: [1, 2]\n")
+	_, err := LoadConfig(path, "")
+	if err == nil || !strings.Contains(err.Error(), "YAML config file") || strings.Contains(err.Error(), "json") {
+		t.Errorf("error = %v, want a YAML decode error", err)
+	}
+}
+
+func TestSaveConfigRoundTrip(t *testing.T) {
+	for _, name := range []string{"config.json", "config.yaml", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := LoadConfig("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.Uploader.ImageName = "myapp"
+			cfg.Uploader.ImageTag = "1.10"
+			cfg.Watcher.ContainerName = "2024"
+			cfg.Watcher.PreLoadCommands = []Command{{Cmd: "echo hello"}, {Cmd: "true", SuccessCodes: []int{0, 1}}}
+
+			path := filepath.Join(t.TempDir(), name)
+			if err := cfg.SaveConfig(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadConfig(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Uploader.ImageTag != "1.10" || loaded.Watcher.ContainerName != "2024" {
+				t.Errorf("read back image_tag %q and container_name %q", loaded.Uploader.ImageTag, loaded.Watcher.ContainerName)
+			}
+			if !reflect.DeepEqual(ShellCommands(loaded.Watcher.PreLoadCommands), ShellCommands(cfg.Watcher.PreLoadCommands)) {
+				t.Errorf("read back pre_load_commands %+v", loaded.Watcher.PreLoadCommands)
+			}
+			if loaded.Watcher.SettleDelay != cfg.Watcher.SettleDelay {
+				t.Errorf("read back settle_delay %v", loaded.Watcher.SettleDelay)
+			}
+		})
+	}
+}
+
+// Every setting has the same key in all three formats
+func TestConfigTagsMatch(t *testing.T) {
+	seen := make(map[reflect.Type]bool)
+	var check func(typ reflect.Type)
+	check = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct || seen[typ] || typ.PkgPath() != reflect.TypeOf(Config{}).PkgPath() {
+			return
+		}
+		seen[typ] = true
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tag := field.Tag.Get("json")
+			if tag == "" {
+				t.Errorf("%s.%s has no json tag", typ.Name(), field.Name)
+			}
+			for _, format := range []string{"yaml", "toml"} {
+				if got := field.Tag.Get(format); got != tag {
+					t.Errorf("%s.%s: %s tag %q, json tag %q", typ.Name(), field.Name, format, got, tag)
+				}
+			}
+			check(field.Type)
+		}
+	}
+	check(reflect.TypeOf(Config{}))
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// GitAuthConfig holds the credentials for cloning git_repo. Both are
+// optional; without them git uses its own configuration.
+type GitAuthConfig struct {
+	SSHKey   string `json:"ssh_key" yaml:"ssh_key" toml:"ssh_key"`       // Private key for ssh:// and git@ URLs
+	TokenEnv string `json:"token_env" yaml:"token_env" toml:"token_env"` // Environment variable holding a token for https:// URLs
+}
+
+// validateGitSource checks the git_repo settings of the uploader
+func (c *UploaderConfig) validateGitSource() []error {
+	if c.GitRepo == "" {
+		if c.GitRef != "" || c.GitAuth != (GitAuthConfig{}) {
+			return []error{fmt.Errorf("git_ref and git_auth require git_repo")}
+		}
+		return nil
+	}
+
+	var errs []error
+	if strings.HasPrefix(c.GitRef, "-") || strings.ContainsAny(c.GitRef, " \t\n") {
+		errs = append(errs, fmt.Errorf("invalid git_ref: %q", c.GitRef))
+	}
+	if c.GitAuth.TokenEnv != "" && !strings.HasPrefix(c.GitRepo, "https://") {
+		errs = append(errs, fmt.Errorf("git_auth.token_env requires an https:// git_repo"))
+	}
+	if filepath.IsAbs(c.DockerBuildPath) || strings.HasPrefix(filepath.Clean(c.DockerBuildPath), "..") {
+		errs = append(errs, fmt.Errorf("docker_build_path must be relative to the repository root when git_repo is set"))
+	}
+	if c.BuildCommand != "" {
+		errs = append(errs, fmt.Errorf("git_repo cannot be combined with build_command, which does not use docker_build_path"))
+	}
+	if c.ImageFromStdin {
+		errs = append(errs, fmt.Errorf("git_repo cannot be combined with image_from_stdin, fws does not build the image"))
+	}
+	if c.WatchSource {
+		errs = append(errs, fmt.Errorf("git_repo cannot be combined with watch_source, there is no local source to watch"))
+	}
+	return errs
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// CheckFilePermissions reports a config file that other users could modify:
+// one that is group or world writable, or owned by someone other than the
+// current user or root. Since hook commands from the config are executed,
+// such a file lets others run arbitrary commands as this process. A config
+// that holds secrets, see HasSecrets, must not be readable by others either.
+func CheckFilePermissions(path string, secrets bool) error {
+	if path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat config file: %w", err)
+	}
+
+	perm := info.Mode().Perm()
+	if perm&0022 != 0 {
+		return fmt.Errorf("config file %s has permissions %#o and is writable by other users; run 'chmod go-w %s'",
+			path, perm, path)
+	}
+	if secrets && perm&0044 != 0 {
+		return fmt.Errorf("config file %s has permissions %#o and its passwords or tokens are readable by other users; run 'chmod go-rw %s'",
+			path, perm, path)
+	}
+
+	if uid, ok := fileOwner(info); ok && uid != 0 && uid != os.Getuid() {
+		return fmt.Errorf("config file %s is owned by uid %d, not by the current user or root", path, uid)
+	}
+
+	return nil
+}
+
+// HasSecrets reports whether the config holds a password, passphrase or
+// token, in its settings or in any of its profiles
+func (c *Config) HasSecrets() bool {
+	if c.Uploader.RemotePassword != "" || c.Uploader.RemoteKeyPassphrase != "" ||
+		c.Watcher.AuthToken != "" || len(c.Watcher.AuthTokens) > 0 || c.Watcher.DeployLock.Token != "" {
+		return true
+	}
+	for _, profile := range c.Profiles {
+		var overrides Config
+		if profile.decode(&overrides) == nil && overrides.HasSecrets() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckFilePermissionsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"uploader": {"remote_password": "secret"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile is subject to the umask
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.HasSecrets() {
+		t.Fatal("remote_password not counted as a secret")
+	}
+	if err := CheckFilePermissions(path, false); err != nil {
+		t.Errorf("readable config without secrets rejected: %v", err)
+	}
+	if err := CheckFilePermissions(path, true); err == nil {
+		t.Error("readable config with secrets accepted")
+	}
+
+	// Saving restricts the existing file
+	if err := cfg.SaveConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("saved config with secrets has permissions %#o, want 0600", perm)
+	}
+	if err := CheckFilePermissions(path, true); err != nil {
+		t.Errorf("saved config rejected: %v", err)
+	}
+}
+
+func TestHasSecretsInProfiles(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"profiles": {"prod": {"watcher": {"auth_token": "secret"}}}}`,
+		"config.yaml": "profiles:\n  prod:\n    watcher:\n      auth_token: secret\n",
+		"config.toml": "[profiles.prod.watcher]\nauth_token = \"secret\"\n",
+	}
+	for name, content := range files {
+		cfg, err := LoadConfig(writeConfig(t, name, content), "")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !cfg.HasSecrets() {
+			t.Errorf("%s: token in a profile not counted as a secret", name)
+		}
+	}
+
+	cfg, err := LoadConfig("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HasSecrets() {
+		t.Error("default config counted as holding secrets")
+	}
+}
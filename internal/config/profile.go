@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds the settings a profile overrides. It is kept as written in
+// the config file and only decoded when applied, so that it changes just
+// the keys it sets.
+type Profile struct {
+	json json.RawMessage
+	yaml *yaml.Node
+	toml map[string]interface{}
+}
+
+// UnmarshalJSON keeps the profile of a JSON config
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	*p = Profile{json: append(json.RawMessage(nil), data...)}
+	return nil
+}
+
+// UnmarshalYAML keeps the profile of a YAML config
+func (p *Profile) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: profile must be a mapping of settings", value.Line)
+	}
+	*p = Profile{yaml: value}
+	return nil
+}
+
+// UnmarshalTOML keeps the profile of a TOML config
+func (p *Profile) UnmarshalTOML(value interface{}) error {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("profile must be a table of settings")
+	}
+	*p = Profile{toml: table}
+	return nil
+}
+
+// MarshalJSON writes the profile as an object, whatever format it was read
+// from
+func (p Profile) MarshalJSON() ([]byte, error) {
+	switch {
+	case p.yaml != nil:
+		var value map[string]interface{}
+		if err := p.yaml.Decode(&value); err != nil {
+			return nil, err
+		}
+		return json.Marshal(value)
+	case p.toml != nil:
+		return json.Marshal(p.toml)
+	case p.json != nil:
+		return p.json, nil
+	default:
+		return []byte("{}"), nil
+	}
+}
+
+// decode overrides the settings of config with those of the profile, in
+// the format it was read in
+func (p Profile) decode(config *Config) error {
+	switch {
+	case p.yaml != nil:
+		return p.yaml.Decode(config)
+	case p.toml != nil:
+		// A table can only be decoded from TOML text
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(p.toml); err != nil {
+			return err
+		}
+		_, err := toml.Decode(buf.String(), config)
+		return err
+	case p.json != nil:
+		return json.Unmarshal(p.json, config)
+	default:
+		return nil
+	}
+}
+
+// applyProfile overrides the settings of config with those of the named
+// profile. Only the keys present in the profile are changed: nested
+// objects are merged, lists and other values are replaced.
+func applyProfile(config *Config, name string) error {
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %q not found in config (available: %s)", name, profileNames(config.Profiles))
+	}
+
+	if err := profile.decode(config); err != nil {
+		return fmt.Errorf("failed to decode profile %q: %w", name, err)
+	}
+	config.Profile = name
+	return nil
+}
+
+// profileNames lists the profiles of a config for error messages
+func profileNames(profiles map[string]Profile) string {
+	if len(profiles) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ProxyPortBinding returns the docker -p value publishing the proxy's
+// backend port on an ephemeral loopback port, or "" without the proxy
+func (c *WatcherConfig) ProxyPortBinding() string {
+	if c.ProxyListen == "" {
+		return ""
+	}
+	return fmt.Sprintf("127.0.0.1::%d", c.ProxyBackendPort)
+}
+
+// validateProxy checks the built-in proxy settings and the blue-green
+// strategy that depends on them
+func (c *WatcherConfig) validateProxy() []error {
+	if c.ProxyListen == "" {
+		var errs []error
+		if c.ProxyBackendPort != 0 {
+			errs = append(errs, fmt.Errorf("proxy_backend_port requires proxy_listen"))
+		}
+		if c.DeployStrategy == BlueGreen {
+			errs = append(errs, fmt.Errorf("deploy_strategy %s requires proxy_listen, the proxy switches traffic to the new container", BlueGreen))
+		}
+		return errs
+	}
+
+	var errs []error
+	_, port, err := net.SplitHostPort(c.ProxyListen)
+	if n, perr := strconv.Atoi(port); err != nil || perr != nil || n < 1 || n > 65535 {
+		errs = append(errs, fmt.Errorf("invalid proxy_listen: %s (expected [host]:port, e.g. \":80\")", c.ProxyListen))
+	}
+	if c.ProxyBackendPort < 1 || c.ProxyBackendPort > 65535 {
+		errs = append(errs, fmt.Errorf("proxy_backend_port must be between 1 and 65535 when proxy_listen is set"))
+	}
+	if c.DockerHost != "" && !strings.HasPrefix(c.DockerHost, "unix://") {
+		errs = append(errs, fmt.Errorf("proxy_listen cannot be combined with a remote docker_host, the proxy forwards to ports on the watcher host"))
+	}
+	if c.ContainerNameIsTemplate() {
+		errs = append(errs, fmt.Errorf("proxy_listen cannot be combined with a templated container_name, the proxy forwards to a single container"))
+	}
+	if c.DeployStrategy == BlueGreen {
+		// Both containers run at once, so neither may claim a fixed host port
+		for _, spec := range c.ContainerPort {
+			if binding, err := parsePortBinding(spec); err == nil && binding.first != 0 {
+				errs = append(errs, fmt.Errorf("container_ports entry %s publishes a fixed host port, which the old and new container cannot share with deploy_strategy %s", spec, BlueGreen))
+			}
+		}
+	}
+	return errs
+}
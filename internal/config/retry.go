@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetryConfig controls retries of steps that can fail transiently
+type RetryConfig struct {
+	Attempts             int      `json:"attempts" yaml:"attempts" toml:"attempts"`                                           // Total attempts per step (1 disables retries)
+	Delay                Duration `json:"delay" yaml:"delay" toml:"delay"`                                                    // Wait between attempts
+	RetryablePatterns    []string `json:"retryable_patterns" yaml:"retryable_patterns" toml:"retryable_patterns"`             // Extra output fragments of transient failures
+	NonRetryablePatterns []string `json:"non_retryable_patterns" yaml:"non_retryable_patterns" toml:"non_retryable_patterns"` // Extra output fragments of failures that should fail fast
+}
+
+// DefaultRetry returns the retry settings used when none are configured
+func DefaultRetry() RetryConfig {
+	return RetryConfig{
+		Attempts: 1,
+		Delay:    Duration(5 * time.Second),
+	}
+}
+
+// Validate checks the retry settings
+func (r RetryConfig) Validate() error {
+	if r.Attempts < 1 {
+		return fmt.Errorf("retry.attempts must be at least 1")
+	}
+	if r.Delay < 0 {
+		return fmt.Errorf("retry.delay must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dockerNamePattern matches valid container and named volume names
+var dockerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// repositoryPattern matches image repositories without tag or digest,
+// optionally with a registry host and port
+var repositoryPattern = regexp.MustCompile(`^([a-zA-Z0-9.-]+(:[0-9]+)?/)?[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+
+// imageReferencePattern matches docker image references,
+// [registry[:port]/]repository[:tag][@digest], and image IDs
+var imageReferencePattern = regexp.MustCompile(`^(` +
+	`(([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(\.([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(:[0-9]+)?/)?` +
+	`[a-z0-9]+(([._]|__|-*)[a-z0-9]+)*(/[a-z0-9]+(([._]|__|-*)[a-z0-9]+)*)*` +
+	`(:[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127})?` +
+	`(@[A-Za-z][A-Za-z0-9]*([-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,})?` +
+	`|sha256:[0-9a-f]{64})$`)
+
+// envKeyPattern matches environment variable names docker accepts unquoted
+var envKeyPattern = regexp.MustCompile(`^[^=\s]+$`)
+
+// mountOptions are the options docker accepts after a volume's destination
+var mountOptions = map[string]bool{
+	"ro": true, "rw": true, "z": true, "Z": true, "nocopy": true,
+	"shared": true, "rshared": true, "slave": true, "rslave": true, "private": true, "rprivate": true,
+	"consistent": true, "cached": true, "delegated": true,
+}
+
+// RunOptions are the docker run options of the managed container
+type RunOptions struct {
+	Name          string
+	RestartPolicy string
+	PullPolicy    string
+	Ports         []string
+	Env           []string
+	Volumes       []string
+	Labels        []string
+	LabelFile     string
+	Image         string // Not checked when empty
+}
+
+// RunOptions returns the docker run options set in the configuration. The
+// name is container_name as configured, even if it is a template.
+func (c *WatcherConfig) RunOptions() RunOptions {
+	return RunOptions{
+		Name:          c.ContainerName,
+		RestartPolicy: c.RestartPolicy,
+		PullPolicy:    c.PullPolicy,
+		Ports:         c.ContainerPort,
+		Env:           c.ContainerEnv,
+		Volumes:       c.ContainerVolumes,
+		Labels:        c.Labels,
+		LabelFile:     c.LabelFile,
+	}
+}
+
+// Validate reports the problems docker run would reject, such as duplicate
+// port bindings or malformed volumes, so they surface before the running
+// container is stopped. All problems found are returned together.
+func (o RunOptions) Validate() error {
+	var errs []error
+
+	if err := ValidateContainerName(o.Name); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateRestartPolicy(o.RestartPolicy); err != nil {
+		errs = append(errs, err)
+	}
+	switch o.PullPolicy {
+	case "", "always", "missing", "never":
+	default:
+		errs = append(errs, fmt.Errorf("invalid pull policy: %s (must be 'always', 'missing' or 'never')", o.PullPolicy))
+	}
+
+	var bindings []portBinding
+	for _, port := range o.Ports {
+		binding, err := parsePortBinding(port)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, other := range bindings {
+			if binding.conflicts(other) {
+				errs = append(errs, fmt.Errorf("duplicate port binding: %s conflicts with %s", port, other.spec))
+				break
+			}
+		}
+		bindings = append(bindings, binding)
+	}
+
+	for _, env := range o.Env {
+		key, _, _ := strings.Cut(env, "=")
+		if !envKeyPattern.MatchString(key) {
+			errs = append(errs, fmt.Errorf("invalid environment variable: %q (expected KEY=VALUE)", env))
+		}
+	}
+
+	for _, label := range o.Labels {
+		key, _, _ := strings.Cut(label, "=")
+		if strings.TrimSpace(key) == "" || strings.ContainsAny(key, " \t\n") {
+			errs = append(errs, fmt.Errorf("invalid label: %q (expected key=value)", label))
+		}
+	}
+
+	destinations := make(map[string]string)
+	for _, volume := range o.Volumes {
+		dest, err := parseVolume(volume)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if other, ok := destinations[dest]; ok {
+			errs = append(errs, fmt.Errorf("duplicate volume destination %s: %s and %s", dest, other, volume))
+			continue
+		}
+		destinations[dest] = volume
+	}
+
+	if o.Image != "" {
+		if err := ValidateImageReference(o.Image); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateImageReference checks that image is a docker image reference,
+// such as registry.example.com:5000/app:v2, or an image ID
+func ValidateImageReference(image string) error {
+	if !imageReferencePattern.MatchString(image) {
+		return fmt.Errorf("invalid image: %q (expected [registry/]repository[:tag][@digest])", image)
+	}
+	return nil
+}
+
+// validateRestartPolicy checks a docker --restart value
+func validateRestartPolicy(policy string) error {
+	switch policy {
+	case "", "no", "always", "unless-stopped", "on-failure":
+		return nil
+	}
+	if retries, ok := strings.CutPrefix(policy, "on-failure:"); ok {
+		if n, err := strconv.Atoi(retries); err == nil && n >= 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid restart policy: %s (must be 'no', 'always', 'unless-stopped' or 'on-failure[:max-retries]')", policy)
+}
+
+// portBinding is a parsed docker -p value. Only the host side matters for
+// conflicts; bindings without a host port get an ephemeral one.
+type portBinding struct {
+	spec     string
+	ip       string // "" binds all addresses
+	first    int    // Host port range, 0 when unset
+	last     int
+	protocol string
+}
+
+// conflicts reports whether two bindings claim the same host port
+func (b portBinding) conflicts(other portBinding) bool {
+	if b.first == 0 || other.first == 0 || b.protocol != other.protocol {
+		return false
+	}
+	if b.ip != "" && other.ip != "" && b.ip != other.ip {
+		return false
+	}
+	return b.first <= other.last && other.first <= b.last
+}
+
+// parsePortBinding parses [ip:][hostPort:]containerPort[/protocol], where
+// ports may be ranges such as 8000-8010 and IPv6 addresses are bracketed
+func parsePortBinding(spec string) (portBinding, error) {
+	invalid := func(reason string) (portBinding, error) {
+		return portBinding{}, fmt.Errorf("invalid port mapping: %s (%s)", spec, reason)
+	}
+
+	binding := portBinding{spec: spec, protocol: "tcp"}
+	rest := spec
+	if i := strings.LastIndex(rest, "/"); i >= 0 {
+		binding.protocol = rest[i+1:]
+		rest = rest[:i]
+		switch binding.protocol {
+		case "tcp", "udp", "sctp":
+		default:
+			return invalid("protocol must be tcp, udp or sctp")
+		}
+	}
+
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]:")
+		if end < 0 {
+			return invalid("unterminated IPv6 address")
+		}
+		binding.ip = rest[1:end]
+		rest = rest[end+2:]
+	}
+
+	parts := strings.Split(rest, ":")
+	var hostPorts, containerPorts string
+	switch len(parts) {
+	case 1:
+		containerPorts = parts[0]
+	case 2:
+		hostPorts, containerPorts = parts[0], parts[1]
+	case 3:
+		if binding.ip != "" {
+			return invalid("too many fields")
+		}
+		binding.ip, hostPorts, containerPorts = parts[0], parts[1], parts[2]
+		if binding.ip == "" {
+			return invalid("empty host address")
+		}
+	default:
+		return invalid("too many fields")
+	}
+	if binding.ip == "0.0.0.0" || binding.ip == "::" {
+		binding.ip = ""
+	}
+
+	cFirst, cLast, err := parsePortRange(containerPorts)
+	if err != nil || cFirst == 0 {
+		return invalid("bad container port")
+	}
+	if hostPorts != "" {
+		binding.first, binding.last, err = parsePortRange(hostPorts)
+		if err != nil {
+			return invalid("bad host port")
+		}
+		// A host range may be larger than the container range, docker then
+		// picks a free port from it
+		if cLast-cFirst > 0 && binding.last-binding.first != cLast-cFirst {
+			return invalid("host and container port ranges differ in size")
+		}
+	}
+	return binding, nil
+}
+
+// parsePortRange parses a port or a port range such as 8000-8010
+func parsePortRange(s string) (int, int, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	first, err := strconv.Atoi(lo)
+	if err != nil || first < 0 || first > 65535 {
+		return 0, 0, fmt.Errorf("bad port %q", lo)
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	last, err := strconv.Atoi(hi)
+	if err != nil || last < first || last > 65535 {
+		return 0, 0, fmt.Errorf("bad port range %q", s)
+	}
+	return first, last, nil
+}
+
+// parseVolume checks a docker -v value of the form
+// [source:]destination[:options] and returns its destination. The source
+// is an absolute host path or a named volume.
+func parseVolume(volume string) (string, error) {
+	parts := strings.Split(volume, ":")
+	if len(parts) > 3 {
+		return "", fmt.Errorf("invalid volume: %s (expected [source:]destination[:options])", volume)
+	}
+
+	// A trailing part that is not a path holds the options
+	if last := parts[len(parts)-1]; len(parts) > 1 && !strings.HasPrefix(last, "/") {
+		for _, opt := range strings.Split(last, ",") {
+			if !mountOptions[opt] {
+				return "", fmt.Errorf("invalid volume: %s (unknown option %q)", volume, opt)
+			}
+		}
+		parts = parts[:len(parts)-1]
+	}
+
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid volume: %s (expected [source:]destination[:options])", volume)
+	}
+	dest := parts[len(parts)-1]
+	if !strings.HasPrefix(dest, "/") {
+		return "", fmt.Errorf("invalid volume: %s (destination must be an absolute path)", volume)
+	}
+	if len(parts) == 2 {
+		source := parts[0]
+		if !strings.HasPrefix(source, "/") && !dockerNamePattern.MatchString(source) {
+			return "", fmt.Errorf("invalid volume: %s (source must be an absolute path or a volume name)", volume)
+		}
+	}
+	return strings.TrimSuffix(dest, "/"), nil
+}
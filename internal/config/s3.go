@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+)
+
+// S3Config describes an S3 compatible bucket used to deliver tarballs.
+// Credentials are read from the environment (AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN) or the instance/container role.
+type S3Config struct {
+	Endpoint string `json:"endpoint" yaml:"endpoint" toml:"endpoint"` // Custom endpoint such as MinIO (default: AWS)
+	Region   string `json:"region" yaml:"region" toml:"region"`       // Bucket region
+	Bucket   string `json:"bucket" yaml:"bucket" toml:"bucket"`       // Bucket name
+	Prefix   string `json:"prefix" yaml:"prefix" toml:"prefix"`       // Key prefix, e.g. "deploys/myapp/" (optional)
+}
+
+// Enabled reports whether a bucket is configured
+func (s S3Config) Enabled() bool {
+	return s.Bucket != ""
+}
+
+// Validate checks the bucket settings
+func (s S3Config) Validate() error {
+	if s.Bucket == "" {
+		return fmt.Errorf("s3.bucket is required")
+	}
+	if s.Region == "" {
+		return fmt.Errorf("s3.region is required")
+	}
+	return nil
+}
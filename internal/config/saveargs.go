@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateSaveArgs checks the extra docker save arguments. Only flags are
+// accepted, with values attached ("--platform=linux/arm64"), so that no
+// argument can name another image. The output file is chosen by fws.
+func validateSaveArgs(args []string) error {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("invalid save_args entry %q: only flags are allowed, attach values with = (e.g. --platform=linux/arm64)", arg)
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		if name == "--output" || strings.HasPrefix(arg, "-o") {
+			return fmt.Errorf("invalid save_args entry %q: the output file is set by fws", arg)
+		}
+	}
+	return nil
+}
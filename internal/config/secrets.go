@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SecretSpec is a secret written to a file the container reads, instead of
+// an environment variable docker inspect would show
+type SecretSpec struct {
+	Name   string `json:"name" yaml:"name" toml:"name"`       // File name of the secret, e.g. "db_password"
+	Source string `json:"source" yaml:"source" toml:"source"` // "file:<path>" or "env:<VARIABLE>" on the watcher host
+	Target string `json:"target" yaml:"target" toml:"target"` // Path in the container (default: /run/secrets/<name>)
+}
+
+// TargetPath returns the path the secret is mounted at in the container
+func (s SecretSpec) TargetPath() string {
+	if s.Target != "" {
+		return s.Target
+	}
+	return "/run/secrets/" + s.Name
+}
+
+// Validate checks the name, source and target
+func (s SecretSpec) Validate() error {
+	if !dockerNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("invalid secret name: %q (letters, digits, '_', '.' and '-' only)", s.Name)
+	}
+	kind, ref, _ := strings.Cut(s.Source, ":")
+	switch {
+	case kind != "file" && kind != "env":
+		return fmt.Errorf("invalid source of secret %s: %q (must be 'file:<path>' or 'env:<VARIABLE>')", s.Name, s.Source)
+	case ref == "":
+		return fmt.Errorf("source of secret %s names no %s", s.Name, kind)
+	}
+	if target := s.TargetPath(); !path.IsAbs(target) || strings.ContainsAny(target, ",\n") {
+		return fmt.Errorf("invalid target of secret %s: %q (must be an absolute path)", s.Name, target)
+	}
+	return nil
+}
+
+// Value reads the secret from its source
+func (s SecretSpec) Value() ([]byte, error) {
+	kind, ref, _ := strings.Cut(s.Source, ":")
+	if kind == "env" {
+		value, ok := os.LookupEnv(ref)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s of secret %s is not set", ref, s.Name)
+		}
+		return []byte(value), nil
+	}
+	value, err := os.ReadFile(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", s.Name, err)
+	}
+	return value, nil
+}
+
+// validateSecrets checks the secrets and that no two share a name or target
+func validateSecrets(secrets []SecretSpec) []error {
+	var errs []error
+	names := make(map[string]bool)
+	targets := make(map[string]string)
+	for _, secret := range secrets {
+		if err := secret.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if names[secret.Name] {
+			errs = append(errs, fmt.Errorf("duplicate secret name: %s", secret.Name))
+		}
+		names[secret.Name] = true
+		target := path.Clean(secret.TargetPath())
+		if other, ok := targets[target]; ok {
+			errs = append(errs, fmt.Errorf("secrets %s and %s have the same target %s", other, secret.Name, target))
+		}
+		targets[target] = secret.Name
+	}
+	return errs
+}
+
+// setSecretBaseDir makes file sources relative to the config file absolute
+func setSecretBaseDir(secrets []SecretSpec, dir string) {
+	for i, secret := range secrets {
+		if ref, ok := strings.CutPrefix(secret.Source, "file:"); ok && ref != "" && !filepath.IsAbs(ref) {
+			secrets[i].Source = "file:" + filepath.Join(dir, ref)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+)
+
+// SSHSourceConfig describes a directory on another host that tarballs are
+// delivered to, for watchers that do not run on the upload host
+type SSHSourceConfig struct {
+	Host               string `json:"host" yaml:"host" toml:"host"`                                                 // Host holding the directory
+	Port               int    `json:"port" yaml:"port" toml:"port"`                                                 // SSH port (default: 22)
+	User               string `json:"user" yaml:"user" toml:"user"`                                                 // SSH user
+	KeyPath            string `json:"key_path" yaml:"key_path" toml:"key_path"`                                     // Private key, relative to the config file
+	Directory          string `json:"directory" yaml:"directory" toml:"directory"`                                  // Absolute path of the directory to pull from
+	HostKeyFingerprint string `json:"host_key_fingerprint" yaml:"host_key_fingerprint" toml:"host_key_fingerprint"` // Accept only this host key instead of using known_hosts (optional)
+}
+
+// Enabled reports whether a remote directory is configured
+func (s SSHSourceConfig) Enabled() bool {
+	return s.Host != ""
+}
+
+// Validate checks the connection settings
+func (s SSHSourceConfig) Validate() error {
+	switch {
+	case s.User == "":
+		return fmt.Errorf("ssh_source.user is required")
+	case s.KeyPath == "":
+		return fmt.Errorf("ssh_source.key_path is required")
+	case !path.IsAbs(s.Directory):
+		return fmt.Errorf("ssh_source.directory must be an absolute path")
+	case s.Port < 0 || s.Port > 65535:
+		return fmt.Errorf("invalid ssh_source.port: %d", s.Port)
+	}
+	if s.HostKeyFingerprint != "" {
+		if err := validateFingerprint(s.HostKeyFingerprint); err != nil {
+			return fmt.Errorf("ssh_source: %w", err)
+		}
+	}
+	return nil
+}
+
+// DockerEnv returns the environment docker commands need to reach the
+// daemon of docker_host, nothing for the default daemon
+func (c *WatcherConfig) DockerEnv() []string {
+	if c.DockerHost == "" {
+		return nil
+	}
+	return []string{"DOCKER_HOST=" + c.DockerHost}
+}
+
+// validateDockerHost checks docker_host, which must name a daemon socket
+// the docker CLI can connect to
+func validateDockerHost(host string) error {
+	if host == "" {
+		return nil
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return fmt.Errorf("invalid docker_host: %s: %w", host, err)
+	}
+	switch u.Scheme {
+	case "ssh", "tcp":
+		if u.Host == "" {
+			return fmt.Errorf("invalid docker_host: %s (missing host)", host)
+		}
+	case "unix", "npipe":
+	default:
+		return fmt.Errorf("invalid docker_host: %s (expected ssh://, tcp://, unix:// or npipe://)", host)
+	}
+	return nil
+}
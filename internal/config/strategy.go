@@ -0,0 +1,37 @@
+package config
+
+import "fmt"
+
+// Deploy strategies, deciding when the running container is stopped
+// relative to the pre-load commands and the image load
+const (
+	StopAfterLoad  = "stop-after-load"  // pre_load, load, stop (default, shortest downtime)
+	StopBeforeLoad = "stop-before-load" // pre_load, stop, load
+	StopFirst      = "stop-first"       // stop, pre_load, load
+	BlueGreen      = "blue-green"       // pre_load, load, then the old container is stopped once the new one is ready
+)
+
+// deployOrders are the phases up to the start of the new container for
+// each strategy. The new container always starts after the image is loaded,
+// followed by the readiness check, smoke test and post-load commands.
+// With blue-green the old container keeps running next to the new one until
+// the built-in proxy switches to it.
+var deployOrders = map[string][]string{
+	StopAfterLoad:  {"pre_load", "load", "stop"},
+	StopBeforeLoad: {"pre_load", "stop", "load"},
+	StopFirst:      {"stop", "pre_load", "load"},
+	BlueGreen:      {"pre_load", "load"},
+}
+
+// DeployPhases returns the order of the pre_load, load and stop phases for
+// a deploy strategy. An empty strategy is the default.
+func DeployPhases(strategy string) ([]string, error) {
+	if strategy == "" {
+		strategy = StopAfterLoad
+	}
+	phases, ok := deployOrders[strategy]
+	if !ok {
+		return nil, fmt.Errorf("invalid deploy_strategy: %s (must be '%s', '%s', '%s' or '%s')", strategy, StopAfterLoad, StopBeforeLoad, StopFirst, BlueGreen)
+	}
+	return phases, nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily time range in local time, written "HH:MM-HH:MM".
+// A window whose end is before its start wraps past midnight.
+type TimeWindow struct {
+	Start time.Duration // Offset from midnight
+	End   time.Duration
+}
+
+// ParseTimeWindow parses a "HH:MM-HH:MM" window
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("invalid time window: %s (expected HH:MM-HH:MM)", s)
+	}
+
+	var w TimeWindow
+	var err error
+	if w.Start, err = parseClock(strings.TrimSpace(start)); err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid time window: %s: %w", s, err)
+	}
+	if w.End, err = parseClock(strings.TrimSpace(end)); err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid time window: %s: %w", s, err)
+	}
+	if w.Start == w.End {
+		return TimeWindow{}, fmt.Errorf("invalid time window: %s (start and end are equal)", s)
+	}
+	return w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// NextStart returns the next time at or after t when the window opens
+func (w TimeWindow) NextStart(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.Add(w.Start)
+	if next.Before(t) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(w.Start)
+	}
+	return next
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
@@ -0,0 +1,81 @@
+package dlock
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// consul locks keys with Consul sessions. The session is created with the
+// delete behavior, so the key disappears when the session is destroyed or
+// expires.
+type consul struct {
+	*client
+	ttl time.Duration
+}
+
+type consulLock struct {
+	c       *consul
+	session string
+	stop    func()
+}
+
+func (c *consul) TryLock(ctx context.Context, key string) (Lock, error) {
+	holder, _ := os.Hostname()
+	var session struct {
+		ID string `json:"ID"`
+	}
+	body := map[string]string{
+		"Name":      "fws deploy lock " + holder,
+		"TTL":       c.ttl.String(),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	}
+	if err := c.do(ctx, "PUT", "/v1/session/create", body, &session); err != nil {
+		return nil, fmt.Errorf("failed to create consul session: %w", err)
+	}
+
+	var acquired bool
+	path := "/v1/kv/" + escapeKey(key) + "?acquire=" + url.QueryEscape(session.ID)
+	if err := c.do(ctx, "PUT", path, holder, &acquired); err != nil {
+		c.destroy(session.ID)
+		return nil, fmt.Errorf("failed to acquire consul lock: %w", err)
+	}
+	if !acquired {
+		c.destroy(session.ID)
+		return nil, nil
+	}
+
+	l := &consulLock{c: c, session: session.ID}
+	l.stop = keepAlive(c.ttl, func(ctx context.Context) error {
+		return c.do(ctx, "PUT", "/v1/session/renew/"+session.ID, nil, nil)
+	})
+	return l, nil
+}
+
+// destroy ends a session, deleting the keys it holds
+func (c *consul) destroy(session string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return c.do(ctx, "PUT", "/v1/session/destroy/"+session, nil, nil)
+}
+
+func (l *consulLock) Release() error {
+	l.stop()
+	if err := l.c.destroy(l.session); err != nil {
+		return fmt.Errorf("failed to release consul lock: %w", err)
+	}
+	return nil
+}
+
+// escapeKey escapes each segment of a KV key for use in a URL path
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
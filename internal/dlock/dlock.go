@@ -0,0 +1,129 @@
+// Package dlock implements distributed locks on etcd and Consul, used to
+// let only one of several watchers deploy a given tarball
+package dlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Options configures a lock backend
+type Options struct {
+	Backend   string // "etcd" or "consul"
+	Endpoints []string
+	TTL       time.Duration
+	Token     string // Consul ACL token
+}
+
+// Lock is a held lock, kept alive until it is released
+type Lock interface {
+	// Release gives up the lock
+	Release() error
+}
+
+// Locker acquires locks on a backend
+type Locker interface {
+	// TryLock acquires key without waiting. It returns a nil Lock if
+	// another holder has the key.
+	TryLock(ctx context.Context, key string) (Lock, error)
+}
+
+// New creates a Locker for the configured backend
+func New(opts Options) (Locker, error) {
+	c := &client{endpoints: opts.Endpoints, token: opts.Token, http: &http.Client{Timeout: 10 * time.Second}}
+	switch opts.Backend {
+	case "etcd":
+		return &etcd{client: c, ttl: opts.TTL}, nil
+	case "consul":
+		return &consul{client: c, ttl: opts.TTL}, nil
+	default:
+		return nil, fmt.Errorf("unknown lock backend: %s", opts.Backend)
+	}
+}
+
+// client sends JSON requests to the first endpoint that answers
+type client struct {
+	endpoints []string
+	token     string
+	http      *http.Client
+}
+
+// do sends a request with a JSON body (if in is set) and decodes the JSON
+// response into out (if set). Endpoints that cannot be reached are skipped.
+func (c *client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, endpoint := range c.endpoints {
+		req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.token != "" {
+			req.Header.Set("X-Consul-Token", c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+		}
+		if out == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("%s %s: failed to decode response: %w", method, path, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no lock endpoint reachable: %w", errors.Join(errs...))
+}
+
+// keepAlive calls renew every ttl/3 until the returned stop function is
+// called
+func keepAlive(ttl time.Duration, renew func(ctx context.Context) error) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// A failed renewal is retried on the next tick; the lease
+				// only expires after the full TTL
+				renew(ctx)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
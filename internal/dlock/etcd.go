@@ -0,0 +1,79 @@
+package dlock
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+)
+
+// etcd locks keys through the etcd v3 JSON gateway. A lock is a key
+// created in a transaction only if it does not exist, attached to a lease
+// that is kept alive while the lock is held.
+type etcd struct {
+	*client
+	ttl time.Duration
+}
+
+type etcdLock struct {
+	e       *etcd
+	leaseID string
+	stop    func()
+}
+
+func (e *etcd) TryLock(ctx context.Context, key string) (Lock, error) {
+	var lease struct {
+		ID string `json:"ID"`
+	}
+	if err := e.do(ctx, "POST", "/v3/lease/grant", map[string]interface{}{"TTL": int64(e.ttl / time.Second)}, &lease); err != nil {
+		return nil, fmt.Errorf("failed to grant etcd lease: %w", err)
+	}
+
+	holder, _ := os.Hostname()
+	k := base64.StdEncoding.EncodeToString([]byte(key))
+	txn := map[string]interface{}{
+		"compare": []map[string]interface{}{
+			{"key": k, "target": "CREATE", "result": "EQUAL", "create_revision": "0"},
+		},
+		"success": []map[string]interface{}{
+			{"request_put": map[string]interface{}{
+				"key":   k,
+				"value": base64.StdEncoding.EncodeToString([]byte(holder)),
+				"lease": lease.ID,
+			}},
+		},
+	}
+	var result struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := e.do(ctx, "POST", "/v3/kv/txn", txn, &result); err != nil {
+		e.revoke(lease.ID)
+		return nil, fmt.Errorf("failed to acquire etcd lock: %w", err)
+	}
+	if !result.Succeeded {
+		e.revoke(lease.ID)
+		return nil, nil
+	}
+
+	l := &etcdLock{e: e, leaseID: lease.ID}
+	l.stop = keepAlive(e.ttl, func(ctx context.Context) error {
+		return e.do(ctx, "POST", "/v3/lease/keepalive", map[string]string{"ID": lease.ID}, nil)
+	})
+	return l, nil
+}
+
+// revoke ends a lease, deleting the keys attached to it
+func (e *etcd) revoke(leaseID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return e.do(ctx, "POST", "/v3/lease/revoke", map[string]string{"ID": leaseID}, nil)
+}
+
+func (l *etcdLock) Release() error {
+	l.stop()
+	if err := l.e.revoke(l.leaseID); err != nil {
+		return fmt.Errorf("failed to release etcd lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package imagetar
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BaseRefName is the first entry of a tarball whose base image layers were
+// left out. docker load ignores it.
+const BaseRefName = "fws-base.json"
+
+// BaseRef names the base image tarball a tarball depends on
+type BaseRef struct {
+	Tarball string `json:"tarball"`  // File name of the base image tarball
+	ImageID string `json:"image_id"` // ID of the base image, e.g. "sha256:..."
+}
+
+// layerDigest returns the content digest of a layer entry. OCI layout blobs
+// are named by it, legacy layer.tar entries are hashed.
+func layerDigest(hdr *tar.Header, r io.Reader) (string, error) {
+	if digest, ok := strings.CutPrefix(hdr.Name, "blobs/sha256/"); ok {
+		return digest, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", hdr.Name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// StripBase copies the tarball at src to dst, leaving out the layers whose
+// diff IDs (hex sha256 of the uncompressed layer) are in diffIDs and
+// recording ref in a leading entry. docker load skips layers it already
+// has, so the result loads once the base image is present. It returns the
+// number and size of the layers left out.
+func StripBase(src, dst string, diffIDs map[string]bool, ref BaseRef) (int, int64, error) {
+	// Find the base layers first, hashing needs a pass of its own
+	skip := make(map[string]bool)
+	var stripped int64
+	err := eachEntry(src, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag != tar.TypeReg || !(strings.HasSuffix(hdr.Name, "/layer.tar") || strings.HasPrefix(hdr.Name, "blobs/sha256/")) {
+			return nil
+		}
+		digest, err := layerDigest(hdr, r)
+		if err != nil {
+			return err
+		}
+		if diffIDs[digest] {
+			skip[hdr.Name] = true
+			stripped += hdr.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create tarball: %w", err)
+	}
+	defer out.Close()
+
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to encode base reference: %w", err)
+	}
+	tw := tar.NewWriter(out)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     BaseRefName,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return 0, 0, fmt.Errorf("failed to write base reference: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return 0, 0, fmt.Errorf("failed to write base reference: %w", err)
+	}
+
+	err = eachEntry(src, func(hdr *tar.Header, r io.Reader) error {
+		if skip[hdr.Name] {
+			return nil
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+		if _, err := io.Copy(tw, r); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to finish tarball: %w", err)
+	}
+	return len(skip), stripped, out.Close()
+}
+
+// ReadBaseRef returns the base image reference of a tarball, or nil if it
+// does not depend on one. Compressed tarballs are read through.
+func ReadBaseRef(path string) (*BaseRef, error) {
+	file, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != BaseRefName {
+		return nil, nil
+	}
+
+	var ref BaseRef
+	if err := json.NewDecoder(tr).Decode(&ref); err != nil {
+		return nil, fmt.Errorf("failed to decode base reference: %w", err)
+	}
+	return &ref, nil
+}
+
+// eachEntry calls fn with every entry of the tarball at path
+func eachEntry(path string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
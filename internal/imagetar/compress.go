@@ -0,0 +1,141 @@
+package imagetar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats of tarballs, as named by the compression setting
+const (
+	Zstd = "zstd"
+	Gzip = "gzip"
+)
+
+// CompressionExt returns the extension appended to the name of tarballs
+// compressed with format, or "" for uncompressed ones
+func CompressionExt(format string) string {
+	switch format {
+	case Zstd:
+		return ZstdExt
+	case Gzip:
+		return GzipExt
+	default:
+		return ""
+	}
+}
+
+// TrimCompressionExt removes the extension of a compressed tarball from
+// name, so "app.tar.gz" and "app.tar.zst" become "app.tar"
+func TrimCompressionExt(name string) string {
+	for _, ext := range []string{ZstdExt, GzipExt} {
+		if trimmed, ok := strings.CutSuffix(name, ext); ok {
+			return trimmed
+		}
+	}
+	return name
+}
+
+// Compress writes a copy of the tarball src compressed with format to dst
+func Compress(src, dst, format string) error {
+	switch format {
+	case Zstd:
+		return CompressZstd(src, dst)
+	case Gzip:
+		return CompressGzip(src, dst)
+	default:
+		return fmt.Errorf("unknown compression: %s", format)
+	}
+}
+
+// detectCompression returns the compression format of a file starting
+// with magic, or "" if it is not compressed
+func detectCompression(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		return Zstd
+	case bytes.HasPrefix(magic, gzipMagic):
+		return Gzip
+	default:
+		return ""
+	}
+}
+
+// DetectCompression returns the compression format of the file at path,
+// judging by its magic bytes rather than its name, or "" if it is not
+// compressed
+func DetectCompression(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(zstdMagic))
+	n, _ := file.ReadAt(magic, 0)
+	return detectCompression(magic[:n]), nil
+}
+
+// Open opens a tarball for reading, decompressing it on the fly if it is
+// zstd or gzip compressed. Uncompressed tarballs are returned as the file
+// itself, so the tar reader can still seek over entries.
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tarball: %w", err)
+	}
+
+	magic := make([]byte, len(zstdMagic))
+	n, _ := file.ReadAt(magic, 0)
+	switch format := detectCompression(magic[:n]); format {
+	case Zstd:
+		dec, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		return &decompressReader{format: format, r: dec, close: dec.Close, file: file}, nil
+	case Gzip:
+		dec, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("gzip tarball is corrupt: %w", err)
+		}
+		return &decompressReader{format: format, r: dec, close: func() { dec.Close() }, file: file}, nil
+	default:
+		return file, nil
+	}
+}
+
+// decompressReader decompresses a compressed tarball, reporting decoder
+// failures as a corrupt or truncated file instead of the decoder's terse
+// errors
+type decompressReader struct {
+	format string
+	r      io.Reader
+	close  func()
+	file   *os.File
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("%s tarball is truncated: %w", r.format, err)
+		} else {
+			err = fmt.Errorf("%s tarball is corrupt: %w", r.format, err)
+		}
+	}
+	return n, err
+}
+
+func (r *decompressReader) Close() error {
+	r.close()
+	return r.file.Close()
+}
@@ -0,0 +1,40 @@
+package imagetar
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+// GzipExt is appended to the name of gzip compressed tarballs
+const GzipExt = ".gz"
+
+// gzipMagic starts every gzip member
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// CompressGzip writes a gzip compressed copy of the tarball src to dst
+func CompressGzip(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create compressed tarball: %w", err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		return fmt.Errorf("failed to compress tarball: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress tarball: %w", err)
+	}
+	return out.Close()
+}
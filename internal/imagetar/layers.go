@@ -0,0 +1,268 @@
+package imagetar
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LayerIndexName is the first entry of a slim tarball. It lists the layer
+// entries that were left out because they are shipped as blobs.
+const LayerIndexName = "fws-layers.json"
+
+// minLayerSize is the smallest entry worth shipping as a separate blob
+const minLayerSize = 1 << 20
+
+// LayerIndex describes the layers removed from a slim tarball
+type LayerIndex struct {
+	Layers []LayerRef `json:"layers"`
+}
+
+// LayerRef is a tar entry stored in the blob directory instead of the tarball
+type LayerRef struct {
+	Name   string `json:"name"`   // Entry name inside the original tarball
+	Digest string `json:"digest"` // Hex encoded sha256 of the entry content
+	Size   int64  `json:"size"`
+	Mode   int64  `json:"mode"`
+}
+
+// isLayerEntry reports whether a tar entry holds layer data that should be
+// deduplicated. Both the legacy docker save layout (<id>/layer.tar) and the
+// OCI layout (blobs/sha256/<digest>) are recognised.
+func isLayerEntry(hdr *tar.Header) bool {
+	if hdr.Typeflag != tar.TypeReg || hdr.Size < minLayerSize {
+		return false
+	}
+	return strings.HasSuffix(hdr.Name, "/layer.tar") || strings.HasPrefix(hdr.Name, "blobs/sha256/")
+}
+
+// ScanLayers reads an image tarball and returns its layer entries with
+// their content digests
+func ScanLayers(path string) ([]LayerRef, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	var layers []LayerRef
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if !isLayerEntry(hdr) {
+			continue
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", hdr.Name, err)
+		}
+		layers = append(layers, LayerRef{
+			Name:   hdr.Name,
+			Digest: hex.EncodeToString(h.Sum(nil)),
+			Size:   hdr.Size,
+			Mode:   hdr.Mode,
+		})
+	}
+
+	return layers, nil
+}
+
+// EachLayer calls fn with the content of every layer entry whose name is
+// in names
+func EachLayer(path string, names map[string]bool, fn func(hdr *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if !names[hdr.Name] {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// WriteSlim copies the tarball at src to dst, leaving out the given layers
+// and recording them in a leading layer index
+func WriteSlim(src, dst string, layers []LayerRef) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create slim tarball: %w", err)
+	}
+	defer out.Close()
+
+	skip := make(map[string]bool, len(layers))
+	for _, layer := range layers {
+		skip[layer.Name] = true
+	}
+
+	index, err := json.Marshal(LayerIndex{Layers: layers})
+	if err != nil {
+		return fmt.Errorf("failed to encode layer index: %w", err)
+	}
+
+	tw := tar.NewWriter(out)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     LayerIndexName,
+		Mode:     0644,
+		Size:     int64(len(index)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return fmt.Errorf("failed to write layer index: %w", err)
+	}
+	if _, err := tw.Write(index); err != nil {
+		return fmt.Errorf("failed to write layer index: %w", err)
+	}
+
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if skip[hdr.Name] {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish slim tarball: %w", err)
+	}
+	return out.Close()
+}
+
+// ReadLayerIndex returns the layer index of a slim tarball, or nil if the
+// tarball is a regular image archive
+func ReadLayerIndex(path string) (*LayerIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != LayerIndexName {
+		return nil, nil
+	}
+
+	var index LayerIndex
+	if err := json.NewDecoder(tr).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode layer index: %w", err)
+	}
+	return &index, nil
+}
+
+// Reconstruct writes the full image archive for a slim tarball to w,
+// appending the layers from blobDir. Each blob is verified against its
+// digest while it is copied.
+func Reconstruct(slimPath, blobDir string, w io.Writer) error {
+	file, err := os.Open(slimPath)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	tw := tar.NewWriter(w)
+
+	var index LayerIndex
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tarball: %w", err)
+		}
+
+		if hdr.Name == LayerIndexName {
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				return fmt.Errorf("failed to decode layer index: %w", err)
+			}
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+
+	for _, layer := range index.Layers {
+		if err := appendBlob(tw, blobDir, layer); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func appendBlob(tw *tar.Writer, blobDir string, layer LayerRef) error {
+	blob, err := os.Open(filepath.Join(blobDir, layer.Digest))
+	if err != nil {
+		return fmt.Errorf("layer blob sha256:%s is missing from %s: %w", layer.Digest, blobDir, err)
+	}
+	defer blob.Close()
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     layer.Name,
+		Mode:     layer.Mode,
+		Size:     layer.Size,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(tw, io.TeeReader(blob, h))
+	if err != nil {
+		return fmt.Errorf("failed to copy layer blob sha256:%s: %w", layer.Digest, err)
+	}
+	if n != layer.Size || hex.EncodeToString(h.Sum(nil)) != layer.Digest {
+		return fmt.Errorf("layer blob sha256:%s is corrupt", layer.Digest)
+	}
+	return nil
+}
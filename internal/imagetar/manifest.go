@@ -0,0 +1,186 @@
+package imagetar
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// manifestName is the image list written by docker save
+const manifestName = "manifest.json"
+
+// maxMetadataSize bounds the entries buffered while looking for image
+// configs, so layer data is never held in memory
+const maxMetadataSize = 1 << 20
+
+// ManifestEntry is one image in a docker save manifest.json
+type ManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// ImageInfo describes an image contained in a tarball
+type ImageInfo struct {
+	RepoTags     []string
+	OS           string
+	Architecture string
+	Variant      string
+	DiffIDs      []string // Layer diff IDs from the image config, bottom layer first
+}
+
+// Platform returns the image platform in os/arch[/variant] form
+func (i ImageInfo) Platform() string {
+	platform := i.OS + "/" + i.Architecture
+	if i.Variant != "" {
+		platform += "/" + i.Variant
+	}
+	return platform
+}
+
+// ReadRepoTags returns the repo tags of the images in a docker save
+// tarball. It stops reading at manifest.json, wherever it is in the
+// archive; the layers before it are skipped without being read into memory
+// (or read at all, since the tar reader seeks over them in a file). Zstd
+// compressed tarballs are decompressed up to manifest.json.
+func ReadRepoTags(path string) ([]string, error) {
+	file, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("tarball has no %s", manifestName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if hdr.Name != manifestName || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		manifest, err := decodeManifest(hdr, tr)
+		if err != nil {
+			return nil, err
+		}
+		var tags []string
+		for _, entry := range manifest {
+			tags = append(tags, entry.RepoTags...)
+		}
+		return tags, nil
+	}
+}
+
+// decodeManifest decodes the manifest.json entry of a tarball
+func decodeManifest(hdr *tar.Header, r io.Reader) ([]ManifestEntry, error) {
+	if hdr.Size > maxMetadataSize {
+		return nil, fmt.Errorf("%s is too large (%d bytes)", manifestName, hdr.Size)
+	}
+	var manifest []ManifestEntry
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", manifestName, err)
+	}
+	return manifest, nil
+}
+
+// ReadImages returns the images described by the manifest of a docker save
+// tarball together with the platform from their image configs
+func ReadImages(path string) ([]ImageInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	// The manifest may come before or after the configs, so small JSON
+	// entries are kept until the manifest and all its configs were seen
+	var manifest []ManifestEntry
+	metadata := make(map[string][]byte)
+
+	tr := tar.NewReader(file)
+	for !haveConfigs(manifest, metadata) {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size > maxMetadataSize {
+			continue
+		}
+
+		switch {
+		case hdr.Name == manifestName:
+			if manifest, err = decodeManifest(hdr, tr); err != nil {
+				return nil, err
+			}
+		case strings.HasSuffix(hdr.Name, ".json") || strings.HasPrefix(hdr.Name, "blobs/sha256/"):
+			// OCI blobs are configs or layers; only configs are JSON
+			br := bufio.NewReader(tr)
+			if first, err := br.Peek(1); err != nil || first[0] != '{' {
+				continue
+			}
+			data, err := io.ReadAll(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", hdr.Name, err)
+			}
+			metadata[hdr.Name] = data
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("tarball has no %s", manifestName)
+	}
+
+	images := make([]ImageInfo, 0, len(manifest))
+	for _, entry := range manifest {
+		info := ImageInfo{RepoTags: entry.RepoTags}
+
+		data, ok := metadata[entry.Config]
+		if !ok {
+			return nil, fmt.Errorf("image config %s not found in tarball", entry.Config)
+		}
+		var cfg struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+			Variant      string `json:"variant"`
+			RootFS       struct {
+				DiffIDs []string `json:"diff_ids"`
+			} `json:"rootfs"`
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to decode image config %s: %w", entry.Config, err)
+		}
+		info.OS = cfg.OS
+		info.Architecture = cfg.Architecture
+		info.Variant = cfg.Variant
+		info.DiffIDs = cfg.RootFS.DiffIDs
+
+		images = append(images, info)
+	}
+
+	return images, nil
+}
+
+// haveConfigs reports whether the manifest and the configs of all its
+// images have been read
+func haveConfigs(manifest []ManifestEntry, metadata map[string][]byte) bool {
+	if manifest == nil {
+		return false
+	}
+	for _, entry := range manifest {
+		if _, ok := metadata[entry.Config]; !ok {
+			return false
+		}
+	}
+	return true
+}
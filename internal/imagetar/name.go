@@ -0,0 +1,24 @@
+package imagetar
+
+import "regexp"
+
+// TimestampFormat is the time layout of the timestamp the uploader puts in
+// tarball names, e.g. "myapp_latest_20240102-150405.tar"
+const TimestampFormat = "20060102-150405"
+
+// ChecksumSuffix is appended to a tarball's name for the file holding its
+// SHA-256 checksum, "<hash>  <tarball name>" as written by sha256sum
+const ChecksumSuffix = ".sha256"
+
+// nameTimestamp matches the timestamp at the end of a tarball name
+var nameTimestamp = regexp.MustCompile(`_(\d{8}-\d{6})\.tar(\.zst|\.gz)?$`)
+
+// NameTimestamp returns the timestamp in a tarball name, or "" if it has
+// none. Timestamps of the same layout sort like the times they stand for.
+func NameTimestamp(name string) string {
+	match := nameTimestamp.FindStringSubmatch(name)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
@@ -0,0 +1,43 @@
+package imagetar
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdExt is appended to the name of zstd compressed tarballs
+const ZstdExt = ".zst"
+
+// zstdMagic starts every zstd frame
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// CompressZstd writes a zstd compressed copy of the tarball src to dst
+func CompressZstd(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create compressed tarball: %w", err)
+	}
+	defer out.Close()
+
+	enc, err := zstd.NewWriter(out)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	if _, err := io.Copy(enc, in); err != nil {
+		enc.Close()
+		return fmt.Errorf("failed to compress tarball: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to compress tarball: %w", err)
+	}
+	return out.Close()
+}
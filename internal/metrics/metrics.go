@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry holds named metric values and renders them in the Prometheus
+// text exposition format
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]*metric
+}
+
+type metric struct {
+	kind  string
+	help  string
+	value float64
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*metric)}
+}
+
+// Set sets a gauge to value
+func (r *Registry) Set(name, help string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.get(name, "gauge", help).value = value
+}
+
+// Add increments a counter by delta
+func (r *Registry) Add(name, help string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.get(name, "counter", help).value += delta
+}
+
+// Value returns the current value of a metric
+func (r *Registry) Value(name string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m, ok := r.metrics[name]; ok {
+		return m.value
+	}
+	return 0
+}
+
+func (r *Registry) get(name, kind, help string) *metric {
+	m, ok := r.metrics[name]
+	if !ok {
+		m = &metric{kind: kind, help: help}
+		r.metrics[name] = m
+	}
+	return m
+}
+
+// WriteText writes all metrics in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := r.metrics[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n",
+			name, m.help, name, m.kind, name, m.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Push sends all metrics to a Prometheus Pushgateway, replacing the metrics
+// previously pushed for the same job and instance
+func (r *Registry) Push(gatewayURL, job, instance string) error {
+	var body bytes.Buffer
+	if err := r.WriteText(&body); err != nil {
+		return err
+	}
+
+	target := fmt.Sprintf("%s/metrics/job/%s", strings.TrimRight(gatewayURL, "/"), url.PathEscape(job))
+	if instance != "" {
+		target += "/instance/" + url.PathEscape(instance)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, target, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
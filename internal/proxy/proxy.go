@@ -0,0 +1,262 @@
+// Package proxy is a minimal TCP forwarder whose backend can be switched
+// while it runs, for zero-downtime deploys without an external proxy.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+const (
+	// dialTimeout bounds connecting to the backend
+	dialTimeout = 5 * time.Second
+	// resolveInterval limits how often a failing backend is looked up again
+	resolveInterval = time.Second
+)
+
+// Proxy accepts TCP connections and forwards each to the current backend.
+// Switching the backend only affects new connections; established ones
+// stay with the backend they were opened to. A nil Proxy does nothing, so
+// callers need not check whether the proxy is configured.
+type Proxy struct {
+	listen  string
+	resolve func() (string, error) // Looks up the backend when dialing it fails, may be nil
+	logger  *utils.Logger
+
+	mu         sync.Mutex
+	backend    string
+	resolvedAt time.Time
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+// New creates a proxy listening on listen, e.g. ":8080". resolve is called
+// when the backend cannot be reached, so a backend switched by another
+// process is picked up. It returns nil if listen is empty.
+func New(listen string, resolve func() (string, error), logger *utils.Logger) *Proxy {
+	if listen == "" {
+		return nil
+	}
+	return &Proxy{
+		listen:  listen,
+		resolve: resolve,
+		logger:  logger,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Start listens and forwards connections in the background until Close
+func (p *Proxy) Start() error {
+	if p == nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", p.listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", p.listen, err)
+	}
+	p.mu.Lock()
+	p.listener = listener
+	p.mu.Unlock()
+
+	p.logger.Info("Proxy listening on %s", listener.Addr())
+	p.wg.Add(1)
+	go p.serve(listener)
+	return nil
+}
+
+// Addr returns the address the proxy listens on, or nil if it is not
+// running
+func (p *Proxy) Addr() net.Addr {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.listener == nil {
+		return nil
+	}
+	return p.listener.Addr()
+}
+
+// SetBackend switches new connections to addr, e.g. "127.0.0.1:32768"
+func (p *Proxy) SetBackend(addr string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if addr != p.backend {
+		p.logger.Info("Proxy now forwards %s to %s", p.listen, addr)
+	}
+	p.backend = addr
+}
+
+// Backend returns the address new connections are forwarded to
+func (p *Proxy) Backend() string {
+	if p == nil {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.backend
+}
+
+// Close stops listening, closes the forwarded connections and waits for
+// them to finish
+func (p *Proxy) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	p.closed = true
+	var err error
+	if p.listener != nil {
+		err = p.listener.Close()
+	}
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+func (p *Proxy) serve(listener net.Listener) {
+	defer p.wg.Done()
+
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				p.logger.Error("Proxy stopped accepting connections: %v", err)
+			}
+			return
+		}
+		if !p.track(client) {
+			client.Close()
+			return
+		}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer p.untrack(client)
+			p.forward(client)
+		}()
+	}
+}
+
+// track registers a connection for Close, failing once the proxy is closed
+func (p *Proxy) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.conns, conn)
+	conn.Close()
+}
+
+// forward copies data between client and the backend until both sides
+// are done
+func (p *Proxy) forward(client net.Conn) {
+	backend, err := p.dial()
+	if err != nil {
+		p.logger.Warn("Proxy could not forward connection from %s: %v", client.RemoteAddr(), err)
+		return
+	}
+	if !p.track(backend) {
+		backend.Close()
+		return
+	}
+	defer p.untrack(backend)
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(backend, client)
+		closeWrite(backend)
+		close(done)
+	}()
+	io.Copy(client, backend)
+	closeWrite(client)
+	<-done
+}
+
+// dial connects to the backend, looking it up again if it cannot be
+// reached
+func (p *Proxy) dial() (net.Conn, error) {
+	backend := p.Backend()
+	if backend != "" {
+		conn, err := net.DialTimeout("tcp", backend, dialTimeout)
+		if err == nil {
+			return conn, nil
+		}
+		p.logger.Debug("Proxy backend %s unreachable: %v", backend, err)
+	}
+
+	resolved, err := p.lookup()
+	if err != nil {
+		return nil, err
+	}
+	if resolved == backend {
+		return nil, fmt.Errorf("backend %s unreachable", backend)
+	}
+	return net.DialTimeout("tcp", resolved, dialTimeout)
+}
+
+// lookup resolves the backend, at most once per resolveInterval
+func (p *Proxy) lookup() (string, error) {
+	p.mu.Lock()
+	resolve := p.resolve != nil && time.Since(p.resolvedAt) >= resolveInterval
+	if resolve {
+		p.resolvedAt = time.Now()
+	}
+	backend := p.backend
+	p.mu.Unlock()
+
+	if !resolve {
+		if backend == "" {
+			return "", fmt.Errorf("no backend")
+		}
+		return backend, nil
+	}
+
+	addr, err := p.resolve()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up backend: %w", err)
+	}
+	p.SetBackend(addr)
+	return addr, nil
+}
+
+// closeWrite signals the end of the data sent to conn, keeping the other
+// direction open
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/utils"
+	"github.com/ahsanumar/fws/internal/watcher"
+)
+
+// Server runs the optional control and metrics HTTP listeners of a watcher
+type Server struct {
+	config  *config.WatcherConfig
+	watcher *watcher.Watcher
+	logger  *utils.Logger
+	servers []*http.Server
+}
+
+func NewServer(cfg *config.WatcherConfig, w *watcher.Watcher, logger *utils.Logger) *Server {
+	return &Server{
+		config:  cfg,
+		watcher: w,
+		logger:  logger,
+	}
+}
+
+// Start opens the configured listeners and serves them in the background
+func (s *Server) Start() error {
+	if s.config.ControlListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", s.requireScope(config.ScopeRead, s.handleHealthz))
+		mux.Handle("/status", s.requireScope(config.ScopeRead, s.handleStatus))
+		mux.Handle("/logs", s.requireScope(config.ScopeRead, s.handleLogs))
+		mux.Handle("/history", s.requireScope(config.ScopeRead, s.handleHistory))
+		mux.Handle("/deploy", s.requireScope(config.ScopeAdmin, s.handleDeploy))
+		mux.Handle("/pause", s.requireScope(config.ScopeAdmin, s.handlePause))
+		mux.Handle("/resume", s.requireScope(config.ScopeAdmin, s.handleResume))
+		mux.Handle("/reload", s.requireScope(config.ScopeAdmin, s.handleReload))
+		if err := s.serve("control", s.config.ControlListen, mux); err != nil {
+			return err
+		}
+	}
+
+	if s.config.MetricsListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.requireScope(config.ScopeRead, s.handleMetrics))
+		if err := s.serve("metrics", s.config.MetricsListen, mux); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Shutdown gracefully stops all listeners
+func (s *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, srv := range s.servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			s.logger.Warn("Failed to shut down HTTP server: %v", err)
+		}
+	}
+}
+
+func (s *Server) serve(name, addr string, handler http.Handler) error {
+	listener, err := listen(addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for %s API on %s: %w", name, addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           s.authenticate(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.servers = append(s.servers, srv)
+
+	useTLS := s.config.TLSCertFile != ""
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	s.logger.Info("Serving %s API on %s (%s)", name, addr, scheme)
+
+	go func() {
+		var err error
+		if useTLS {
+			err = srv.ServeTLS(listener, s.config.TLSCertFile, s.config.TLSKeyFile)
+		} else {
+			err = srv.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("%s API server failed: %v", name, err)
+		}
+	}()
+
+	return nil
+}
+
+// listen opens a TCP listener, or a Unix socket for "unix:/path" addresses
+func listen(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, "unix:")
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+
+	// Remove a stale socket left by a previous run
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// authenticate requires a configured bearer token on every request
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.config.AuthToken == "" && len(s.config.AuthTokens) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if s.tokenScope(r.Header.Get("Authorization")) == "" {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(rw, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// requireScope rejects requests whose token, already checked by
+// authenticate, does not grant scope with 403
+func (s *Server) requireScope(scope string, next http.HandlerFunc) http.Handler {
+	if s.config.AuthToken == "" && len(s.config.AuthTokens) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !config.ScopeAllows(s.tokenScope(r.Header.Get("Authorization")), scope) {
+			writeError(rw, http.StatusForbidden, fmt.Sprintf("token lacks the %s scope", scope))
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// tokenScope returns the scope of the bearer token in an Authorization
+// header, or "" if it is not a configured token. auth_token has the admin
+// scope.
+func (s *Server) tokenScope(header string) string {
+	got := []byte(header)
+	match := func(token string) bool {
+		return token != "" && subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) == 1
+	}
+
+	if match(s.config.AuthToken) {
+		return config.ScopeAdmin
+	}
+	for _, token := range s.config.AuthTokens {
+		if match(token.Token) {
+			return token.Scope
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleHealthz(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleStatus(rw http.ResponseWriter, r *http.Request) {
+	status, err := s.watcher.Status()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(rw, http.StatusOK, status)
+}
+
+func (s *Server) handleLogs(rw http.ResponseWriter, r *http.Request) {
+	lines := 50
+	if v := r.URL.Query().Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(rw, http.StatusBadRequest, "lines must be a positive integer")
+			return
+		}
+		lines = n
+	}
+
+	logs, err := s.watcher.GetContainerLogs(lines)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(rw, http.StatusOK, map[string]string{"logs": logs})
+}
+
+func (s *Server) handleHistory(rw http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(rw, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	deploys, err := s.watcher.Journal()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Newest first
+	history := make([]watcher.DeployResult, 0, limit)
+	for i := len(deploys) - 1; i >= 0 && len(history) < limit; i-- {
+		history = append(history, deploys[i])
+	}
+	writeJSON(rw, http.StatusOK, map[string][]watcher.DeployResult{"deploys": history})
+}
+
+func (s *Server) handleDeploy(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(rw, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	var req struct {
+		Tarball string `json:"tarball"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	result, err := s.watcher.DeployByName(req.Tarball)
+	if err != nil {
+		if result == nil {
+			writeError(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(rw, http.StatusInternalServerError, result)
+		return
+	}
+	writeJSON(rw, http.StatusOK, result)
+}
+
+func (s *Server) handlePause(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(rw, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	s.watcher.Pause()
+	writeJSON(rw, http.StatusOK, map[string]bool{"paused": true})
+}
+
+func (s *Server) handleResume(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(rw, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	s.watcher.Resume()
+	writeJSON(rw, http.StatusOK, map[string]bool{"paused": false})
+}
+
+func (s *Server) handleReload(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(rw, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if err := s.watcher.ReloadConfig(); err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(rw, http.StatusOK, map[string]bool{"reloaded": true})
+}
+
+func (s *Server) handleMetrics(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := s.watcher.Metrics().WriteText(rw); err != nil {
+		s.logger.Warn("Failed to write metrics: %v", err)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+func writeError(rw http.ResponseWriter, status int, msg string) {
+	writeJSON(rw, status, map[string]string{"error": msg})
+}
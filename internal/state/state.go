@@ -0,0 +1,139 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is the persistent watcher state kept between deploys
+type State struct {
+	mu   sync.Mutex
+	path string
+
+	// OnceCommands records run-once commands that already completed as part
+	// of a successful deploy, keyed by command string
+	OnceCommands map[string]time.Time `json:"once_commands"`
+
+	// Container is the name of the container of the last successful deploy,
+	// which differs between deploys when container_name is a template
+	Container string `json:"container,omitempty"`
+
+	// Version is the file name timestamp of the tarball of the last
+	// successful deploy, e.g. "20240102-150405"
+	Version string `json:"version,omitempty"`
+}
+
+// Load reads the state file at path. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	s := &State{
+		path:         path,
+		OnceCommands: make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to decode state file %s: %w", path, err)
+	}
+	if s.OnceCommands == nil {
+		s.OnceCommands = make(map[string]time.Time)
+	}
+
+	return s, nil
+}
+
+// Save writes the state file atomically
+func (s *State) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	return nil
+}
+
+// OnceDone reports whether a run-once command already completed
+func (s *State) OnceDone(cmd string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.OnceCommands[cmd]
+	return ok
+}
+
+// MarkOnce records run-once commands as completed
+func (s *State) MarkOnce(cmds ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, cmd := range cmds {
+		s.OnceCommands[cmd] = now
+	}
+}
+
+// ResetOnce forgets all completed run-once commands so they run again on
+// the next deploy
+func (s *State) ResetOnce() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.OnceCommands = make(map[string]time.Time)
+}
+
+// LastContainer returns the container of the last successful deploy
+func (s *State) LastContainer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Container
+}
+
+// SetContainer records the container of a successful deploy
+func (s *State) SetContainer(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Container = name
+}
+
+// LastVersion returns the file name timestamp of the last deployed tarball
+func (s *State) LastVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Version
+}
+
+// SetVersion records the file name timestamp of a deployed tarball
+func (s *State) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Version = version
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Instance and container metadata endpoints
+const (
+	imdsEndpoint         = "http://169.254.169.254"
+	containerCredsHost   = "http://169.254.170.2"
+	credentialsRefreshIn = 5 * time.Minute
+)
+
+// credentialProvider resolves AWS credentials from the environment, the
+// ECS container endpoint or the EC2 instance metadata service, caching
+// temporary credentials until shortly before they expire
+type credentialProvider struct {
+	client *http.Client
+	mu     sync.Mutex
+	cached credentials
+}
+
+func newCredentialProvider() *credentialProvider {
+	return &credentialProvider{client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (p *credentialProvider) get() (credentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return credentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cached.AccessKeyID != "" && time.Until(p.cached.Expires) > credentialsRefreshIn {
+		return p.cached, nil
+	}
+
+	var creds credentials
+	var err error
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		creds, err = p.fetch(containerCredsHost+uri, nil)
+	} else {
+		creds, err = p.fromInstanceMetadata()
+	}
+	if err != nil {
+		return credentials{}, fmt.Errorf("no AWS credentials in the environment and %w", err)
+	}
+
+	p.cached = creds
+	return creds, nil
+}
+
+// fromInstanceMetadata reads the instance role credentials using IMDSv2
+func (p *credentialProvider) fromInstanceMetadata() (credentials, error) {
+	req, err := http.NewRequest(http.MethodPut, imdsEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return credentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := p.read(req)
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to reach instance metadata: %w", err)
+	}
+	header := http.Header{"X-aws-ec2-metadata-token": []string{token}}
+
+	roleURL := imdsEndpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest(http.MethodGet, roleURL, nil)
+	if err != nil {
+		return credentials{}, err
+	}
+	req.Header = header
+	role, err := p.read(req)
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to read instance role: %w", err)
+	}
+
+	return p.fetch(roleURL+strings.TrimSpace(strings.SplitN(role, "\n", 2)[0]), header)
+}
+
+// fetch reads a credentials document as served by IMDS and ECS
+func (p *credentialProvider) fetch(url string, header http.Header) (credentials, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return credentials{}, err
+	}
+	if header != nil {
+		req.Header = header
+	}
+	body, err := p.read(req)
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+
+	var doc struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return credentials{}, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	return credentials{
+		AccessKeyID:     doc.AccessKeyID,
+		SecretAccessKey: doc.SecretAccessKey,
+		SessionToken:    doc.Token,
+		Expires:         doc.Expiration,
+	}, nil
+}
+
+func (p *credentialProvider) read(req *http.Request) (string, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return string(body), nil
+}
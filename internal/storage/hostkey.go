@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PinnedHostKey accepts only a host key with the given SHA256 fingerprint,
+// as printed by ssh-keygen -lf
+func PinnedHostKey(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if got := ssh.FingerprintSHA256(key); got != fingerprint {
+			return fmt.Errorf("host key mismatch for %s: server presented %s %s, expected %s", hostname, key.Type(), got, fingerprint)
+		}
+		return nil
+	}
+}
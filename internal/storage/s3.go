@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the size of multipart upload parts. Objects of unknown
+// size or larger than one part are uploaded in parts; S3 allows up to
+// 10000 parts, so objects up to ~156GiB are supported.
+const s3PartSize = 16 << 20
+
+// S3Options configures an S3 compatible storage
+type S3Options struct {
+	Endpoint string // Service URL; defaults to the AWS endpoint of Region
+	Region   string
+	Bucket   string
+	Prefix   string // Key prefix for all objects
+}
+
+// S3 stores objects in an S3 compatible bucket. Credentials are taken from
+// the environment (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN) or the instance/container role.
+type S3 struct {
+	opts      S3Options
+	base      *url.URL
+	pathStyle bool
+	client    *http.Client
+	creds     *credentialProvider
+}
+
+// NewS3 creates an S3 storage. AWS endpoints use virtual-hosted style
+// addressing; custom endpoints such as MinIO use path style.
+func NewS3(opts S3Options) (*S3, error) {
+	endpoint := opts.Endpoint
+	pathStyle := endpoint != ""
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", opts.Bucket, opts.Region)
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", endpoint)
+	}
+
+	return &S3{
+		opts:      opts,
+		base:      base,
+		pathStyle: pathStyle,
+		client:    &http.Client{},
+		creds:     newCredentialProvider(),
+	}, nil
+}
+
+// Put uploads an object, in parts if it is large or of unknown size.
+// S3 only makes an object visible once its upload completed.
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	if size >= 0 && size <= s3PartSize {
+		_, err := s.do(http.MethodPut, s.key(name), nil, r, size, nil)
+		return err
+	}
+	return s.multipartPut(s.key(name), r)
+}
+
+// List returns the names of the objects below the prefix
+func (s *S3) List() ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if s.opts.Prefix != "" {
+			query.Set("prefix", s.opts.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		body, err := s.do(http.MethodGet, "", query, nil, 0, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bucket: %w", err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode bucket listing: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.opts.Prefix)
+			if name != "" && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !result.IsTruncated {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Get downloads an object
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.request(http.MethodGet, s.key(name), nil, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes an object
+func (s *S3) Delete(name string) error {
+	_, err := s.do(http.MethodDelete, s.key(name), nil, nil, 0, nil)
+	return err
+}
+
+func (s *S3) key(name string) string {
+	return s.opts.Prefix + name
+}
+
+// multipartPut uploads r in s3PartSize parts, aborting the upload on error
+func (s *S3) multipartPut(key string, r io.Reader) error {
+	body, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &initiate); err != nil || initiate.UploadID == "" {
+		return fmt.Errorf("failed to decode multipart upload id: %v", err)
+	}
+	uploadID := initiate.UploadID
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []part
+
+	err = func() error {
+		buf := make([]byte, s3PartSize)
+		for number := 1; ; number++ {
+			n, readErr := io.ReadFull(r, buf)
+			if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+				return readErr
+			}
+			// The final part may be empty only if it is the first one
+			if n == 0 && number > 1 {
+				return nil
+			}
+
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+			resp, err := s.request(http.MethodPut, key, query, bytes.NewReader(buf[:n]), int64(n), nil)
+			if err != nil {
+				return fmt.Errorf("failed to upload part %d: %w", number, err)
+			}
+			resp.Body.Close()
+			parts = append(parts, part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+			if readErr != nil {
+				return nil
+			}
+		}
+	}()
+	if err == nil {
+		complete := struct {
+			XMLName xml.Name `xml:"CompleteMultipartUpload"`
+			Parts   []part   `xml:"Part"`
+		}{Parts: parts}
+		var payload []byte
+		payload, err = xml.Marshal(complete)
+		if err == nil {
+			_, err = s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(payload), int64(len(payload)), payload)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+
+	if _, abortErr := s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0, nil); abortErr != nil {
+		return fmt.Errorf("%w (and failed to abort multipart upload: %v)", err, abortErr)
+	}
+	return err
+}
+
+// do performs a request and returns the response body
+func (s *S3) do(method, key string, query url.Values, body io.Reader, size int64, signedBody []byte) ([]byte, error) {
+	resp, err := s.request(method, key, query, body, size, signedBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// request sends a signed request and fails on non-2xx responses. Bodies
+// are sent unsigned unless signedBody holds the full payload.
+func (s *S3) request(method, key string, query url.Values, body io.Reader, size int64, signedBody []byte) (*http.Response, error) {
+	u := *s.base
+	path := "/" + uriEncode(key, false)
+	if s.pathStyle {
+		path = "/" + uriEncode(s.opts.Bucket, true) + path
+	}
+	u.RawPath = strings.TrimSuffix(u.Path, "/") + path
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	payloadHash := emptyPayloadHash
+	switch {
+	case signedBody != nil:
+		payloadHash = hashHex(signedBody)
+	case body != nil:
+		payloadHash = unsignedPayloadHash
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	creds, err := s.creds.get()
+	if err != nil {
+		return nil, err
+	}
+	signV4(req, creds, s.opts.Region, "s3", payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var s3Err struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(msg, &s3Err) == nil && s3Err.Code != "" {
+			return nil, fmt.Errorf("S3 %s %s: %s: %s", method, key, s3Err.Code, s3Err.Message)
+		}
+		return nil, fmt.Errorf("S3 %s %s: unexpected status %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// NewSFTP creates a storage like NewSSH that transfers and manages files
+// over SFTP instead of scp and shell commands, for hosts without scp or
+// restricted to SFTP. Close ends the SFTP session.
+func NewSFTP(client *ssh.Client, dir string) (*SSH, error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	return &SSH{client: client, sftp: sftpClient, dir: dir}, nil
+}
+
+// Close ends the SFTP session of a storage created with NewSFTP
+func (s *SSH) Close() error {
+	if s.sftp == nil {
+		return nil
+	}
+	return s.sftp.Close()
+}
+
+// sftpPut writes r to partPath and moves it to remotePath once complete,
+// with the same mode as SCP uploads
+func (s *SSH) sftpPut(r io.Reader, partPath, remotePath string) error {
+	err := s.sftpWrite(r, partPath)
+	if err != nil {
+		if rerr := s.sftp.Remove(partPath); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+			err = fmt.Errorf("%w (and failed to remove partial upload: %v)", err, rerr)
+		}
+		return err
+	}
+
+	// A plain SFTP rename fails if the target exists
+	if _, ok := s.sftp.HasExtension("posix-rename@openssh.com"); ok {
+		err = s.sftp.PosixRename(partPath, remotePath)
+	} else {
+		if rerr := s.sftp.Remove(remotePath); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+			return fmt.Errorf("failed to move upload into place: %w", rerr)
+		}
+		err = s.sftp.Rename(partPath, remotePath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move upload into place: %w", err)
+	}
+	return nil
+}
+
+// sftpWrite creates remotePath with the content of r
+func (s *SSH) sftpWrite(r io.Reader, remotePath string) error {
+	file, err := s.sftp.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file: %w", err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to copy file content: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close remote file: %w", err)
+	}
+	if err := s.sftp.Chmod(remotePath, 0644); err != nil {
+		return fmt.Errorf("failed to set remote file mode: %w", err)
+	}
+	return nil
+}
+
+// sftpList returns the files in the directory in the order ls lists them,
+// skipping hidden files and partial uploads
+func (s *SSH) sftpList() ([]string, error) {
+	entries, err := s.sftp.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", s.dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, partSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// partSuffix marks objects that are still being written
+const partSuffix = ".part"
+
+// SSH stores objects in a directory on a remote host, using SCP for
+// uploads of known size and a streamed "cat" otherwise, or SFTP for
+// everything if created with NewSFTP
+type SSH struct {
+	client   *ssh.Client
+	sftp     *sftp.Client // Set for storages created with NewSFTP
+	dir      string
+	dirReady bool
+}
+
+// NewSSH creates a storage rooted at dir on the host client is connected
+// to. The directory is created on the first Put.
+func NewSSH(client *ssh.Client, dir string) *SSH {
+	return &SSH{client: client, dir: dir}
+}
+
+// Path returns the remote path of an object
+func (s *SSH) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// Put uploads to a ".part" file and moves it into place once complete
+func (s *SSH) Put(name string, r io.Reader, size int64) error {
+	if err := s.ensureDir(); err != nil {
+		return err
+	}
+
+	remotePath := s.Path(name)
+	partPath := remotePath + partSuffix
+
+	if s.sftp != nil {
+		return s.sftpPut(r, partPath, remotePath)
+	}
+
+	var err error
+	if size >= 0 {
+		err = SCPCopy(s.client, r, size, 0644, partPath)
+	} else {
+		err = s.stream(r, partPath)
+	}
+	if err != nil {
+		if _, rerr := RunCommand(s.client, fmt.Sprintf("rm -f %s", utils.ShellQuote(partPath))); rerr != nil {
+			err = fmt.Errorf("%w (and failed to remove partial upload: %v)", err, rerr)
+		}
+		return err
+	}
+
+	moveCmd := fmt.Sprintf("mv %s %s", utils.ShellQuote(partPath), utils.ShellQuote(remotePath))
+	if _, err := RunCommand(s.client, moveCmd); err != nil {
+		return fmt.Errorf("failed to move upload into place: %w", err)
+	}
+	return nil
+}
+
+// List returns the objects in the directory, skipping partial uploads
+func (s *SSH) List() ([]string, error) {
+	if s.sftp != nil {
+		return s.sftpList()
+	}
+
+	listCmd := fmt.Sprintf("if [ -d %s ]; then ls -1 %s; fi", utils.ShellQuote(s.dir), utils.ShellQuote(s.dir))
+	output, err := RunCommand(s.client, listCmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", s.dir, err)
+	}
+
+	var names []string
+	for _, name := range strings.Split(output, "\n") {
+		if name != "" && !strings.HasSuffix(name, partSuffix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Get streams an object from the remote host
+func (s *SSH) Get(name string) (io.ReadCloser, error) {
+	if s.sftp != nil {
+		file, err := s.sftp.Open(s.Path(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return file, nil
+	}
+
+	session, err := s.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	if err := session.Start(fmt.Sprintf("cat %s", utils.ShellQuote(s.Path(name)))); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return &sessionReader{Reader: stdout, session: session}, nil
+}
+
+// Delete removes an object from the remote host
+func (s *SSH) Delete(name string) error {
+	if s.sftp != nil {
+		if err := s.sftp.Remove(s.Path(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+		return nil
+	}
+
+	removeCmd := fmt.Sprintf("rm -f %s", utils.ShellQuote(s.Path(name)))
+	if _, err := RunCommand(s.client, removeCmd); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *SSH) ensureDir() error {
+	if s.dirReady {
+		return nil
+	}
+	if s.sftp != nil {
+		if err := s.sftp.MkdirAll(s.dir); err != nil {
+			return fmt.Errorf("failed to create remote directory: %w", err)
+		}
+		s.dirReady = true
+		return nil
+	}
+	if _, err := RunCommand(s.client, fmt.Sprintf("mkdir -p %s", utils.ShellQuote(s.dir))); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+	s.dirReady = true
+	return nil
+}
+
+// stream writes r of unknown length to remotePath
+func (s *SSH) stream(r io.Reader, remotePath string) error {
+	session, err := s.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = r
+	session.Stderr = &stderr
+	if err := session.Run(fmt.Sprintf("cat > %s", utils.ShellQuote(remotePath))); err != nil {
+		return fmt.Errorf("remote write failed: %s, output: %s", err.Error(), utils.TruncateOutput(strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
+
+// sessionReader closes the SSH session along with the reader
+type sessionReader struct {
+	io.Reader
+	session *ssh.Session
+}
+
+func (r *sessionReader) Close() error {
+	// Drain so the remote command can exit, then collect its status
+	io.Copy(io.Discard, r.Reader)
+	err := r.session.Wait()
+	r.session.Close()
+	return err
+}
+
+// SCPCopy streams size bytes from r to remotePath using the SCP protocol
+func SCPCopy(client *ssh.Client, r io.Reader, size int64, mode os.FileMode, remotePath string) error {
+	// Create SSH session
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// Create SCP command
+	scpCmd := fmt.Sprintf("scp -t %s", remotePath)
+
+	// Get stdin pipe
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+
+	// Start SCP command
+	if err := session.Start(scpCmd); err != nil {
+		return fmt.Errorf("failed to start SCP command: %w", err)
+	}
+
+	// Send file header
+	header := fmt.Sprintf("C%#o %d %s\n", mode, size, filepath.Base(remotePath))
+	if _, err := stdin.Write([]byte(header)); err != nil {
+		return fmt.Errorf("failed to send file header: %w", err)
+	}
+
+	// Copy file content
+	if _, err := io.Copy(stdin, r); err != nil {
+		return fmt.Errorf("failed to copy file content: %w", err)
+	}
+
+	// Send end marker
+	if _, err := stdin.Write([]byte("\x00")); err != nil {
+		return fmt.Errorf("failed to send end marker: %w", err)
+	}
+
+	// Close stdin and wait for session to complete
+	stdin.Close()
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("SCP command failed: %w", err)
+	}
+
+	return nil
+}
+
+// RunCommand runs a command on the remote host and returns its output
+func RunCommand(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(command)
+	if err != nil {
+		return string(output), fmt.Errorf("remote command failed: %s, output: %s", err.Error(), utils.TruncateOutput(strings.TrimSpace(string(output))))
+	}
+	return string(output), nil
+}
+
+// Sub returns a storage for a subdirectory, or for dir itself if it is
+// absolute, sharing the SSH connection and SFTP session
+func (s *SSH) Sub(dir string) *SSH {
+	if !filepath.IsAbs(dir) {
+		dir = s.Path(dir)
+	}
+	return &SSH{client: s.client, sftp: s.sftp, dir: dir}
+}
@@ -0,0 +1,24 @@
+// Package storage abstracts where tarballs are delivered to, so the
+// uploader is not tied to a single transport.
+package storage
+
+import (
+	"io"
+)
+
+// Storage is a flat namespace of tarballs and other upload artifacts
+type Storage interface {
+	// Put stores size bytes read from r under name, replacing any existing
+	// object. A negative size means the length is not known in advance.
+	// Readers never observe a partially written object.
+	Put(name string, r io.Reader, size int64) error
+
+	// List returns the names of all stored objects
+	List() ([]string, error)
+
+	// Get opens a stored object for reading
+	Get(name string) (io.ReadCloser, error)
+
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(name string) error
+}
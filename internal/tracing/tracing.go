@@ -0,0 +1,195 @@
+// Package tracing exports deploy and upload traces to an OpenTelemetry
+// collector over OTLP/HTTP, without depending on the OpenTelemetry SDK.
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Span is one timed operation of a trace, with the operations it consists
+// of as children
+type Span struct {
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Error      string            // Set if the operation failed
+	Attributes map[string]string // Optional
+	Children   []*Span
+}
+
+// Child adds a child span and returns it
+func (s *Span) Child(name string, start, end time.Time) *Span {
+	child := &Span{Name: name, Start: start, End: end}
+	s.Children = append(s.Children, child)
+	return child
+}
+
+// Exporter sends finished traces to an OpenTelemetry collector using
+// OTLP/HTTP with the JSON encoding. A nil Exporter discards traces, so
+// callers need not check whether tracing is configured.
+type Exporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewExporter creates an exporter for the collector at endpoint, e.g.
+// "http://localhost:4318". It returns nil if endpoint is empty.
+func NewExporter(endpoint string) *Exporter {
+	if endpoint == "" {
+		return nil
+	}
+	url := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &Exporter{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Export sends root and its children as one trace
+func (e *Exporter) Export(root *Span) error {
+	if e == nil {
+		return nil
+	}
+
+	traceID, err := randomID(16)
+	if err != nil {
+		return err
+	}
+	var spans []otlpSpan
+	if err := appendSpans(&spans, root, traceID, ""); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]string{"service.name": "fws"})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "fws"}, Spans: spans}},
+	}}})
+	if err != nil {
+		return fmt.Errorf("failed to encode trace: %w", err)
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to export trace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("trace collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// appendSpans converts span and its children to OTLP spans
+func appendSpans(spans *[]otlpSpan, span *Span, traceID, parentID string) error {
+	spanID, err := randomID(8)
+	if err != nil {
+		return err
+	}
+
+	s := otlpSpan{
+		TraceID:      traceID,
+		SpanID:       spanID,
+		ParentSpanID: parentID,
+		Name:         span.Name,
+		Kind:         1, // Internal
+		Start:        strconv.FormatInt(span.Start.UnixNano(), 10),
+		End:          strconv.FormatInt(span.End.UnixNano(), 10),
+		Attributes:   attributes(span.Attributes),
+	}
+	if span.Error != "" {
+		s.Status = &otlpStatus{Code: 2, Message: span.Error} // Error
+	}
+	*spans = append(*spans, s)
+
+	for _, child := range span.Children {
+		if err := appendSpans(spans, child, traceID, spanID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, otlpAttribute{Key: key, Value: otlpValue{StringValue: attrs[key]}})
+	}
+	return list
+}
+
+// randomID returns n random bytes, hex encoded
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate trace ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// The OTLP/HTTP JSON request, limited to what fws sends
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,55 @@
+package uploader
+
+import (
+	"fmt"
+
+	"github.com/ahsanumar/fws/internal/storage"
+)
+
+// openStorage connects to the configured storage backend. The returned
+// function releases the connection.
+func (u *Uploader) openStorage() (storage.Storage, func(), error) {
+	if u.config.Storage == "s3" {
+		store, err := storage.NewS3(storage.S3Options{
+			Endpoint: u.config.S3.Endpoint,
+			Region:   u.config.S3.Region,
+			Bucket:   u.config.S3.Bucket,
+			Prefix:   u.config.S3.Prefix,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() {}, nil
+	}
+
+	client, err := u.createSSHClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create SSH client: %w", err)
+	}
+	stopKeepAlive := u.keepAlive(client)
+	if u.config.UploadProtocol == "sftp" {
+		store, err := storage.NewSFTP(client, u.config.RemoteUploadPath)
+		if err != nil {
+			stopKeepAlive()
+			client.Close()
+			return nil, nil, err
+		}
+		return store, func() {
+			store.Close()
+			stopKeepAlive()
+			client.Close()
+		}, nil
+	}
+	return storage.NewSSH(client, u.config.RemoteUploadPath), func() {
+		stopKeepAlive()
+		client.Close()
+	}, nil
+}
+
+// destination describes where tarballs are uploaded to, for logging
+func (u *Uploader) destination() string {
+	if u.config.Storage == "s3" {
+		return fmt.Sprintf("s3://%s/%s", u.config.S3.Bucket, u.config.S3.Prefix)
+	}
+	return fmt.Sprintf("%s@%s:%s", u.config.RemoteUser, u.config.RemoteHost, u.config.RemoteUploadPath)
+}
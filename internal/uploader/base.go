@@ -0,0 +1,139 @@
+package uploader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/storage"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// baseImage describes the configured base_image in docker
+type baseImage struct {
+	ID      string
+	DiffIDs []string // Layer diff IDs, bottom layer first
+}
+
+// inspectBaseImage looks up the ID and layers of base_image
+func (u *Uploader) inspectBaseImage() (*baseImage, error) {
+	inspectCmd := fmt.Sprintf("docker image inspect -f '{{.Id}}{{range .RootFS.Layers}} {{.}}{{end}}' %s", u.config.BaseImage)
+	output, err := utils.ExecuteCommand(u.ctx, inspectCmd, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect base image %s: %w", u.config.BaseImage, err)
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("failed to inspect base image %s: no image ID", u.config.BaseImage)
+	}
+	return &baseImage{ID: fields[0], DiffIDs: fields[1:]}, nil
+}
+
+// baseTarballName names the tarball of a base image after its ID, so
+// every uploader using the same base shares it
+func (u *Uploader) baseTarballName(id string) string {
+	digest := strings.TrimPrefix(id, "sha256:")
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+	return "fws-base_" + digest + ".tar" + imagetar.CompressionExt(u.config.CompressionFormat())
+}
+
+// stripBaseLayers leaves the layers the image shares with base_image out of
+// the tarball, recording the base tarball it depends on. Only the common
+// bottom layers are left out: docker load skips a layer only if it already
+// has the same layer on the same parents.
+func (u *Uploader) stripBaseLayers(tarballPath string) error {
+	base, err := u.inspectBaseImage()
+	if err != nil {
+		return err
+	}
+
+	images, err := imagetar.ReadImages(tarballPath)
+	if err != nil {
+		return err
+	}
+	if len(images) != 1 {
+		return fmt.Errorf("base_image needs a tarball with a single image, found %d", len(images))
+	}
+
+	shared := make(map[string]bool)
+	for i, diffID := range images[0].DiffIDs {
+		if i >= len(base.DiffIDs) || base.DiffIDs[i] != diffID {
+			break
+		}
+		shared[strings.TrimPrefix(diffID, "sha256:")] = true
+	}
+	if len(shared) == 0 {
+		u.logger.Warn("Image %s is not built on base image %s, uploading all layers", u.config.ImageRef(), u.config.BaseImage)
+		return nil
+	}
+
+	ref := imagetar.BaseRef{Tarball: u.baseTarballName(base.ID), ImageID: base.ID}
+	strippedPath := tarballPath + ".app"
+	layers, size, err := imagetar.StripBase(tarballPath, strippedPath, shared, ref)
+	if err != nil {
+		os.Remove(strippedPath)
+		return err
+	}
+	if err := os.Rename(strippedPath, tarballPath); err != nil {
+		os.Remove(strippedPath)
+		return fmt.Errorf("failed to replace tarball: %w", err)
+	}
+
+	u.logger.Info("Left %d base image layers (%s) out of the tarball, it depends on %s", layers, utils.FormatBytes(size), ref.Tarball)
+	return nil
+}
+
+// uploadBaseTarball uploads the base image a tarball depends on to the
+// base directory, unless it is already there
+func (u *Uploader) uploadBaseTarball(bases storage.Storage, tarballPath string) error {
+	ref, err := imagetar.ReadBaseRef(tarballPath)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return nil
+	}
+
+	names, err := bases.List()
+	if err != nil {
+		return fmt.Errorf("failed to list remote base images: %w", err)
+	}
+	for _, name := range names {
+		if name == ref.Tarball {
+			u.logger.Debug("Base image tarball %s already on remote", ref.Tarball)
+			return nil
+		}
+	}
+
+	dir, err := os.MkdirTemp(u.config.TarballPath, "fws-base-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Save by name, so the watcher's copy of the base image is tagged
+	basePath := filepath.Join(dir, imagetar.TrimCompressionExt(ref.Tarball))
+	u.logger.Info("Saving base image %s (%s)", u.config.BaseImage, ref.ImageID)
+	saveCmd := fmt.Sprintf("docker save %s -o %s", u.config.BaseImage, basePath)
+	if _, err := utils.ExecuteCommand(u.ctx, saveCmd, 10*time.Minute); err != nil {
+		return fmt.Errorf("failed to save base image: %w", err)
+	}
+	if format := u.config.CompressionFormat(); format != "" {
+		compressedPath := basePath + imagetar.CompressionExt(format)
+		if err := imagetar.Compress(basePath, compressedPath, format); err != nil {
+			return err
+		}
+		basePath = compressedPath
+	}
+
+	if size, err := utils.GetFileSize(basePath); err == nil {
+		u.logger.Info("Uploading base image tarball %s (%s)", ref.Tarball, utils.FormatBytes(size))
+	}
+	return u.putTarball(bases, basePath)
+}
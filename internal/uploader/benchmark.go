@@ -0,0 +1,67 @@
+package uploader
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// benchmarkRoundTrips is the number of List calls latency is averaged over
+const benchmarkRoundTrips = 3
+
+// BenchmarkResult is the outcome of an upload benchmark
+type BenchmarkResult struct {
+	Destination    string  `json:"destination"`
+	Bytes          int64   `json:"bytes"`
+	ConnectSeconds float64 `json:"connect_seconds"` // Establishing the connection, e.g. the SSH handshake
+	LatencySeconds float64 `json:"latency_seconds"` // Average round trip of listing the upload directory
+	UploadSeconds  float64 `json:"upload_seconds"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// Benchmark uploads size bytes of random data to the configured storage,
+// removes it again and reports the achieved throughput and latency. The
+// payload does not compress, so the figures reflect the network rather
+// than the data.
+func (u *Uploader) Benchmark(size int64) (*BenchmarkResult, error) {
+	result := &BenchmarkResult{Destination: u.destination(), Bytes: size}
+
+	start := time.Now()
+	store, closeStore, err := u.openStorage()
+	if err != nil {
+		return nil, err
+	}
+	defer closeStore()
+	result.ConnectSeconds = time.Since(start).Seconds()
+
+	for i := 0; i < benchmarkRoundTrips; i++ {
+		start = time.Now()
+		if _, err := store.List(); err != nil {
+			return nil, fmt.Errorf("failed to list remote files: %w", err)
+		}
+		result.LatencySeconds += time.Since(start).Seconds() / benchmarkRoundTrips
+	}
+
+	// Hidden and without a tarball extension, so watchers ignore it
+	name := fmt.Sprintf(".fws-benchmark_%s.bin", time.Now().Format("20060102-150405"))
+	payload := io.LimitReader(rand.New(rand.NewSource(time.Now().UnixNano())), size)
+
+	u.logger.Info("Uploading %s of random data to %s", utils.FormatBytes(size), result.Destination)
+	start = time.Now()
+	err = store.Put(name, payload, size)
+	result.UploadSeconds = time.Since(start).Seconds()
+	if err != nil {
+		return nil, fmt.Errorf("benchmark upload failed: %w", err)
+	}
+	if result.UploadSeconds > 0 {
+		result.BytesPerSecond = float64(size) / result.UploadSeconds
+	}
+
+	if err := store.Delete(name); err != nil {
+		u.logger.Warn("Failed to remove benchmark file %s: %v", name, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,164 @@
+package uploader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// cacheIndexName is the index file of the tarball cache
+const cacheIndexName = "index.json"
+
+// cacheEntry is the cached tarball of one image reference
+type cacheEntry struct {
+	ImageID   string    `json:"image_id"`
+	File      string    `json:"file"`
+	CreatedAt time.Time `json:"created_at"`
+
+	SaveArgs []string `json:"save_args,omitempty"` // save_args the tarball was saved with
+}
+
+// cacheIndex maps image references to their cached tarball
+type cacheIndex struct {
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// cacheDir returns the directory holding cached tarballs
+func (u *Uploader) cacheDir() string {
+	return filepath.Join(u.config.TarballPath, ".fws-cache")
+}
+
+// imageID returns the ID (config digest) of the image to upload
+func (u *Uploader) imageID() (string, error) {
+	output, err := utils.ExecuteCommand(u.ctx, fmt.Sprintf("docker image inspect -f '{{.Id}}' %s", u.config.ImageRef()), 30*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (u *Uploader) loadCacheIndex() (*cacheIndex, error) {
+	index := &cacheIndex{Entries: make(map[string]cacheEntry)}
+	data, err := os.ReadFile(filepath.Join(u.cacheDir(), cacheIndexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tarball cache index: %w", err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to decode tarball cache index: %w", err)
+	}
+	if index.Entries == nil {
+		index.Entries = make(map[string]cacheEntry)
+	}
+	return index, nil
+}
+
+// saveCacheIndex writes the cache index atomically
+func (u *Uploader) saveCacheIndex(index *cacheIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tarball cache index: %w", err)
+	}
+
+	path := filepath.Join(u.cacheDir(), cacheIndexName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write tarball cache index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace tarball cache index: %w", err)
+	}
+	return nil
+}
+
+// restoreFromCache places the cached tarball of imageID at tarballPath. It
+// reports whether the cache held a tarball for the image.
+func (u *Uploader) restoreFromCache(imageID, tarballPath string) (bool, error) {
+	index, err := u.loadCacheIndex()
+	if err != nil {
+		return false, err
+	}
+
+	entry, ok := index.Entries[u.config.ImageRef()]
+	if !ok || entry.ImageID != imageID || strings.Join(entry.SaveArgs, " ") != strings.Join(u.config.SaveArgs, " ") {
+		return false, nil
+	}
+	cached := filepath.Join(u.cacheDir(), entry.File)
+	if !utils.FileExists(cached) {
+		return false, nil
+	}
+
+	if err := linkOrCopy(cached, tarballPath); err != nil {
+		return false, fmt.Errorf("failed to restore cached tarball: %w", err)
+	}
+	return true, nil
+}
+
+// addToCache stores the tarball of imageID in the cache, replacing the
+// tarball of a previous image with the same reference
+func (u *Uploader) addToCache(imageID, tarballPath string) error {
+	if err := utils.EnsureDir(u.cacheDir()); err != nil {
+		return fmt.Errorf("failed to create tarball cache directory: %w", err)
+	}
+
+	index, err := u.loadCacheIndex()
+	if err != nil {
+		return err
+	}
+
+	file := strings.TrimPrefix(imageID, "sha256:") + ".tar"
+	if err := linkOrCopy(tarballPath, filepath.Join(u.cacheDir(), file)); err != nil {
+		return fmt.Errorf("failed to cache tarball: %w", err)
+	}
+
+	// The image changed, so the old tarball is stale
+	ref := u.config.ImageRef()
+	if old, ok := index.Entries[ref]; ok && old.File != file {
+		if err := os.Remove(filepath.Join(u.cacheDir(), old.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			u.logger.Warn("Failed to remove stale cached tarball %s: %v", old.File, err)
+		}
+	}
+
+	index.Entries[ref] = cacheEntry{ImageID: imageID, File: file, CreatedAt: time.Now(), SaveArgs: u.config.SaveArgs}
+	return u.saveCacheIndex(index)
+}
+
+// linkOrCopy hard links src to dst, copying it when linking is not
+// possible, e.g. across file systems. An existing dst is replaced.
+func linkOrCopy(src, dst string) error {
+	os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
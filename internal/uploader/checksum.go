@@ -0,0 +1,91 @@
+package uploader
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/storage"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// checksumName returns the name of the remote object recording the
+// checksum of the last tarball uploaded for this image and tag. It is not
+// a tarball, so the watcher ignores it.
+func (u *Uploader) checksumName() string {
+	return fmt.Sprintf("%s_%s.sha256", u.config.ImageName, u.config.ImageLabel())
+}
+
+// remoteChecksum returns the checksum recorded on the remote by the last
+// upload, or "" if there is none
+func (u *Uploader) remoteChecksum(store storage.Storage) (string, error) {
+	names, err := store.List()
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote files: %w", err)
+	}
+	if !slices.Contains(names, u.checksumName()) {
+		return "", nil
+	}
+
+	r, err := store.Get(u.checksumName())
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	content, err := io.ReadAll(io.LimitReader(r, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to read remote checksum: %w", err)
+	}
+
+	// Same format as sha256sum: "<hash>  <file name>"
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+// recordChecksum stores the checksum of the uploaded tarball on the remote
+func (u *Uploader) recordChecksum(store storage.Storage, checksum, tarballPath string) error {
+	content := fmt.Sprintf("%s  %s\n", checksum, filepath.Base(tarballPath))
+	if err := store.Put(u.checksumName(), strings.NewReader(content), int64(len(content))); err != nil {
+		return fmt.Errorf("failed to record checksum: %w", err)
+	}
+	return nil
+}
+
+// putChecksumFile uploads the checksum file of a tarball, so the watcher
+// can tell a complete tarball from a truncated one. It goes ahead of the
+// tarball to be in place when the watcher sees it.
+func (u *Uploader) putChecksumFile(store storage.Storage, checksum, tarballPath string) error {
+	if checksum == "" {
+		var err error
+		if checksum, err = utils.FileChecksum(tarballPath); err != nil {
+			return fmt.Errorf("failed to hash tarball: %w", err)
+		}
+	}
+
+	content := fmt.Sprintf("%s  %s\n", checksum, filepath.Base(tarballPath))
+	if err := store.Put(filepath.Base(tarballPath)+imagetar.ChecksumSuffix, strings.NewReader(content), int64(len(content))); err != nil {
+		return fmt.Errorf("failed to upload checksum file: %w", err)
+	}
+	return nil
+}
+
+// unchangedOnRemote reports whether the last upload of this image and tag
+// had the same content as tarballPath. It returns the local checksum, to
+// be recorded once the tarball is uploaded.
+func (u *Uploader) unchangedOnRemote(store storage.Storage, tarballPath string) (bool, string, error) {
+	checksum, err := utils.FileChecksum(tarballPath)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to hash tarball: %w", err)
+	}
+	remote, err := u.remoteChecksum(store)
+	if err != nil {
+		return false, "", err
+	}
+	return remote == checksum, checksum, nil
+}
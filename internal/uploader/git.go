@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// checkoutGitRepo fetches git_ref of git_repo, without history, into a new
+// temporary directory and returns it. The caller removes the directory.
+func (u *Uploader) checkoutGitRepo() (string, error) {
+	ref := u.config.GitRef
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	env, err := u.gitEnv()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "fws-git-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create checkout directory: %w", err)
+	}
+
+	u.logger.Info("Fetching %s from %s", ref, u.config.GitRepo)
+	// Fetching a single ref also works for commits, which git clone --branch rejects
+	steps := []string{
+		fmt.Sprintf("git init -q %s", utils.ShellQuote(dir)),
+		fmt.Sprintf("git -C %s fetch -q --depth 1 %s %s", utils.ShellQuote(dir), utils.ShellQuote(u.config.GitRepo), utils.ShellQuote(ref)),
+		fmt.Sprintf("git -C %s checkout -q --detach FETCH_HEAD", utils.ShellQuote(dir)),
+	}
+	for _, step := range steps {
+		if _, err := utils.ExecuteCommandWithEnv(u.ctx, step, env, 10*time.Minute); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("failed to fetch %s from git_repo: %w", ref, err)
+		}
+	}
+
+	if commit, err := utils.ExecuteCommand(u.ctx, fmt.Sprintf("git -C %s rev-parse HEAD", utils.ShellQuote(dir)), 10*time.Second); err == nil {
+		u.logger.Info("Building from commit %s", strings.TrimSpace(commit))
+	}
+	return dir, nil
+}
+
+// gitEnv returns the environment passing git_auth to git. The token goes
+// into an HTTP header set through the environment, so it does not appear
+// in the command line or the checkout's config.
+func (u *Uploader) gitEnv() ([]string, error) {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	auth := u.config.GitAuth
+	if auth.SSHKey != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+utils.ShellQuote(auth.SSHKey)+" -o IdentitiesOnly=yes")
+	}
+	if auth.TokenEnv != "" {
+		token := os.Getenv(auth.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable %s of git_auth.token_env is not set", auth.TokenEnv)
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+	return env, nil
+}
@@ -0,0 +1,90 @@
+package uploader
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/storage"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// incrementalUpload uploads the layers of the tarball that are not yet in
+// the remote blob directory, followed by a slim tarball that references
+// them. The watcher reassembles the full image archive before loading it.
+func (u *Uploader) incrementalUpload(store, blobs storage.Storage, tarballPath string) error {
+	layers, err := imagetar.ScanLayers(tarballPath)
+	if err != nil {
+		return err
+	}
+
+	names, err := blobs.List()
+	if err != nil {
+		return fmt.Errorf("failed to list remote blobs: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	// Work out which layers still have to be sent
+	missing := make(map[string]bool)
+	digests := make(map[string]string)
+	var skippedBytes int64
+	for _, layer := range layers {
+		if existing[layer.Digest] {
+			skippedBytes += layer.Size
+			continue
+		}
+		missing[layer.Name] = true
+		digests[layer.Name] = layer.Digest
+	}
+
+	u.logger.Info("Incremental upload: %d of %d layers already on remote (%s skipped)",
+		len(layers)-len(missing), len(layers), utils.FormatBytes(skippedBytes))
+
+	// Upload missing layers as blobs named by digest
+	sent := make(map[string]bool)
+	err = imagetar.EachLayer(tarballPath, missing, func(hdr *tar.Header, r io.Reader) error {
+		digest := digests[hdr.Name]
+		if sent[digest] {
+			return nil
+		}
+
+		u.logger.Debug("Uploading layer blob sha256:%s (%s)", digest, utils.FormatBytes(hdr.Size))
+		if err := blobs.Put(digest, r, hdr.Size); err != nil {
+			return fmt.Errorf("failed to upload layer blob: %w", err)
+		}
+
+		sent[digest] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Upload the slim tarball last so the watcher only sees it once all
+	// blobs are in place
+	slimPath := tarballPath + ".slim"
+	defer os.Remove(slimPath)
+	if err := imagetar.WriteSlim(tarballPath, slimPath, layers); err != nil {
+		return err
+	}
+
+	slim, err := os.Open(slimPath)
+	if err != nil {
+		return fmt.Errorf("failed to open slim tarball: %w", err)
+	}
+	defer slim.Close()
+
+	info, err := slim.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get slim tarball info: %w", err)
+	}
+
+	u.logger.Info("Uploading slim tarball (%s)", utils.FormatBytes(info.Size()))
+	return store.Put(filepath.Base(tarballPath), slim, info.Size())
+}
@@ -0,0 +1,63 @@
+package uploader
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keepAliveMaxMissed is how many keepalives may go unanswered before the
+// connection is considered dead, like ssh's ServerAliveCountMax
+const keepAliveMaxMissed = 3
+
+// keepAlive sends keepalive requests over client every ssh_keepalive_interval
+// so firewalls and NAT gateways do not drop the connection during long
+// transfers. A server that stops answering is disconnected, failing the
+// upload instead of letting it hang. The returned function stops sending.
+func (u *Uploader) keepAlive(client *ssh.Client) func() {
+	interval := u.config.SSHKeepAliveInterval.Duration()
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		missed := 0
+		replies := make(chan error, 1)
+		pending := false
+		for {
+			select {
+			case <-done:
+				return
+			case err := <-replies:
+				pending = false
+				if err != nil {
+					u.logger.Debug("SSH keepalive failed, stopping keepalives: %v", err)
+					return
+				}
+				missed = 0
+			case <-ticker.C:
+				if pending {
+					missed++
+					if missed >= keepAliveMaxMissed {
+						u.logger.Warn("SSH server did not answer %d keepalives, closing the connection", missed)
+						client.Close()
+						return
+					}
+					continue
+				}
+				pending = true
+				go func() {
+					// Servers may reject the request; any reply shows the
+					// connection is alive
+					_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+					replies <- err
+				}()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
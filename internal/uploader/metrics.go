@@ -0,0 +1,67 @@
+package uploader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/metrics"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// runMetrics describes a single uploader run
+type runMetrics struct {
+	Timestamp      string  `json:"timestamp"`
+	Image          string  `json:"image"`
+	Tarball        string  `json:"tarball"`
+	TarballBytes   int64   `json:"tarball_bytes"`
+	UploadSeconds  float64 `json:"upload_seconds"`
+	UploadBytesSec float64 `json:"upload_bytes_per_second"`
+}
+
+// reportMetrics logs a summary of the run and sends it to the configured sink
+func (u *Uploader) reportMetrics(m runMetrics) {
+	if m.UploadSeconds > 0 {
+		m.UploadBytesSec = float64(m.TarballBytes) / m.UploadSeconds
+	}
+
+	u.logger.Info("Run summary: tarball %s, upload took %v (%s/s)",
+		utils.FormatBytes(m.TarballBytes),
+		time.Duration(m.UploadSeconds*float64(time.Second)).Round(time.Millisecond),
+		utils.FormatBytes(int64(m.UploadBytesSec)))
+
+	var err error
+	switch u.config.MetricsSink {
+	case "file":
+		err = appendMetricsFile(u.config.MetricsFile, m)
+	case "pushgateway":
+		err = pushMetrics(u.config.PushgatewayURL, m)
+	}
+	if err != nil {
+		u.logger.Warn("Failed to record metrics: %v", err)
+	}
+}
+
+// appendMetricsFile appends the run as a JSON line so history accumulates
+func appendMetricsFile(path string, m runMetrics) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open metrics file: %w", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(m); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+func pushMetrics(gatewayURL string, m runMetrics) error {
+	reg := metrics.NewRegistry()
+	reg.Set("fws_uploader_tarball_bytes", "Size of the uploaded tarball in bytes.", float64(m.TarballBytes))
+	reg.Set("fws_uploader_upload_duration_seconds", "Time spent uploading the tarball.", m.UploadSeconds)
+	reg.Set("fws_uploader_last_success_timestamp_seconds", "Unix time of the last successful upload.", float64(time.Now().Unix()))
+
+	return reg.Push(gatewayURL, "fws_uploader", m.Image)
+}
@@ -0,0 +1,165 @@
+package uploader
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/storage"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// pruneRemoteTarballs removes all but the newest RemoteKeepTarballs
+// tarballs of this image from the remote upload directory. Tarballs are
+// ordered by the timestamp in their file name; files of other images and
+// files without a timestamp are left alone. Checksum files go with their
+// tarballs.
+func (u *Uploader) pruneRemoteTarballs(store storage.Storage) error {
+	names, err := store.List()
+	if err != nil {
+		return fmt.Errorf("failed to list remote tarballs: %w", err)
+	}
+
+	type tarball struct {
+		name      string
+		timestamp string
+	}
+
+	prefix := u.config.ImageName + "_"
+	var tarballs []tarball
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		timestamp := imagetar.NameTimestamp(name)
+		if timestamp == "" {
+			continue
+		}
+		tarballs = append(tarballs, tarball{name: name, timestamp: timestamp})
+	}
+
+	if len(tarballs) <= u.config.RemoteKeepTarballs {
+		return nil
+	}
+
+	// Newest first
+	sort.Slice(tarballs, func(i, j int) bool {
+		return tarballs[i].timestamp > tarballs[j].timestamp
+	})
+
+	for _, t := range tarballs[u.config.RemoteKeepTarballs:] {
+		u.logger.Info("Pruning old remote tarball: %s", t.name)
+		if err := store.Delete(t.name); err != nil {
+			return err
+		}
+		if checksumFile := t.name + imagetar.ChecksumSuffix; slices.Contains(names, checksumFile) {
+			if err := store.Delete(checksumFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// imageLabel marks images built by fws with their image name, so builds
+// that lost their tag to a newer build can still be found for pruning
+const imageLabel = "fws.image"
+
+// localImage is an image of this repository in the local image store
+type localImage struct {
+	id      string
+	refs    []string // repo:tag references of this image name
+	created time.Time
+}
+
+// pruneLocalImages removes all but the newest LocalKeepImages images of
+// this image name from the local image store. The image just uploaded is
+// always kept. Images still used by containers cannot be removed and are
+// skipped with a warning.
+func (u *Uploader) pruneLocalImages() error {
+	currentID, err := u.imageID()
+	if err != nil {
+		return err
+	}
+
+	images, err := u.listLocalImages()
+	if err != nil {
+		return err
+	}
+
+	// Newest first
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].created.After(images[j].created)
+	})
+
+	kept := 1 // The current image
+	for _, image := range images {
+		if image.id == currentID {
+			continue
+		}
+		if kept < u.config.LocalKeepImages {
+			kept++
+			continue
+		}
+
+		targets := image.refs
+		if len(targets) == 0 {
+			targets = []string{image.id}
+		}
+		u.logger.Info("Pruning old local image: %s", strings.Join(targets, ", "))
+		if output, err := utils.ExecuteCommand(u.ctx, "docker rmi "+strings.Join(targets, " "), time.Minute); err != nil {
+			u.logger.Warn("Failed to remove image %s: %s", image.id, strings.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+// listLocalImages returns the tagged images of this image name and the
+// images fws built for it that have since lost their tag
+func (u *Uploader) listLocalImages() ([]localImage, error) {
+	format := `--no-trunc --format '{{.ID}}\t{{.Repository}}\t{{.Tag}}\t{{.CreatedAt}}'`
+	byID := make(map[string]*localImage)
+	for _, filter := range []string{
+		utils.ShellQuote(u.config.ImageName),
+		"--filter " + utils.ShellQuote("label="+imageLabel+"="+u.config.ImageName),
+	} {
+		output, err := utils.ExecuteCommand(u.ctx, fmt.Sprintf("docker images %s %s", format, filter), 30*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list local images: %w", err)
+		}
+
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			fields := strings.Split(line, "\t")
+			if len(fields) != 4 {
+				continue
+			}
+			id, repo, tag := fields[0], fields[1], fields[2]
+
+			image, ok := byID[id]
+			if !ok {
+				created, err := time.Parse("2006-01-02 15:04:05 -0700 MST", fields[3])
+				if err != nil {
+					u.logger.Debug("Skipping image %s with unknown creation time %q", id, fields[3])
+					continue
+				}
+				image = &localImage{id: id, created: created}
+				byID[id] = image
+			}
+
+			ref := repo + ":" + tag
+			if repo == u.config.ImageName && tag != "<none>" && !slices.Contains(image.refs, ref) {
+				image.refs = append(image.refs, ref)
+			}
+		}
+	}
+
+	images := make([]localImage, 0, len(byID))
+	for _, image := range byID {
+		images = append(images, *image)
+	}
+	return images, nil
+}
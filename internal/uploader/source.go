@@ -0,0 +1,123 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchSource runs the uploader workflow, then again whenever the source
+// directory changed and stayed quiet for source_debounce, until ctx is
+// canceled. A failed run is logged and the next change tried again.
+// Changes made during a run, including by pre-build commands, lead to
+// another run.
+func (u *Uploader) WatchSource(ctx context.Context) error {
+	dir, err := filepath.Abs(u.config.SourcePath())
+	if err != nil {
+		return fmt.Errorf("failed to resolve source directory: %w", err)
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create source watcher: %w", err)
+	}
+	defer fw.Close()
+
+	if err := u.watchSourceTree(fw, dir); err != nil {
+		return err
+	}
+	u.logger.Info("Watching %s for changes", dir)
+
+	u.runForSource(ctx)
+
+	var rebuild <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			u.logger.Info("Source watcher stopped")
+			return nil
+		case event, ok := <-fw.Events:
+			if !ok {
+				return fmt.Errorf("source watcher events channel closed")
+			}
+			if event.Op == fsnotify.Chmod || u.ignoreSource(event.Name) {
+				continue
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := u.watchSourceTree(fw, event.Name); err != nil {
+						u.logger.Warn("%v", err)
+					}
+				}
+			}
+			u.logger.Debug("Source change: %s %s", event.Op, event.Name)
+			rebuild = time.After(u.config.SourceDebounce.Duration())
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return fmt.Errorf("source watcher errors channel closed")
+			}
+			u.logger.Warn("Source watcher error: %v", err)
+		case <-rebuild:
+			rebuild = nil
+			u.logger.Info("Source changed, rebuilding")
+			u.runForSource(ctx)
+		}
+	}
+}
+
+// runForSource runs the uploader workflow for a source change
+func (u *Uploader) runForSource(ctx context.Context) {
+	if err := u.Run(ctx); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		u.logger.Error("Build and upload failed, waiting for the next change: %v", err)
+	}
+}
+
+// watchSourceTree watches dir and its subdirectories, skipping ignored ones
+func (u *Uploader) watchSourceTree(fw *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to walk source directory: %w", err)
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if u.ignoreSource(path) {
+			return filepath.SkipDir
+		}
+		if err := fw.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// ignoreSource reports whether changes to path should not cause a rebuild:
+// version control metadata and the tarballs fws writes itself
+func (u *Uploader) ignoreSource(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".git" || part == ".hg" || part == ".svn" {
+			return true
+		}
+	}
+
+	if u.config.TarballPath != "" {
+		if tarballDir, err := filepath.Abs(u.config.TarballPath); err == nil {
+			if path == tarballDir || strings.HasPrefix(path, tarballDir+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+
+	// Tarballs saved into the source directory, while written or compressed
+	name := filepath.Base(path)
+	return strings.HasSuffix(name, ".tar") || strings.Contains(name, ".tar.")
+}
@@ -0,0 +1,189 @@
+package uploader
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// authMethods returns the SSH authentication methods to try, in order:
+// public key with remote_key_path and then the ssh-agent keys, then
+// remote_password. The method the server accepted is stored in used. The
+// returned function closes the agent connection once the handshake is
+// done.
+func (u *Uploader) authMethods(used *string) ([]ssh.AuthMethod, func(), error) {
+	var signers []ssh.Signer
+	closeAgent := func() {}
+
+	if u.config.RemoteKeyPath != "" {
+		if err := u.checkKeyPermissions(); err != nil {
+			return nil, nil, err
+		}
+
+		key, err := os.ReadFile(u.config.RemoteKeyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+
+		signer, err := u.parsePrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		u.sshDebug("loaded private key %s: %s %s", u.config.RemoteKeyPath, signer.PublicKey().Type(), ssh.FingerprintSHA256(signer.PublicKey()))
+		signers = append(signers, u.trackSigner(signer, u.config.RemoteKeyPath, used))
+	}
+
+	if u.config.UseSSHAgent {
+		agentSigners, conn, err := agentSigners()
+		if err != nil {
+			u.logger.Warn("Not using ssh-agent: %v", err)
+		} else {
+			closeAgent = func() { conn.Close() }
+			u.sshDebug("ssh-agent holds %d keys", len(agentSigners))
+			for _, signer := range agentSigners {
+				signers = append(signers, u.trackSigner(signer, "ssh-agent", used))
+			}
+		}
+	}
+
+	// The client tries every method only once, so all keys go into one
+	var auth []ssh.AuthMethod
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			for _, signer := range signers {
+				u.sshDebug("offering public key %s", ssh.FingerprintSHA256(signer.PublicKey()))
+			}
+			return signers, nil
+		}))
+	}
+	if u.config.RemotePassword != "" {
+		auth = append(auth, ssh.PasswordCallback(func() (string, error) {
+			u.sshDebug("trying password authentication")
+			*used = "password"
+			return u.config.RemotePassword, nil
+		}))
+	}
+	return auth, closeAgent, nil
+}
+
+// keyPassphraseEnv names the environment variable holding the passphrase
+// of remote_key_path if remote_key_passphrase is not set
+const keyPassphraseEnv = "FWS_KEY_PASSPHRASE"
+
+// parsePrivateKey parses remote_key_path, decrypting it with the
+// configured passphrase if it is protected by one
+func (u *Uploader) parsePrivateKey(key []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return signer, nil
+	}
+
+	passphrase := u.config.RemoteKeyPassphrase
+	if passphrase == "" {
+		passphrase = os.Getenv(keyPassphraseEnv)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("private key %s is protected by a passphrase: set remote_key_passphrase or %s", u.config.RemoteKeyPath, keyPassphraseEnv)
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, fmt.Errorf("failed to decrypt private key %s: wrong passphrase", u.config.RemoteKeyPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+	u.sshDebug("decrypted private key %s", u.config.RemoteKeyPath)
+	return signer, nil
+}
+
+// agentSigners returns the keys of the ssh-agent at SSH_AUTH_SOCK, and the
+// connection their signatures go through
+func agentSigners() ([]ssh.Signer, net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	return signers, conn, nil
+}
+
+// trackSigner wraps a key so signing with it, which the client only does
+// once the server accepted the key, is recorded in used
+func (u *Uploader) trackSigner(signer ssh.Signer, source string, used *string) ssh.Signer {
+	accepted := func() {
+		fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+		u.sshDebug("server accepted public key %s, signing authentication request", fingerprint)
+		*used = fmt.Sprintf("public key %s (%s)", fingerprint, source)
+	}
+
+	// RSA keys need SignWithAlgorithm for rsa-sha2 signatures
+	if as, ok := signer.(ssh.AlgorithmSigner); ok {
+		return trackedAlgorithmSigner{AlgorithmSigner: as, accepted: accepted}
+	}
+	return trackedSigner{Signer: signer, accepted: accepted}
+}
+
+type trackedSigner struct {
+	ssh.Signer
+	accepted func()
+}
+
+func (s trackedSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.accepted()
+	return s.Signer.Sign(rand, data)
+}
+
+type trackedAlgorithmSigner struct {
+	ssh.AlgorithmSigner
+	accepted func()
+}
+
+func (s trackedAlgorithmSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.accepted()
+	return s.AlgorithmSigner.Sign(rand, data)
+}
+
+func (s trackedAlgorithmSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.accepted()
+	return s.AlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+// describeAuth lists the authentication methods that will be tried
+func (u *Uploader) describeAuth() string {
+	var methods []string
+	if u.config.RemoteKeyPath != "" {
+		methods = append(methods, fmt.Sprintf("publickey (%s)", u.config.RemoteKeyPath))
+	}
+	if u.config.UseSSHAgent {
+		methods = append(methods, "publickey (ssh-agent)")
+	}
+	if u.config.RemotePassword != "" {
+		methods = append(methods, "password")
+	}
+	if len(methods) == 0 {
+		return "none (no remote_key_path, use_ssh_agent or remote_password configured)"
+	}
+	return strings.Join(methods, ", ")
+}
@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshDebug logs details of the SSH connection setup when ssh_debug is set
+func (u *Uploader) sshDebug(format string, args ...interface{}) {
+	if u.config.SSHDebug {
+		u.logger.Debug("ssh: "+format, args...)
+	}
+}
+
+// debugHostKey wraps a host key callback to log the key the server
+// presented and whether it was accepted
+func (u *Uploader) debugHostKey(callback ssh.HostKeyCallback, source string) ssh.HostKeyCallback {
+	if !u.config.SSHDebug {
+		return callback
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		u.sshDebug("server %s (%s) presented host key %s %s", hostname, remote, key.Type(), ssh.FingerprintSHA256(key))
+		err := callback(hostname, remote, key)
+		if err != nil {
+			u.sshDebug("host key rejected by %s: %v", source, err)
+		} else {
+			u.sshDebug("host key accepted by %s", source)
+		}
+		return err
+	}
+}
+
+// dialSSH connects to addr, logging the TCP connection and the SSH
+// handshake separately so network and authentication problems can be told
+// apart
+func (u *Uploader) dialSSH(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if u.config.SSHDebug {
+		config.BannerCallback = func(message string) error {
+			u.sshDebug("server banner: %s", strings.TrimSpace(message))
+			return nil
+		}
+	}
+
+	u.sshDebug("connecting to %s as %s", addr, config.User)
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+	if err != nil {
+		u.sshDebug("TCP connection failed after %v: %v", time.Since(start).Round(time.Millisecond), err)
+		return nil, err
+	}
+	u.sshDebug("TCP connection established in %v", time.Since(start).Round(time.Millisecond))
+
+	// Bound the handshake by the same timeout as the dial
+	if config.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(config.Timeout))
+	}
+	start = time.Now()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		u.sshDebug("handshake failed after %v: %v", time.Since(start).Round(time.Millisecond), err)
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	u.sshDebug("handshake completed in %v, server version %q, client version %q",
+		time.Since(start).Round(time.Millisecond), c.ServerVersion(), c.ClientVersion())
+	return ssh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/storage"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// stdinImage returns the image archive piped into fws, failing early when
+// stdin is a terminal or empty rather than uploading an empty tarball
+func stdinImage() (io.Reader, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return nil, fmt.Errorf("stdin is a terminal or device, pipe an image archive into fws, e.g. docker save myapp | fws --image-from-stdin")
+	}
+
+	r := bufio.NewReaderSize(os.Stdin, 1<<20)
+	if _, err := r.Peek(1); err != nil {
+		return nil, fmt.Errorf("no image archive on stdin: %w", err)
+	}
+	return r, nil
+}
+
+// saveStdinTarball writes the image archive from stdin to tarballPath
+func (u *Uploader) saveStdinTarball(tarballPath string) error {
+	u.logger.Info("Reading image archive from stdin")
+
+	r, err := stdinImage()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(tarballPath)
+	if err != nil {
+		return fmt.Errorf("failed to create tarball: %w", err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(tarballPath)
+		return fmt.Errorf("failed to read image archive from stdin: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tarballPath)
+		return fmt.Errorf("failed to write tarball: %w", err)
+	}
+
+	// Catch anything that is not a docker save archive before uploading it
+	if _, err := imagetar.ReadRepoTags(tarballPath); err != nil {
+		os.Remove(tarballPath)
+		return fmt.Errorf("stdin is not a docker save archive: %w", err)
+	}
+	return nil
+}
+
+// streamStdin stores the image archive from stdin under name and returns
+// the number of bytes transferred
+func (u *Uploader) streamStdin(store storage.Storage, name string) (int64, error) {
+	r, err := stdinImage()
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingReader{r: r}
+	if err := store.Put(name, counter, -1); err != nil {
+		return 0, err
+	}
+	u.logger.Debug("Streamed %s from stdin", utils.FormatBytes(counter.n))
+	return counter.n, nil
+}
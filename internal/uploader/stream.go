@@ -0,0 +1,119 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/storage"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamUpload pipes docker save straight into the storage backend without
+// writing a local tarball. The storage only makes the tarball visible once
+// docker save succeeded, so the watcher never sees a truncated tarball.
+func (u *Uploader) streamUpload() error {
+	tarballName := u.tarballName()
+
+	if u.config.ImageFromStdin {
+		u.logger.Info("Streaming image archive from stdin to %s", u.destination())
+	} else {
+		u.logger.Info("Streaming image %s to %s", u.config.ImageRef(), u.destination())
+	}
+
+	store, closeStore, err := u.openStorage()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	start := time.Now()
+	var size int64
+	if u.config.ImageFromStdin {
+		size, err = u.streamStdin(store, tarballName)
+	} else {
+		size, err = u.streamSave(store, tarballName)
+	}
+	if err != nil {
+		return err
+	}
+	duration := time.Since(start)
+
+	u.logger.Info("Tarball streamed successfully (%s)", utils.FormatBytes(size))
+
+	// Prune old tarballs left in the remote upload directory
+	if u.config.RemoteKeepTarballs > 0 {
+		if err := u.pruneRemoteTarballs(store); err != nil {
+			u.logger.Warn("Failed to prune remote tarballs: %v", err)
+		}
+	}
+
+	u.reportMetrics(runMetrics{
+		Timestamp:     utils.GetTimestamp(),
+		Image:         u.config.ImageRef(),
+		Tarball:       tarballName,
+		TarballBytes:  size,
+		UploadSeconds: duration.Seconds(),
+	})
+	return nil
+}
+
+// streamSave stores the output of docker save under name and returns the
+// number of bytes transferred
+func (u *Uploader) streamSave(store storage.Storage, name string) (int64, error) {
+	ctx, cancel := context.WithTimeout(u.ctx, 10*time.Minute)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	var saveErr bytes.Buffer
+	args := append([]string{"save"}, u.config.SaveArgs...)
+	save := exec.CommandContext(ctx, "docker", append(args, u.config.ImageRef())...)
+	save.Stdout = pw
+	save.Stderr = &saveErr
+
+	runErr := make(chan error, 1)
+	go func() {
+		err := save.Run()
+		if err != nil {
+			// Abort the upload so the partial tarball is discarded
+			err = fmt.Errorf("docker save failed: %s, output: %s", err.Error(), utils.TruncateOutput(strings.TrimSpace(saveErr.String())))
+		}
+		pw.CloseWithError(err)
+		runErr <- err
+	}()
+
+	counter := &countingReader{r: pr}
+	putErr := store.Put(name, counter, -1)
+	pr.Close()
+	saveResult := <-runErr
+
+	if err := u.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("docker save canceled: %w", err)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return 0, fmt.Errorf("docker save timed out after %v", 10*time.Minute)
+	}
+	if saveResult != nil {
+		return 0, saveResult
+	}
+	if putErr != nil {
+		return 0, putErr
+	}
+	return counter.n, nil
+}
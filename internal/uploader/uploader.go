@@ -1,8 +1,8 @@
 package uploader
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,81 +12,241 @@ import (
 	"golang.org/x/crypto/ssh/knownhosts"
 
 	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/storage"
+	"github.com/ahsanumar/fws/internal/tracing"
 	"github.com/ahsanumar/fws/internal/utils"
 )
 
 type Uploader struct {
 	config *config.UploaderConfig
 	logger *utils.Logger
+	tracer *tracing.Exporter // nil when tracing is not configured
+	ctx    context.Context   // Cancels the commands of the running workflow
 }
 
 func NewUploader(cfg *config.UploaderConfig, logger *utils.Logger) *Uploader {
 	return &Uploader{
 		config: cfg,
 		logger: logger,
+		ctx:    context.Background(),
 	}
 }
 
-// Run executes the full uploader workflow
-func (u *Uploader) Run() error {
+// SetTracer sets the exporter runs are traced to
+func (u *Uploader) SetTracer(tracer *tracing.Exporter) {
+	u.tracer = tracer
+}
+
+// Run executes the full uploader workflow. Cancelling ctx kills the
+// commands it runs, such as docker build, and fails the run.
+func (u *Uploader) Run(ctx context.Context) error {
+	u.ctx = ctx
+
+	trace := &tracing.Span{Name: "upload", Start: time.Now(), Attributes: map[string]string{"fws.image": u.config.ImageRef()}}
+	err := u.run(trace)
+	trace.End = time.Now()
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	if err := u.tracer.Export(trace); err != nil {
+		u.logger.Warn("Failed to export trace: %v", err)
+	}
+	return err
+}
+
+// run executes the uploader workflow, recording each step in trace
+func (u *Uploader) run(trace *tracing.Span) error {
 	u.logger.Info("Starting uploader workflow...")
 
 	// Execute pre-build commands
-	if err := u.executePreBuildCommands(); err != nil {
+	if err := traceStep(trace, "pre_build", u.executePreBuildCommands); err != nil {
 		return fmt.Errorf("pre-build commands failed: %w", err)
 	}
 
 	// Build Docker image
-	if err := u.buildDockerImage(); err != nil {
+	if err := traceStep(trace, "build", u.buildDockerImage); err != nil {
 		return fmt.Errorf("docker build failed: %w", err)
 	}
 
-	// Create tarball
-	tarballPath, err := u.createTarball()
-	if err != nil {
-		return fmt.Errorf("tarball creation failed: %w", err)
+	// Only the upload is restricted to the upload windows
+	if err := u.waitForUploadWindow(); err != nil {
+		return err
 	}
 
-	// Upload tarball
-	if err := u.uploadTarball(tarballPath); err != nil {
-		return fmt.Errorf("upload failed: %w", err)
+	// Save and upload the image
+	var tarballPath string
+	err := traceStep(trace, "save_upload", func() error {
+		if u.config.StreamSaveToRemote {
+			// Pipe docker save straight to the remote host, skipping local disk.
+			// Stdin can only be read once, so that stream is not retried.
+			var err error
+			if u.config.ImageFromStdin {
+				err = u.streamUpload()
+			} else {
+				err = u.retry(u.streamUpload)
+			}
+			if err != nil {
+				return fmt.Errorf("streaming upload failed: %w", err)
+			}
+			return nil
+		}
+
+		var err error
+		tarballPath, err = u.saveAndUpload()
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
 	// Execute post-build commands
-	if err := u.executePostBuildCommands(); err != nil {
+	if err := traceStep(trace, "post_build", u.executePostBuildCommands); err != nil {
 		return fmt.Errorf("post-build commands failed: %w", err)
 	}
 
 	// Clean up local tarball
-	if err := u.cleanupTarball(tarballPath); err != nil {
-		u.logger.Warn("Failed to cleanup tarball: %v", err)
+	if tarballPath != "" {
+		if err := u.cleanupTarball(tarballPath); err != nil {
+			u.logger.Warn("Failed to cleanup tarball: %v", err)
+		}
+	}
+
+	// Remove old builds of the image
+	if u.config.LocalKeepImages > 0 {
+		if err := u.pruneLocalImages(); err != nil {
+			u.logger.Warn("Failed to prune local images: %v", err)
+		}
 	}
 
 	u.logger.Info("Uploader workflow completed successfully")
 	return nil
 }
 
+// traceStep runs one step of the workflow as a child span of trace
+func traceStep(trace *tracing.Span, name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	span := trace.Child(name, start, time.Now())
+	if err != nil {
+		span.Error = err.Error()
+	}
+	return err
+}
+
+// saveAndUpload saves the image to a local tarball and uploads it. It
+// returns the path of the local tarball.
+func (u *Uploader) saveAndUpload() (string, error) {
+	// Create tarball
+	tarballPath, err := u.createTarball()
+	if err != nil {
+		return "", fmt.Errorf("tarball creation failed: %w", err)
+	}
+
+	// Make sure the tarball holds the intended platform
+	if err := u.verifyPlatform(tarballPath); err != nil {
+		return "", fmt.Errorf("platform check failed: %w", err)
+	}
+
+	// Leave out the layers the watcher gets from the base image tarball
+	if u.config.BaseImage != "" {
+		if err := u.stripBaseLayers(tarballPath); err != nil {
+			return "", fmt.Errorf("base image layers could not be stripped: %w", err)
+		}
+	}
+
+	// Compress after the platform check, which reads the plain archive
+	if format := u.config.CompressionFormat(); format != "" {
+		if tarballPath, err = u.compressTarball(tarballPath, format); err != nil {
+			return "", fmt.Errorf("tarball compression failed: %w", err)
+		}
+	}
+
+	// Upload tarball
+	uploadStart := time.Now()
+	if err := u.retry(func() error { return u.uploadTarball(tarballPath) }); err != nil {
+		return "", fmt.Errorf("upload failed: %w", err)
+	}
+	uploadDuration := time.Since(uploadStart)
+
+	// Record run metrics before the tarball is removed
+	tarballSize, err := utils.GetFileSize(tarballPath)
+	if err != nil {
+		u.logger.Warn("Failed to get tarball size: %v", err)
+	}
+	u.reportMetrics(runMetrics{
+		Timestamp:     utils.GetTimestamp(),
+		Image:         u.config.ImageRef(),
+		Tarball:       filepath.Base(tarballPath),
+		TarballBytes:  tarballSize,
+		UploadSeconds: uploadDuration.Seconds(),
+	})
+
+	return tarballPath, nil
+}
+
+// retry runs fn with the configured retry policy, failing fast on errors
+// that are not transient
+func (u *Uploader) retry(fn func() error) error {
+	retry := u.config.Retry
+	classifier := utils.NewRetryClassifier(retry.RetryablePatterns, retry.NonRetryablePatterns)
+	return utils.Retry(retry.Attempts, retry.Delay.Duration(), classifier, u.logger, fn)
+}
+
 func (u *Uploader) executePreBuildCommands() error {
 	if len(u.config.PreBuildCommands) == 0 {
 		return nil
 	}
 
 	u.logger.Info("Executing pre-build commands...")
-	return utils.ExecuteCommands(u.config.PreBuildCommands, 5*time.Minute, u.logger)
+	return utils.ExecuteCommandsParallel(u.ctx, config.ShellCommands(u.config.PreBuildCommands), nil, u.config.PreBuildParallelism, 5*time.Minute, u.logger)
 }
 
 func (u *Uploader) buildDockerImage() error {
-	u.logger.Info("Building Docker image: %s:%s", u.config.ImageName, u.config.ImageTag)
+	if u.config.ImageFromStdin {
+		u.logger.Info("Image archive is read from stdin, skipping build")
+		return nil
+	}
+
+	// A digest names an existing image that docker build cannot produce
+	if u.config.ImageDigest != "" && u.config.BuildCommand == "" {
+		u.logger.Info("Image pinned by digest, skipping build: %s", u.config.ImageRef())
+		return nil
+	}
+
+	// Build a fresh checkout of git_repo, removed once the image is built
+	buildPath := u.config.DockerBuildPath
+	if u.config.GitRepo != "" {
+		dir, err := u.checkoutGitRepo()
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		checkout := *u.config
+		checkout.GitRepo = ""
+		checkout.DockerBuildPath = filepath.Join(dir, u.config.DockerBuildPath)
+		if err := checkout.CheckBuildContext(); err != nil {
+			return err
+		}
+		buildPath = checkout.DockerBuildPath
+	}
+
+	// Report a mistyped build context before docker build does
+	if err := u.config.CheckBuildContext(); err != nil {
+		return err
+	}
+
+	u.logger.Info("Building Docker image: %s", u.config.ImageRef())
 
 	var buildCmd string
 	if u.config.BuildCommand != "" {
 		buildCmd = u.config.BuildCommand
 	} else {
-		buildCmd = fmt.Sprintf("docker build -t %s:%s %s",
-			u.config.ImageName, u.config.ImageTag, u.config.DockerBuildPath)
+		buildCmd = fmt.Sprintf("docker build -t %s --label %s %s", u.config.ImageRef(), utils.ShellQuote(imageLabel+"="+u.config.ImageName), buildPath)
 	}
 
-	output, err := utils.ExecuteCommand(buildCmd, 15*time.Minute)
+	output, err := utils.ExecuteCommand(u.ctx, buildCmd, 15*time.Minute)
 	if err != nil {
 		return err
 	}
@@ -95,12 +255,26 @@ func (u *Uploader) buildDockerImage() error {
 	return nil
 }
 
+// tarballName generates the tarball file name, including a timestamp
+func (u *Uploader) tarballName() string {
+	timestamp := time.Now().Format(imagetar.TimestampFormat)
+	return fmt.Sprintf("%s_%s_%s.tar", u.config.ImageName, u.config.ImageLabel(), timestamp)
+}
+
+// saveArgs returns the docker save arguments: the configured save_args,
+// shell quoted, followed by the image
+func (u *Uploader) saveArgs() []string {
+	args := make([]string, 0, len(u.config.SaveArgs)+1)
+	for _, arg := range u.config.SaveArgs {
+		args = append(args, utils.ShellQuote(arg))
+	}
+	return append(args, u.config.ImageRef())
+}
+
 func (u *Uploader) createTarball() (string, error) {
-	u.logger.Info("Creating tarball for image: %s:%s", u.config.ImageName, u.config.ImageTag)
+	u.logger.Info("Creating tarball for image: %s", u.config.ImageRef())
 
-	// Generate tarball filename with timestamp
-	timestamp := time.Now().Format("20060102-150405")
-	tarballName := fmt.Sprintf("%s_%s_%s.tar", u.config.ImageName, u.config.ImageTag, timestamp)
+	tarballName := u.tarballName()
 
 	var tarballPath string
 	if u.config.TarballPath != "" {
@@ -112,16 +286,35 @@ func (u *Uploader) createTarball() (string, error) {
 		tarballPath = tarballName
 	}
 
-	// Save Docker image to tarball
-	saveCmd := fmt.Sprintf("docker save %s:%s -o %s",
-		u.config.ImageName, u.config.ImageTag, tarballPath)
-
-	output, err := utils.ExecuteCommand(saveCmd, 10*time.Minute)
-	if err != nil {
-		return "", err
+	// Reuse the saved tarball of an unchanged image
+	var imageID string
+	if u.config.CacheTarballs {
+		var err error
+		if imageID, err = u.imageID(); err != nil {
+			u.logger.Warn("Tarball cache disabled for this run: %v", err)
+		} else if hit, err := u.restoreFromCache(imageID, tarballPath); err != nil {
+			u.logger.Warn("Failed to use tarball cache: %v", err)
+		} else if hit {
+			u.logger.Info("Image %s unchanged (%s), reusing cached tarball: %s", u.config.ImageRef(), imageID, tarballPath)
+			return tarballPath, nil
+		}
 	}
 
-	u.logger.Debug("Docker save output: %s", strings.TrimSpace(output))
+	if u.config.ImageFromStdin {
+		if err := u.saveStdinTarball(tarballPath); err != nil {
+			return "", err
+		}
+	} else {
+		// Save Docker image to tarball
+		saveCmd := fmt.Sprintf("docker save %s -o %s", strings.Join(u.saveArgs(), " "), tarballPath)
+
+		output, err := utils.ExecuteCommand(u.ctx, saveCmd, 10*time.Minute)
+		if err != nil {
+			return "", err
+		}
+
+		u.logger.Debug("Docker save output: %s", strings.TrimSpace(output))
+	}
 
 	// Check if tarball was created successfully
 	if !utils.FileExists(tarballPath) {
@@ -136,55 +329,134 @@ func (u *Uploader) createTarball() (string, error) {
 		u.logger.Info("Tarball created: %s (%s)", tarballPath, utils.FormatBytes(size))
 	}
 
+	if u.config.CacheTarballs && imageID != "" {
+		if err := u.addToCache(imageID, tarballPath); err != nil {
+			u.logger.Warn("Failed to update tarball cache: %v", err)
+		}
+	}
+
 	return tarballPath, nil
 }
 
-func (u *Uploader) uploadTarball(tarballPath string) error {
-	u.logger.Info("Uploading tarball to %s@%s:%s", u.config.RemoteUser, u.config.RemoteHost, u.config.RemoteUploadPath)
+// verifyPlatform checks that every image in the tarball was built for the
+// configured platform
+func (u *Uploader) verifyPlatform(tarballPath string) error {
+	if u.config.Platform == "" {
+		return nil
+	}
 
-	// Create SSH client
-	client, err := u.createSSHClient()
+	images, err := imagetar.ReadImages(tarballPath)
 	if err != nil {
-		return fmt.Errorf("failed to create SSH client: %w", err)
+		return err
 	}
-	defer client.Close()
 
-	// Upload file using SCP
-	if err := u.scpUpload(client, tarballPath); err != nil {
-		return fmt.Errorf("SCP upload failed: %w", err)
+	for _, image := range images {
+		if !platformMatches(u.config.Platform, image.Platform()) {
+			return fmt.Errorf("tarball contains %s image %v, but platform %s is required",
+				image.Platform(), image.RepoTags, u.config.Platform)
+		}
 	}
 
-	u.logger.Info("Tarball uploaded successfully")
+	u.logger.Info("Tarball platform verified: %s", u.config.Platform)
 	return nil
 }
 
-func (u *Uploader) createSSHClient() (*ssh.Client, error) {
-	// Read private key
-	var auth []ssh.AuthMethod
-	if u.config.RemoteKeyPath != "" {
-		key, err := os.ReadFile(u.config.RemoteKeyPath)
+// platformMatches compares platforms, ignoring the variant if the wanted
+// platform does not specify one
+func platformMatches(want, got string) bool {
+	if want == got {
+		return true
+	}
+	return strings.Count(want, "/") == 1 && strings.HasPrefix(got, want+"/")
+}
+
+func (u *Uploader) uploadTarball(tarballPath string) error {
+	u.logger.Info("Uploading tarball to %s", u.destination())
+
+	store, closeStore, err := u.openStorage()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	// Skip tarballs identical to the last one uploaded
+	var checksum string
+	if u.config.SkipUploadIfUnchanged {
+		var unchanged bool
+		unchanged, checksum, err = u.unchangedOnRemote(store, tarballPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read private key: %w", err)
+			return err
 		}
+		if unchanged {
+			u.logger.Info("Tarball unchanged since the last upload (sha256 %s), skipping upload", checksum)
+			return nil
+		}
+	}
 
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key: %w", err)
+	if sshStore, ok := store.(*storage.SSH); ok && u.config.IncrementalUpload {
+		// Upload only the layers missing on the remote
+		blobs := sshStore.Sub(u.config.RemoteBlobPath())
+		if err := u.incrementalUpload(store, blobs, tarballPath); err != nil {
+			return fmt.Errorf("incremental upload failed: %w", err)
+		}
+	} else {
+		// The base image goes first, so it is in place when the watcher
+		// sees the tarball
+		if sshStore, ok := store.(*storage.SSH); ok && u.config.BaseImage != "" {
+			if err := u.uploadBaseTarball(sshStore.Sub(config.BaseDirName), tarballPath); err != nil {
+				return fmt.Errorf("base image upload failed: %w", err)
+			}
+		}
+		if u.config.ChecksumFile {
+			if err := u.putChecksumFile(store, checksum, tarballPath); err != nil {
+				return err
+			}
+		}
+		if err := u.putTarball(store, tarballPath); err != nil {
+			return err
 		}
+	}
+
+	u.logger.Info("Tarball uploaded successfully")
+
+	if checksum != "" {
+		if err := u.recordChecksum(store, checksum, tarballPath); err != nil {
+			u.logger.Warn("%v", err)
+		}
+	}
 
-		auth = append(auth, ssh.PublicKeys(signer))
+	// Prune old tarballs left in the remote upload directory
+	if u.config.RemoteKeepTarballs > 0 {
+		if err := u.pruneRemoteTarballs(store); err != nil {
+			u.logger.Warn("Failed to prune remote tarballs: %v", err)
+		}
 	}
 
+	return nil
+}
+
+func (u *Uploader) createSSHClient() (*ssh.Client, error) {
+	var usedAuth string
+	auth, closeAgent, err := u.authMethods(&usedAuth)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	u.sshDebug("authentication methods: %s", u.describeAuth())
+
 	// Setup host key callback
 	var hostKeyCallback ssh.HostKeyCallback
 	knownHostsFile := filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
-	if utils.FileExists(knownHostsFile) {
+	if fingerprint := u.config.RemoteHostKeyFingerprint; fingerprint != "" {
+		// A pinned fingerprint replaces known_hosts
+		hostKeyCallback = u.debugHostKey(storage.PinnedHostKey(fingerprint), "remote_host_key_fingerprint")
+	} else if utils.FileExists(knownHostsFile) {
 		hkc, err := knownhosts.New(knownHostsFile)
 		if err != nil {
 			u.logger.Warn("Failed to load known_hosts, using insecure connection: %v", err)
 			hostKeyCallback = ssh.InsecureIgnoreHostKey()
 		} else {
-			hostKeyCallback = hkc
+			hostKeyCallback = u.debugHostKey(hkc, knownHostsFile)
 		}
 	} else {
 		u.logger.Warn("known_hosts file not found, using insecure connection")
@@ -201,15 +473,42 @@ func (u *Uploader) createSSHClient() (*ssh.Client, error) {
 
 	// Connect to SSH server
 	addr := fmt.Sprintf("%s:%d", u.config.RemoteHost, u.config.RemotePort)
-	client, err := ssh.Dial("tcp", addr, config)
+	client, err := u.dialSSH(addr, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
 	}
+	u.logger.Debug("Authenticated to %s as %s with %s", addr, u.config.RemoteUser, usedAuth)
 
 	return client, nil
 }
 
-func (u *Uploader) scpUpload(client *ssh.Client, localPath string) error {
+// checkKeyPermissions makes sure the private key is not readable by other
+// users, which SSH servers and clients treat as a reason to reject it.
+// Loose permissions are an error with StrictKeyPermissions and a warning
+// otherwise.
+func (u *Uploader) checkKeyPermissions() error {
+	info, err := os.Stat(u.config.RemoteKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	perm := info.Mode().Perm()
+	if perm&0077 == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("private key %s has permissions %#o, which are too open; run 'chmod 600 %s'",
+		u.config.RemoteKeyPath, perm, u.config.RemoteKeyPath)
+	if u.config.StrictKeyPermissions {
+		return fmt.Errorf("%s", msg)
+	}
+
+	u.logger.Warn("%s", msg)
+	return nil
+}
+
+// putTarball uploads a local tarball to store under its file name
+func (u *Uploader) putTarball(store storage.Storage, localPath string) error {
 	// Open local file
 	localFile, err := os.Open(localPath)
 	if err != nil {
@@ -223,63 +522,38 @@ func (u *Uploader) scpUpload(client *ssh.Client, localPath string) error {
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// Create remote file path
-	fileName := filepath.Base(localPath)
-	remotePath := filepath.Join(u.config.RemoteUploadPath, fileName)
-
-	// Create SSH session
-	session, err := client.NewSession()
-	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %w", err)
-	}
-	defer session.Close()
-
-	// Create SCP command
-	scpCmd := fmt.Sprintf("scp -t %s", remotePath)
-
-	// Get stdin pipe
-	stdin, err := session.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to get stdin pipe: %w", err)
-	}
+	return store.Put(filepath.Base(localPath), localFile, fileInfo.Size())
+}
 
-	// Start SCP command
-	if err := session.Start(scpCmd); err != nil {
-		return fmt.Errorf("failed to start SCP command: %w", err)
+func (u *Uploader) executePostBuildCommands() error {
+	if len(u.config.PostBuildCommands) == 0 {
+		return nil
 	}
 
-	// Send file header
-	header := fmt.Sprintf("C%#o %d %s\n", fileInfo.Mode().Perm(), fileInfo.Size(), fileName)
-	if _, err := stdin.Write([]byte(header)); err != nil {
-		return fmt.Errorf("failed to send file header: %w", err)
-	}
+	u.logger.Info("Executing post-build commands...")
+	return utils.ExecuteCommandsParallel(u.ctx, config.ShellCommands(u.config.PostBuildCommands), nil, u.config.PostBuildParallelism, 5*time.Minute, u.logger)
+}
 
-	// Copy file content
-	if _, err := io.Copy(stdin, localFile); err != nil {
-		return fmt.Errorf("failed to copy file content: %w", err)
-	}
+// compressTarball replaces the tarball with a copy compressed with format
+// and returns its path
+func (u *Uploader) compressTarball(tarballPath, format string) (string, error) {
+	compressedPath := tarballPath + imagetar.CompressionExt(format)
+	u.logger.Info("Compressing tarball with %s: %s", format, compressedPath)
 
-	// Send end marker
-	if _, err := stdin.Write([]byte("\x00")); err != nil {
-		return fmt.Errorf("failed to send end marker: %w", err)
+	if err := imagetar.Compress(tarballPath, compressedPath, format); err != nil {
+		os.Remove(compressedPath)
+		return "", err
 	}
 
-	// Close stdin and wait for session to complete
-	stdin.Close()
-	if err := session.Wait(); err != nil {
-		return fmt.Errorf("SCP command failed: %w", err)
+	if size, err := utils.GetFileSize(compressedPath); err == nil {
+		u.logger.Info("Tarball compressed: %s (%s)", compressedPath, utils.FormatBytes(size))
 	}
 
-	return nil
-}
-
-func (u *Uploader) executePostBuildCommands() error {
-	if len(u.config.PostBuildCommands) == 0 {
-		return nil
+	// The tarball cache keeps its own link or copy
+	if err := os.Remove(tarballPath); err != nil {
+		u.logger.Warn("Failed to remove uncompressed tarball: %v", err)
 	}
-
-	u.logger.Info("Executing post-build commands...")
-	return utils.ExecuteCommands(u.config.PostBuildCommands, 5*time.Minute, u.logger)
+	return compressedPath, nil
 }
 
 func (u *Uploader) cleanupTarball(tarballPath string) error {
@@ -0,0 +1,46 @@
+package uploader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/config"
+)
+
+// waitForUploadWindow returns once an upload window is open. Outside the
+// windows it either waits for the next one to open or fails, depending on
+// WaitForWindow.
+func (u *Uploader) waitForUploadWindow() error {
+	if len(u.config.UploadWindows) == 0 {
+		return nil
+	}
+
+	windows := make([]config.TimeWindow, 0, len(u.config.UploadWindows))
+	for _, s := range u.config.UploadWindows {
+		window, err := config.ParseTimeWindow(s)
+		if err != nil {
+			return err
+		}
+		windows = append(windows, window)
+	}
+
+	now := time.Now()
+	var next time.Time
+	for _, window := range windows {
+		if window.Contains(now) {
+			return nil
+		}
+		if start := window.NextStart(now); next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+
+	if !u.config.WaitForWindow {
+		return fmt.Errorf("outside upload window %v; the next window opens at %s (use --wait to wait for it)",
+			u.config.UploadWindows, next.Format("2006-01-02 15:04"))
+	}
+
+	u.logger.Info("Outside upload window %v, waiting until %s", u.config.UploadWindows, next.Format("2006-01-02 15:04"))
+	time.Sleep(time.Until(next))
+	return nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// LogSampling limits how often the same debug message is logged. Within
+// each interval the first First messages of a template are logged, then
+// every Thereafter-th one (none if Thereafter is 0).
+type LogSampling struct {
+	First      int
+	Thereafter int
+	Interval   time.Duration
+}
+
+// sampler counts debug messages per format string
+type sampler struct {
+	opts   LogSampling
+	mu     sync.Mutex
+	counts map[string]*sampleCount
+}
+
+type sampleCount struct {
+	start   time.Time
+	n       int // Messages in the current interval
+	dropped int // Messages dropped since the last one logged
+}
+
+// allow reports whether a message with the given format should be logged
+// and how many were dropped since the last one that was
+func (s *sampler) allow(format string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	c, ok := s.counts[format]
+	if !ok {
+		c = &sampleCount{start: now}
+		s.counts[format] = c
+	}
+	if now.Sub(c.start) >= s.opts.Interval {
+		c.start = now
+		c.n = 0
+	}
+	c.n++
+
+	if c.n <= s.opts.First || (s.opts.Thereafter > 0 && (c.n-s.opts.First)%s.opts.Thereafter == 0) {
+		dropped := c.dropped
+		c.dropped = 0
+		return true, dropped
+	}
+	c.dropped++
+	return false, 0
+}
+
+// SetSampling samples debug messages, so high-frequency messages such as
+// per-event logs don't drown out the rest. Messages are grouped by their
+// format string, not their arguments.
+func (l *Logger) SetSampling(opts LogSampling) {
+	if opts.First <= 0 || opts.Interval <= 0 {
+		l.sampler = nil
+		return
+	}
+	l.sampler = &sampler{opts: opts, counts: make(map[string]*sampleCount)}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// outputLimit caps command output in log messages and errors
+var outputLimit struct {
+	mu        sync.Mutex
+	maxLength int    // 0 keeps all output
+	logFile   string // Receives the full output of truncated commands, may be empty
+}
+
+// SetOutputLimit caps log messages and the command output in errors at
+// maxLength bytes (0 keeps everything). With logFile, the full output of
+// commands whose output exceeds the cap is appended to it.
+func SetOutputLimit(maxLength int, logFile string) {
+	outputLimit.mu.Lock()
+	defer outputLimit.mu.Unlock()
+
+	outputLimit.maxLength = maxLength
+	outputLimit.logFile = logFile
+}
+
+// TruncateOutput shortens s to the configured cap, keeping its beginning
+// and end, where commands tend to report what they did and why they
+// failed
+func TruncateOutput(s string) string {
+	outputLimit.mu.Lock()
+	maxLength, logFile := outputLimit.maxLength, outputLimit.logFile
+	outputLimit.mu.Unlock()
+
+	if maxLength <= 0 || len(s) <= maxLength {
+		return s
+	}
+	marker := fmt.Sprintf(" ... [%d bytes truncated] ... ", len(s)-maxLength)
+	if logFile != "" {
+		marker = fmt.Sprintf(" ... [%d bytes truncated, full output in %s] ... ", len(s)-maxLength, logFile)
+	}
+	head := maxLength / 2
+	return s[:head] + marker + s[len(s)-(maxLength-head):]
+}
+
+// recordOutput appends the output of a command to the output log file if
+// it exceeds the cap, so TruncateOutput does not lose it
+func recordOutput(command, output string, exitCode int) {
+	outputLimit.mu.Lock()
+	defer outputLimit.mu.Unlock()
+
+	if outputLimit.logFile == "" || outputLimit.maxLength <= 0 || len(output) <= outputLimit.maxLength {
+		return
+	}
+
+	file, err := os.OpenFile(outputLimit.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("[WARN] Failed to open output log file: %v", err)
+		return
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "=== %s exit code %d: %s\n%s\n", time.Now().Format(time.RFC3339), exitCode, command, output)
+}
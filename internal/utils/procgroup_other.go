@@ -0,0 +1,14 @@
+//go:build !unix
+
+package utils
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killProcessGroup lets cancelling cmd stop waiting for the output of
+// processes the shell started; only the shell itself is killed
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = 5 * time.Second
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killProcessGroup makes cancelling cmd kill everything the shell started,
+// such as both sides of a pipeline, instead of only the shell itself
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Don't wait for output of processes that escaped the group
+	cmd.WaitDelay = 5 * time.Second
+}
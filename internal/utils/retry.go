@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CommandError is returned by ExecuteCommand when a command fails or times
+// out
+type CommandError struct {
+	Command  string
+	ExitCode int    // -1 if the command did not exit normally
+	Output   string // Combined stdout and stderr
+	TimedOut bool
+	Timeout  time.Duration
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	if errors.Is(e.Err, context.Canceled) {
+		return fmt.Sprintf("command canceled: %s", e.Command)
+	}
+	if e.TimedOut {
+		return fmt.Sprintf("command timed out after %v: %s", e.Timeout, e.Command)
+	}
+	return fmt.Sprintf("command failed: %s, output: %s", e.Err.Error(), TruncateOutput(e.Output))
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultNonRetryablePatterns are output fragments of deterministic
+// failures that will not go away by retrying
+var DefaultNonRetryablePatterns = []string{
+	"no such image",
+	"no such container",
+	"not found",
+	"invalid reference format",
+	"manifest unknown",
+	"permission denied",
+	"is already in use",
+	"invalid argument",
+}
+
+// DefaultRetryablePatterns are output fragments of transient failures
+var DefaultRetryablePatterns = []string{
+	"connection refused",
+	"connection reset",
+	"i/o timeout",
+	"tls handshake timeout",
+	"cannot connect to the docker daemon",
+	"resource temporarily unavailable",
+	"device or resource busy",
+	"too many requests",
+	"unexpected eof",
+}
+
+// RetryClassifier decides which errors are worth retrying. Patterns are
+// matched case-insensitively against the error and command output.
+type RetryClassifier struct {
+	Retryable    []string
+	NonRetryable []string
+}
+
+// NewRetryClassifier creates a classifier using the default patterns plus
+// the given extra ones
+func NewRetryClassifier(retryable, nonRetryable []string) *RetryClassifier {
+	return &RetryClassifier{
+		Retryable:    append(append([]string{}, DefaultRetryablePatterns...), retryable...),
+		NonRetryable: append(append([]string{}, DefaultNonRetryablePatterns...), nonRetryable...),
+	}
+}
+
+// IsRetryable reports whether err looks like a transient failure.
+// Timeouts and known transient patterns are retryable; commands that could
+// not be executed (exit codes 126 and 127), commands cancelled by shutdown
+// and known deterministic patterns are not. Anything else is retried.
+func (c *RetryClassifier) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Nothing is retried once shutdown has begun
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	text := strings.ToLower(err.Error())
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		if cmdErr.TimedOut {
+			return true
+		}
+		if cmdErr.ExitCode == 126 || cmdErr.ExitCode == 127 {
+			return false
+		}
+		text = strings.ToLower(cmdErr.Output) + "\n" + text
+	}
+
+	// Known transient failures win over broad deterministic patterns such
+	// as "not found"
+	for _, pattern := range c.Retryable {
+		if strings.Contains(text, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	for _, pattern := range c.NonRetryable {
+		if strings.Contains(text, strings.ToLower(pattern)) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsRetryable classifies err using the default patterns
+func IsRetryable(err error) bool {
+	return NewRetryClassifier(nil, nil).IsRetryable(err)
+}
+
+// Retry calls fn up to attempts times, waiting delay between attempts, as
+// long as classifier considers the error retryable. A nil classifier
+// retries every error but a cancelled command.
+func Retry(attempts int, delay time.Duration, classifier *RetryClassifier, logger *Logger, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if errors.Is(err, context.Canceled) || (classifier != nil && !classifier.IsRetryable(err)) {
+			logger.Debug("Not retrying, error is not transient: %v", err)
+			return err
+		}
+		if attempt < attempts {
+			logger.Warn("Attempt %d/%d failed, retrying in %v: %v", attempt, attempts, delay, err)
+			time.Sleep(delay)
+		}
+	}
+	return err
+}
@@ -2,16 +2,23 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Logger struct {
-	level string
+	level   string
+	sampler *sampler // Limits repeated debug messages, nil logs all
 }
 
 func NewLogger(level string) *Logger {
@@ -19,61 +26,168 @@ func NewLogger(level string) *Logger {
 }
 
 func (l *Logger) Debug(msg string, args ...interface{}) {
-	if l.level == "debug" {
-		log.Printf("[DEBUG] "+msg, args...)
+	if l.level != "debug" {
+		return
 	}
+	if l.sampler != nil {
+		ok, dropped := l.sampler.allow(msg)
+		if !ok {
+			return
+		}
+		if dropped > 0 {
+			printf("[DEBUG] "+msg+" (%d similar messages suppressed)", append(args, dropped)...)
+			return
+		}
+	}
+	printf("[DEBUG] "+msg, args...)
 }
 
 func (l *Logger) Info(msg string, args ...interface{}) {
 	if l.level == "debug" || l.level == "info" {
-		log.Printf("[INFO] "+msg, args...)
+		printf("[INFO] "+msg, args...)
 	}
 }
 
 func (l *Logger) Warn(msg string, args ...interface{}) {
 	if l.level == "debug" || l.level == "info" || l.level == "warn" {
-		log.Printf("[WARN] "+msg, args...)
+		printf("[WARN] "+msg, args...)
 	}
 }
 
 func (l *Logger) Error(msg string, args ...interface{}) {
-	log.Printf("[ERROR] "+msg, args...)
+	printf("[ERROR] "+msg, args...)
 }
 
 func (l *Logger) Fatal(msg string, args ...interface{}) {
-	log.Fatalf("[FATAL] "+msg, args...)
+	log.Fatal(TruncateOutput(fmt.Sprintf("[FATAL] "+msg, args...)))
+}
+
+// printf logs a message, truncated to the output limit
+func printf(format string, args ...interface{}) {
+	log.Print(TruncateOutput(fmt.Sprintf(format, args...)))
+}
+
+// ExecuteCommand executes a shell command with timeout. Cancelling ctx
+// kills the command and any processes it started.
+func ExecuteCommand(ctx context.Context, command string, timeout time.Duration) (string, error) {
+	return ExecuteCommandWithInput(ctx, command, nil, timeout)
+}
+
+// ExecuteCommandWithInput executes a shell command with timeout, feeding
+// input to its standard input
+func ExecuteCommandWithInput(ctx context.Context, command string, input io.Reader, timeout time.Duration) (string, error) {
+	return executeCommand(ctx, command, input, nil, timeout)
 }
 
-// ExecuteCommand executes a shell command with timeout
-func ExecuteCommand(command string, timeout time.Duration) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+// ExecuteCommandWithEnv executes a shell command with timeout, adding env
+// ("KEY=value") to the inherited environment
+func ExecuteCommandWithEnv(ctx context.Context, command string, env []string, timeout time.Duration) (string, error) {
+	return executeCommand(ctx, command, nil, env, timeout)
+}
+
+// envKey is the context key of the environment added by WithEnv
+type envKey struct{}
+
+// WithEnv returns a context that adds env ("KEY=value") to the environment
+// of every command run with it, or with a context derived from it
+func WithEnv(ctx context.Context, env ...string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	inherited, _ := ctx.Value(envKey{}).([]string)
+	return context.WithValue(ctx, envKey{}, append(append([]string{}, inherited...), env...))
+}
+
+func executeCommand(parent context.Context, command string, input io.Reader, env []string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = input
+	if inherited, _ := parent.Value(envKey{}).([]string); len(inherited) > 0 {
+		env = append(append([]string{}, inherited...), env...)
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	killProcessGroup(cmd)
 	output, err := cmd.CombinedOutput()
+	recordOutput(command, string(output), cmd.ProcessState.ExitCode())
 
+	if parent.Err() != nil {
+		return string(output), &CommandError{Command: command, ExitCode: -1, Output: string(output), Err: parent.Err()}
+	}
 	if ctx.Err() == context.DeadlineExceeded {
-		return "", fmt.Errorf("command timed out after %v: %s", timeout, command)
+		return "", &CommandError{Command: command, ExitCode: -1, TimedOut: true, Timeout: timeout}
 	}
 
 	if err != nil {
-		return string(output), fmt.Errorf("command failed: %s, output: %s", err.Error(), string(output))
+		exitCode := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		return string(output), &CommandError{Command: command, ExitCode: exitCode, Output: string(output), Err: err}
 	}
 
 	return string(output), nil
 }
 
+// DockerServerVersion returns the version of the docker daemon, failing
+// when the daemon cannot be reached
+func DockerServerVersion(ctx context.Context) (string, error) {
+	output, err := ExecuteCommand(ctx, "docker version --format '{{.Server.Version}}'", 10*time.Second)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// ShellCommand is a command line run by ExecuteCommands
+type ShellCommand struct {
+	Line         string
+	SuccessCodes []int // Exit codes that count as success, only 0 when empty
+}
+
+// check applies the command's success codes to the result of running it
+func (c ShellCommand) check(err error, logger *Logger) error {
+	if len(c.SuccessCodes) == 0 {
+		return err
+	}
+
+	exitCode := 0
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		exitCode = cmdErr.ExitCode
+	} else if err != nil {
+		return err
+	}
+	if !slices.Contains(c.SuccessCodes, exitCode) {
+		if err == nil {
+			return fmt.Errorf("command exited with code 0, which is not one of its success codes %v: %s", c.SuccessCodes, c.Line)
+		}
+		return err
+	}
+	if exitCode != 0 {
+		logger.Info("Command exited with code %d, which counts as success: %s", exitCode, c.Line)
+	}
+	return nil
+}
+
 // ExecuteCommands executes multiple shell commands sequentially
-func ExecuteCommands(commands []string, timeout time.Duration, logger *Logger) error {
+func ExecuteCommands(ctx context.Context, commands []ShellCommand, timeout time.Duration, logger *Logger) error {
+	return executeCommands(ctx, commands, nil, timeout, logger)
+}
+
+func executeCommands(ctx context.Context, commands []ShellCommand, env []string, timeout time.Duration, logger *Logger) error {
 	for _, cmd := range commands {
-		if strings.TrimSpace(cmd) == "" {
+		if strings.TrimSpace(cmd.Line) == "" {
 			continue
 		}
 
-		logger.Info("Executing command: %s", cmd)
-		output, err := ExecuteCommand(cmd, timeout)
+		logger.Info("Executing command: %s", cmd.Line)
+		output, err := ExecuteCommandWithEnv(ctx, cmd.Line, env, timeout)
 
-		if err != nil {
+		if err := cmd.check(err, logger); err != nil {
 			logger.Error("Command failed: %s", err.Error())
 			return err
 		}
@@ -85,6 +199,56 @@ func ExecuteCommands(commands []string, timeout time.Duration, logger *Logger) e
 	return nil
 }
 
+// ExecuteCommandsParallel runs commands with at most parallelism of them at
+// a time, adding env ("KEY=value") to their environment. Unlike
+// ExecuteCommands it does not stop at the first failure: every command runs
+// and all errors are returned. With a parallelism of 1 or less the commands
+// run one after another, stopping at the first failure like
+// ExecuteCommands.
+func ExecuteCommandsParallel(ctx context.Context, commands []ShellCommand, env []string, parallelism int, timeout time.Duration, logger *Logger) error {
+	if parallelism <= 1 {
+		return executeCommands(ctx, commands, env, timeout, logger)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	slots := make(chan struct{}, parallelism)
+	for _, cmd := range commands {
+		if strings.TrimSpace(cmd.Line) == "" {
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(cmd ShellCommand) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			logger.Info("Executing command: %s", cmd.Line)
+			output, err := ExecuteCommandWithEnv(ctx, cmd.Line, env, timeout)
+			if err := cmd.check(err, logger); err != nil {
+				logger.Error("Command failed: %s", err.Error())
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", cmd.Line, err))
+				mu.Unlock()
+				return
+			}
+
+			if strings.TrimSpace(output) != "" {
+				logger.Debug("Command output: %s", strings.TrimSpace(output))
+			}
+		}(cmd)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
 // FileExists checks if a file exists
 func FileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -105,6 +269,64 @@ func GetFileSize(path string) (int64, error) {
 	return info.Size(), nil
 }
 
+// ErrFileChanging is returned by WaitForStableFile for a file whose size
+// did not settle within the timeout
+var ErrFileChanging = errors.New("file size still changing")
+
+// WaitForStableFile polls the size of a file until it did not change for
+// quiet, e.g. while an upload is still being written, and returns it. It
+// gives up with ErrFileChanging once timeout elapsed, or when ctx is done.
+func WaitForStableFile(ctx context.Context, path string, quiet time.Duration, timeout time.Duration) (int64, error) {
+	interval := quiet / 4
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	} else if interval > time.Second {
+		interval = time.Second
+	}
+
+	deadline := time.Now().Add(timeout)
+	size, err := GetFileSize(path)
+	if err != nil {
+		return 0, err
+	}
+	stableSince := time.Now()
+	for time.Since(stableSince) < quiet {
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("%w: %s after %v", ErrFileChanging, path, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		current, err := GetFileSize(path)
+		if err != nil {
+			return 0, err
+		}
+		if current != size {
+			size = current
+			stableSince = time.Now()
+		}
+	}
+	return size, nil
+}
+
+// FileChecksum returns the hex encoded SHA-256 hash of a file's content
+func FileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // FormatBytes formats bytes to human readable format
 func FormatBytes(bytes int64) string {
 	const unit = 1024
@@ -133,3 +355,8 @@ func Daemonize(fn func() error, logger *Logger) error {
 
 	return fn()
 }
+
+// ShellQuote quotes a string for safe use as a single shell word
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// fileAction returns the action for path: the first matching entry of
+// file_actions, or without file_actions, deploy for trigger files when
+// trigger_file_pattern is set and for tarballs otherwise. It returns ""
+// for files the watcher ignores.
+func (w *Watcher) fileAction(path string) string {
+	if len(w.config().FileActions) > 0 {
+		for _, action := range w.config().FileActions {
+			if action.Match(path) {
+				return action.Action
+			}
+		}
+		return ""
+	}
+
+	if w.config().TriggerFilePattern != "" {
+		if w.isTriggerFile(path) {
+			return config.ActionDeploy
+		}
+		return ""
+	}
+	if isTarball(path) {
+		return config.ActionDeploy
+	}
+	return ""
+}
+
+// SetConfigReloader sets the function reload_config files use to load the
+// new watcher settings
+func (w *Watcher) SetConfigReloader(reload func() (*config.WatcherConfig, error)) {
+	w.reload = reload
+}
+
+// runScriptFile executes a file mapped to run_script with its path in
+// FWS_FILE. The file is removed after it succeeded and quarantined after
+// it failed, like a tarball.
+func (w *Watcher) runScriptFile(path string) {
+	w.logger.Info("Running script: %s", path)
+
+	command := "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+	output, err := utils.ExecuteCommandWithEnv(w.ctx, command, []string{"FWS_FILE=" + path}, 5*time.Minute)
+	if err != nil {
+		w.logger.Error("Script %s failed: %v", path, err)
+		if w.ctx.Err() != nil {
+			// Interrupted by shutdown, run it again after a restart
+			return
+		}
+		if qerr := w.quarantineTarball(path); qerr != nil {
+			w.logger.Warn("Failed to quarantine script: %v", qerr)
+		}
+		return
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		w.logger.Info("Script output:\n%s", output)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		w.logger.Warn("Failed to remove script: %v", err)
+	}
+	w.logger.Info("Script completed: %s", path)
+}
+
+// reloadConfig reloads the watcher settings from the config file when a
+// file mapped to reload_config arrives; the file itself is only a signal
+// and is removed. Settings used while watching rather than per deploy
+// keep their value until the watcher restarts.
+func (w *Watcher) reloadConfig(path string) {
+	defer func() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			w.logger.Warn("Failed to remove reload file: %v", err)
+		}
+	}()
+
+	if err := w.ReloadConfig(); err != nil {
+		w.logger.Error("Failed to reload config, keeping the current settings: %v", err)
+	}
+}
+
+// ReloadConfig replaces the per-deploy settings with those of the config
+// file, keeping the current ones if it cannot be loaded
+func (w *Watcher) ReloadConfig() error {
+	if err := w.applyConfig(); err != nil {
+		return err
+	}
+	w.logger.Info("Config reloaded")
+	return nil
+}
+
+// applyConfig loads the config and replaces the per-deploy settings
+func (w *Watcher) applyConfig() error {
+	if w.reload == nil {
+		return fmt.Errorf("config reload is not available")
+	}
+	fresh, err := w.reload()
+	if err != nil {
+		return err
+	}
+
+	// Wait for a running deploy, which reads the settings throughout
+	w.deployMu.Lock()
+	defer w.deployMu.Unlock()
+
+	next := *fresh
+	current := w.config()
+	next.WatchDirectory = current.WatchDirectory
+	next.Recursive = current.Recursive
+	next.StateFile = current.StateFile
+	next.TriggerOn = current.TriggerOn
+	next.SettleDelay = current.SettleDelay
+	next.S3 = current.S3
+	next.S3PollInterval = current.S3PollInterval
+	next.SSHSource = current.SSHSource
+	next.SSHSourcePollInterval = current.SSHSourcePollInterval
+	next.DockerHost = current.DockerHost
+	next.DeployLock = current.DeployLock
+	next.WatchMode = current.WatchMode
+	next.PollInterval = current.PollInterval
+	next.EventBufferSize = current.EventBufferSize
+	next.IdleTimeout = current.IdleTimeout
+	next.MaxDeploysPerMinute = current.MaxDeploysPerMinute
+	next.ControlListen = current.ControlListen
+	next.MetricsListen = current.MetricsListen
+	next.TLSCertFile = current.TLSCertFile
+	next.TLSKeyFile = current.TLSKeyFile
+	next.AuthToken = current.AuthToken
+	next.AuthTokens = current.AuthTokens
+	next.ProxyListen = current.ProxyListen
+	next.ProxyBackendPort = current.ProxyBackendPort
+	if next.DeployStrategy == config.BlueGreen && next.ProxyListen == "" {
+		w.logger.Warn("Keeping deploy_strategy %s, %s needs the proxy, which starts with the watcher", current.DeployStrategy, config.BlueGreen)
+		next.DeployStrategy = current.DeployStrategy
+	}
+	w.settings.Store(&next)
+	return nil
+}
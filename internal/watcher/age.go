@@ -0,0 +1,88 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// waitForAge reports whether path was modified more recently than
+// min_file_age. Such a file is handled again once it is old enough; a
+// write in the meantime moves its modification time and the wait with it.
+func (w *Watcher) waitForAge(path string) bool {
+	minAge := w.config().MinFileAge.Duration()
+	if minAge <= 0 {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	age := time.Since(info.ModTime())
+	if age >= minAge {
+		return false
+	}
+
+	remaining := minAge - age
+	w.logger.Info("Waiting %v until %s is older than min_file_age", remaining.Round(time.Second), path)
+	time.AfterFunc(remaining, func() {
+		if w.ctx.Err() == nil {
+			w.settler.add(path)
+		}
+	})
+	return true
+}
+
+// waitForStableSize reports whether the size of path has yet to be seen
+// unchanged for stable_file_quiet. The size is polled in the background,
+// and the file handed to the settler again once it is stable, or checked
+// again with a warning if it still changes after stable_file_timeout.
+func (w *Watcher) waitForStableSize(path string) bool {
+	quiet := w.config().StableFileQuiet.Duration()
+	if quiet <= 0 {
+		return false
+	}
+
+	w.stableMu.Lock()
+	defer w.stableMu.Unlock()
+
+	// A file that changed since it was found stable is waited for again
+	if stable, ok := w.stableSizes[path]; ok {
+		delete(w.stableSizes, path)
+		if size, err := utils.GetFileSize(path); err == nil && size == stable {
+			return false
+		}
+	}
+	if w.sizeWaits[path] {
+		return true
+	}
+	w.sizeWaits[path] = true
+
+	w.logger.Debug("Waiting for the size of %s to stay the same for %v", path, quiet)
+	timeout := w.config().StableFileTimeout.Duration()
+	go func() {
+		size, err := utils.WaitForStableFile(w.ctx, path, quiet, timeout)
+
+		w.stableMu.Lock()
+		delete(w.sizeWaits, path)
+		if err == nil {
+			w.stableSizes[path] = size
+		}
+		w.stableMu.Unlock()
+
+		switch {
+		case w.ctx.Err() != nil:
+			return
+		case errors.Is(err, utils.ErrFileChanging):
+			w.logger.Warn("Size of %s still changing after %v, waiting until it stays the same", path, timeout)
+		case err != nil:
+			w.logger.Debug("Stopped waiting for a stable size of %s: %v", path, err)
+			return
+		}
+		w.settler.add(path)
+	}()
+	return true
+}
@@ -0,0 +1,42 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// Tags of the stable alias
+const (
+	aliasCurrent  = "current"
+	aliasPrevious = "previous"
+)
+
+// tagStableAlias tags image as <stable_alias>:current, first moving the
+// image that had that tag to <stable_alias>:previous, and returns the alias
+// to run. The original tag of image is kept.
+func (w *Watcher) tagStableAlias(image string) (string, error) {
+	current := w.config().StableAlias + ":" + aliasCurrent
+	previous := w.config().StableAlias + ":" + aliasPrevious
+
+	idCmd := "docker image inspect -f '{{.Id}}' %s"
+	newID, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf(idCmd, utils.ShellQuote(image)), 10*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect loaded image %s: %w", image, err)
+	}
+
+	// Redeploying the current image must not overwrite previous
+	if oldID, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf(idCmd, current), 10*time.Second); err == nil && oldID != newID {
+		if _, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker tag %s %s", current, previous), 30*time.Second); err != nil {
+			w.logger.Warn("Failed to tag %s as %s: %v", current, previous, err)
+		}
+	}
+
+	if _, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker tag %s %s", utils.ShellQuote(image), current), 30*time.Second); err != nil {
+		return "", fmt.Errorf("failed to tag %s as %s: %w", image, current, err)
+	}
+
+	w.logger.Info("Tagged %s as %s", image, current)
+	return current, nil
+}
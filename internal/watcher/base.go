@@ -0,0 +1,36 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// ensureBaseImage loads the base image a tarball from a base_image upload
+// depends on, unless docker already has it. docker load then skips the
+// base layers left out of the tarball.
+func (w *Watcher) ensureBaseImage(tarballPath string) error {
+	ref, err := imagetar.ReadBaseRef(tarballPath)
+	if err != nil {
+		return err
+	}
+	if ref == nil || imageExists(w.ctx, ref.ImageID) {
+		return nil
+	}
+
+	// The name comes from the tarball, keep it inside the base directory
+	basePath := filepath.Join(w.config().BasePath(), filepath.Base(ref.Tarball))
+	if !utils.FileExists(basePath) {
+		return fmt.Errorf("base image %s is missing: %s was not found", ref.ImageID, basePath)
+	}
+
+	w.logger.Info("Loading base image %s from %s", ref.ImageID, basePath)
+	output, err := w.runDockerLoad(basePath)
+	if err != nil {
+		return fmt.Errorf("failed to load base image: %w", err)
+	}
+	w.logger.Debug("Base image load output: %s", output)
+	return nil
+}
@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// blobGracePeriod keeps recently written blobs, which may belong to a slim
+// tarball that is still being uploaded
+const blobGracePeriod = time.Hour
+
+// pruneBlobs removes the layer blobs that no slim tarball refers to any
+// more, once the slim tarball deployed was loaded. Its own blobs are kept,
+// since the next upload usually shares most of its layers, and so are those
+// of the slim tarballs in the watch directory, the archive and the
+// quarantine.
+func (w *Watcher) pruneBlobs(deployed string) {
+	index, err := imagetar.ReadLayerIndex(deployed)
+	if err != nil || index == nil {
+		return
+	}
+	blobDir := w.config().BlobPath()
+	entries, err := os.ReadDir(blobDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.logger.Warn("Failed to read blob directory: %v", err)
+		}
+		return
+	}
+
+	referenced := make(map[string]bool)
+	for _, layer := range index.Layers {
+		referenced[layer.Digest] = true
+	}
+	if err := w.referencedBlobs(referenced); err != nil {
+		// A blob of an unreadable tarball might still be needed
+		w.logger.Warn("Not removing layer blobs: %v", err)
+		return
+	}
+
+	var removed int
+	var freed int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || referenced[name] || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < blobGracePeriod {
+			continue
+		}
+		if err := os.Remove(filepath.Join(blobDir, name)); err != nil {
+			w.logger.Warn("Failed to remove layer blob %s: %v", name, err)
+			continue
+		}
+		removed++
+		freed += info.Size()
+	}
+	if removed > 0 {
+		w.logger.Info("Removed %d layer blobs no tarball refers to (%s)", removed, utils.FormatBytes(freed))
+	}
+}
+
+// referencedBlobs adds the blobs of the slim tarballs in the watch
+// directory, the archive and the quarantine to referenced
+func (w *Watcher) referencedBlobs(referenced map[string]bool) error {
+	for _, dir := range []string{w.config().WatchDirectory, w.config().ArchiveDirectory, w.config().QuarantinePath()} {
+		if dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if entry.IsDir() {
+				if path != dir && (!w.config().Recursive || w.skipDir(entry.Name(), path)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isTarball(entry.Name()) {
+				return nil
+			}
+			index, err := imagetar.ReadLayerIndex(path)
+			if err != nil {
+				return err
+			}
+			if index != nil {
+				for _, layer := range index.Layers {
+					referenced[layer.Digest] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
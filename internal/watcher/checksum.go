@@ -0,0 +1,53 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// ErrChecksumMismatch is returned for a tarball that does not match its
+// checksum file, e.g. because it is truncated or still being written. It
+// is left in place, as a complete upload may still replace it.
+var ErrChecksumMismatch = errors.New("tarball does not match its checksum file")
+
+// verifyChecksum checks a tarball against "<tarball>.sha256" if the
+// uploader wrote one. Tarballs without a checksum file are not checked.
+func (w *Watcher) verifyChecksum(tarballPath string) error {
+	content, err := os.ReadFile(tarballPath + imagetar.ChecksumSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checksum file: %w", err)
+	}
+
+	// Same format as sha256sum: "<hash>  <file name>"
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: checksum file is empty", ErrChecksumMismatch)
+	}
+
+	w.logger.Debug("Verifying tarball checksum: %s", fields[0])
+	checksum, err := utils.FileChecksum(tarballPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash tarball: %w", err)
+	}
+	if !strings.EqualFold(checksum, fields[0]) {
+		w.metrics.Add("fws_watcher_checksum_mismatches_total", "Number of tarballs skipped because they did not match their checksum file.", 1)
+		return fmt.Errorf("%w: sha256 %s, expected %s", ErrChecksumMismatch, checksum, fields[0])
+	}
+	return nil
+}
+
+// removeChecksumFile removes the checksum file of a tarball that left the
+// watch directory
+func (w *Watcher) removeChecksumFile(tarballPath string) {
+	if err := os.Remove(tarballPath + imagetar.ChecksumSuffix); err != nil && !os.IsNotExist(err) {
+		w.logger.Warn("Failed to remove checksum file: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCleanupFailed is returned for a successful deploy whose tarball could
+// not be removed or archived when cleanup_failure_fatal is set
+var ErrCleanupFailed = errors.New("tarball cleanup failed")
+
+// cleanupAlertThreshold is the number of deploys in a row whose cleanup
+// failed after which the failures are logged as errors
+const cleanupAlertThreshold = 3
+
+// cleanupDeployedTarball removes or archives the tarball of a successful
+// deploy, retrying cleanup_retries times with a doubling delay. Failures
+// are counted so that a watch directory slowly filling up does not go
+// unnoticed.
+func (w *Watcher) cleanupDeployedTarball(tarballPath string) error {
+	delay := time.Second
+	err := w.cleanupTarball(tarballPath)
+	for attempt := 1; err != nil && attempt <= w.config().CleanupRetries; attempt++ {
+		w.logger.Warn("Failed to cleanup tarball, retrying in %v (%d/%d): %v", delay, attempt, w.config().CleanupRetries, err)
+		time.Sleep(delay)
+		delay *= 2
+		err = w.cleanupTarball(tarballPath)
+	}
+
+	if err == nil {
+		w.cleanupFailures = 0
+		w.metrics.Set("fws_watcher_cleanup_consecutive_failures", "Number of deploys in a row whose tarball could not be cleaned up.", 0)
+		return nil
+	}
+
+	w.cleanupFailures++
+	w.metrics.Add("fws_watcher_cleanup_failures_total", "Number of deployed tarballs that could not be removed or archived.", 1)
+	w.metrics.Set("fws_watcher_cleanup_consecutive_failures", "Number of deploys in a row whose tarball could not be cleaned up.", float64(w.cleanupFailures))
+	if w.cleanupFailures >= cleanupAlertThreshold {
+		w.logger.Error("Tarball cleanup failed for %d deploys in a row, the watch directory may fill up: %v", w.cleanupFailures, err)
+	} else {
+		w.logger.Warn("Failed to cleanup tarball: %v", err)
+	}
+
+	if w.config().CleanupFailureFatal {
+		return fmt.Errorf("%w: %v", ErrCleanupFailed, err)
+	}
+	return nil
+}
+
+// stopOnCleanupFailure stops the watcher after a deploy from the watch loop
+// failed its cleanup with cleanup_failure_fatal
+func (w *Watcher) stopOnCleanupFailure(err error) {
+	if !errors.Is(err, ErrCleanupFailed) {
+		return
+	}
+	w.logger.Error("Stopping file watcher, cleanup_failure_fatal is set")
+	w.stopErr = err
+	w.cancel()
+}
@@ -0,0 +1,69 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// clearNameCollision makes sure no container holds name before docker run.
+// The old container is removed in the stop phase, ignoring failures, so a
+// container that could not be removed, or one that was created outside fws
+// in the meantime, would otherwise fail the start with "name already in
+// use". With force_replace it is removed, otherwise the deploy fails.
+func (w *Watcher) clearNameCollision(name string) error {
+	id, err := containerID(w.ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to check for container %s: %w", name, err)
+	}
+	if id == "" {
+		return nil
+	}
+
+	if !w.config().ForceReplace {
+		return fmt.Errorf("container %s (%s) still exists and would block the start; remove it with docker rm -f %s or set force_replace", name, shortID(id), name)
+	}
+
+	w.logger.Warn("Container %s (%s) still exists, force-removing it", name, shortID(id))
+	output, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker rm -f %s", name), 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", name, err)
+	}
+	w.logger.Debug("Docker remove output: %s", strings.TrimSpace(output))
+
+	// A removal already in progress may not have finished, so confirm the
+	// name is free
+	if id, err = containerID(w.ctx, name); err != nil {
+		return fmt.Errorf("failed to check for container %s: %w", name, err)
+	}
+	if id != "" {
+		return fmt.Errorf("container %s (%s) still exists after docker rm -f", name, shortID(id))
+	}
+	return nil
+}
+
+// containerID returns the ID of the container called name, or "" if there
+// is none
+func containerID(ctx context.Context, name string) (string, error) {
+	output, err := utils.ExecuteCommand(ctx, fmt.Sprintf("docker inspect --type container -f '{{.Id}}' %s", name), 10*time.Second)
+	if err != nil {
+		var cmdErr *utils.CommandError
+		if errors.As(err, &cmdErr) && strings.Contains(strings.ToLower(cmdErr.Output), "no such") {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// shortID abbreviates a container ID the way docker ps does
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,125 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// gitSHAPattern matches an abbreviated or full commit hash. Hashes must
+// contain a letter so timestamps are not mistaken for one.
+var gitSHAPattern = regexp.MustCompile(`^[0-9a-f]*[a-f][0-9a-f]*$`)
+
+// revisionLabel is the OCI image label holding the source revision
+const revisionLabel = "org.opencontainers.image.revision"
+
+// ContainerName returns the managed container: the one of the running or
+// last deploy, or "" if container_name is a template and nothing was
+// deployed yet
+func (w *Watcher) ContainerName() string {
+	if err := w.loadState(); err != nil {
+		w.logger.Debug("Failed to load state: %v", err)
+	}
+	return w.containerName()
+}
+
+func (w *Watcher) containerName() string {
+	w.lastMu.Lock()
+	name := w.container
+	w.lastMu.Unlock()
+	if name != "" {
+		return name
+	}
+
+	if w.state != nil {
+		if name := w.state.LastContainer(); name != "" {
+			return name
+		}
+	}
+	if w.config().ContainerNameIsTemplate() {
+		return ""
+	}
+	return w.config().ContainerName
+}
+
+// setContainer makes name the container the deploy works on
+func (w *Watcher) setContainer(name string) {
+	w.lastMu.Lock()
+	defer w.lastMu.Unlock()
+	w.container = name
+}
+
+// renderContainerName returns the container a deploy of image replaces.
+// A templated container_name is rendered with the image's repository name,
+// its tag and, if known, the git commit it was built from.
+func (w *Watcher) renderContainerName(image, tarballPath string) (string, error) {
+	if !w.config().ContainerNameIsTemplate() {
+		return w.config().ContainerName, nil
+	}
+
+	repo, tag := splitImage(image)
+	vars := map[string]string{
+		"Image": repo,
+		"Tag":   tag,
+	}
+	if sha := w.gitSHA(image, tarballPath); sha != "" {
+		vars["GitSHA"] = sha
+	}
+
+	name, err := w.config().RenderContainerName(vars)
+	if err != nil {
+		return "", err
+	}
+	if err := config.ValidateContainerName(name); err != nil {
+		return "", fmt.Errorf("container_name rendered for %s: %w", image, err)
+	}
+
+	w.logger.Info("Container name for %s: %s", image, name)
+	return name, nil
+}
+
+// splitImage returns the last path component of an image's repository and
+// its tag. Digest references yield a "sha256-<hex>" tag, untagged ones
+// "latest".
+func splitImage(image string) (string, string) {
+	repo, tag := image, "latest"
+	if name, digest, ok := strings.Cut(image, "@"); ok {
+		repo = name
+		tag = strings.Replace(digest, ":", "-", 1)
+		if len(tag) > 19 {
+			tag = tag[:19]
+		}
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repo, tag = image[:i], image[i+1:]
+	}
+	return repo[strings.LastIndex(repo, "/")+1:], tag
+}
+
+// gitSHA returns the commit an image was built from, taken from its OCI
+// revision label or else from a commit hash in the tarball file name
+func (w *Watcher) gitSHA(image, tarballPath string) string {
+	inspectCmd := fmt.Sprintf("docker image inspect -f '{{index .Config.Labels %q}}' %s", revisionLabel, utils.ShellQuote(image))
+	if output, err := utils.ExecuteCommand(w.ctx, inspectCmd, 10*time.Second); err == nil {
+		if sha := strings.TrimSpace(output); sha != "" && sha != "<no value>" {
+			return sha
+		}
+	}
+
+	// Look for a hash between the separators of the file name
+	name := strings.TrimSuffix(imagetar.TrimCompressionExt(filepath.Base(tarballPath)), ".tar")
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || r == '+'
+	})
+	for _, part := range parts {
+		if len(part) >= 7 && len(part) <= 40 && gitSHAPattern.MatchString(part) {
+			return part
+		}
+	}
+	return ""
+}
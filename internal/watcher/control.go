@@ -0,0 +1,140 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/metrics"
+)
+
+// Status is a snapshot of the watcher for the control API
+type Status struct {
+	Container       string        `json:"container"`
+	ContainerStatus string        `json:"container_status"`
+	Paused          bool          `json:"paused"`
+	LastDeployAt    *time.Time    `json:"last_deploy_at,omitempty"`
+	LastDeployError string        `json:"last_deploy_error,omitempty"`
+	LastDeploy      *DeployResult `json:"last_deploy,omitempty"`
+
+	Pending      int         `json:"pending"`                 // Files waiting to settle
+	Deploying    bool        `json:"deploying"`               // A deploy is in progress
+	RecentEvents []FileEvent `json:"recent_events,omitempty"` // Files handled recently, newest first
+}
+
+// Pause stops the watcher from processing new tarballs until Resume is called
+func (w *Watcher) Pause() {
+	w.paused.Store(true)
+	w.logger.Info("Processing paused")
+}
+
+// Resume continues processing new tarballs after Pause
+func (w *Watcher) Resume() {
+	w.paused.Store(false)
+	w.logger.Info("Processing resumed")
+}
+
+// Paused reports whether processing is paused
+func (w *Watcher) Paused() bool {
+	return w.paused.Load()
+}
+
+// Metrics returns the watcher metrics registry
+func (w *Watcher) Metrics() *metrics.Registry {
+	return w.metrics
+}
+
+// Status returns the current watcher and container status
+func (w *Watcher) Status() (Status, error) {
+	containerStatus, err := w.GetContainerStatus()
+	if err != nil {
+		return Status{}, err
+	}
+
+	// containerName takes lastMu itself
+	container := w.containerName()
+
+	w.lastMu.Lock()
+	defer w.lastMu.Unlock()
+
+	status := Status{
+		Container:       container,
+		ContainerStatus: containerStatus,
+		Paused:          w.Paused(),
+		Deploying:       !w.deployMu.TryLock(),
+		RecentEvents:    w.events.list(),
+	}
+	if !status.Deploying {
+		w.deployMu.Unlock()
+	}
+	if w.settler != nil {
+		status.Pending = w.settler.len()
+	}
+	if w.lastDeploy != nil {
+		at := w.lastDeploy.StartedAt
+		status.LastDeployAt = &at
+		status.LastDeployError = w.lastDeploy.Error
+		status.LastDeploy = w.lastDeploy
+	}
+	return status, nil
+}
+
+// DeployByName deploys a tarball from the watch directory, or redeploys it
+// from the archive directory if it is only found there. Only plain file
+// names are accepted so API callers cannot point at arbitrary paths.
+func (w *Watcher) DeployByName(name string) (*DeployResult, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid tarball name: %q", name)
+	}
+
+	path := filepath.Join(w.config().WatchDirectory, name)
+	if _, err := os.Stat(path); err == nil {
+		return w.Deploy(path)
+	}
+
+	if w.config().ArchiveDirectory != "" {
+		path = filepath.Join(w.config().ArchiveDirectory, name)
+		if _, err := os.Stat(path); err == nil {
+			return w.Replay(path)
+		}
+	}
+
+	return nil, fmt.Errorf("tarball not found: %s", name)
+}
+
+// recordDeploy updates metrics and the last deploy status from a finished
+// deploy
+func (w *Watcher) recordDeploy(result *DeployResult) {
+	failed := result.Outcome != OutcomeSuccess
+
+	w.metrics.Add("fws_watcher_deploys_total", "Number of deploys attempted.", 1)
+	if failed {
+		w.metrics.Add("fws_watcher_deploy_failures_total", "Number of failed deploys.", 1)
+		switch result.FailedPhase() {
+		case "readiness":
+			w.metrics.Add("fws_watcher_readiness_failures_total", "Number of deploys whose container did not become ready.", 1)
+		case "smoke_test":
+			w.metrics.Add("fws_watcher_smoke_test_failures_total", "Number of deploys that failed the smoke test.", 1)
+		}
+	} else {
+		w.metrics.Set("fws_watcher_last_success_timestamp_seconds", "Unix time of the last successful deploy.", float64(time.Now().Unix()))
+	}
+	if result.Outcome == OutcomeRolledBack {
+		w.metrics.Add("fws_watcher_rollbacks_total", "Number of failed deploys rolled back to the previous image.", 1)
+	}
+	w.metrics.Set("fws_watcher_last_deploy_duration_seconds", "Duration of the last deploy.", result.DurationSeconds)
+
+	if err := w.appendJournal(result); err != nil {
+		w.logger.Warn("Failed to record deploy in journal: %v", err)
+	}
+	if err := w.tracer.Export(deployTrace(result)); err != nil {
+		w.logger.Warn("Failed to export deploy trace: %v", err)
+	}
+
+	w.lastMu.Lock()
+	defer w.lastMu.Unlock()
+
+	w.lastDeploy = result
+}
@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"time"
+)
+
+// DeployEventType is the step of a deploy a DeployEvent reports
+type DeployEventType string
+
+// Deploy event types, in the order a deploy emits them; a blue-green deploy
+// stops the old container after EventHealthPassed instead. Every deploy
+// that emits EventStarted ends with EventCompleted or EventFailed; the
+// steps in between are skipped when the deploy fails before reaching them.
+const (
+	EventStarted          DeployEventType = "started"
+	EventImageLoaded      DeployEventType = "image_loaded"      // The image was loaded and its name resolved
+	EventContainerStopped DeployEventType = "container_stopped" // The old container was stopped and removed
+	EventContainerStarted DeployEventType = "container_started"
+	EventHealthPassed     DeployEventType = "health_passed" // The new container passed readiness_command, if any
+	EventCompleted        DeployEventType = "completed"
+	EventFailed           DeployEventType = "failed"
+)
+
+// DeployEvent reports the progress of a deploy to an application embedding
+// the watcher
+type DeployEvent struct {
+	Type      DeployEventType
+	Time      time.Time
+	Tarball   string
+	Image     string // Empty before EventImageLoaded
+	Container string // Empty before EventImageLoaded
+	Error     string // Set for EventFailed
+
+	// The finished deploy, set for EventCompleted and EventFailed. It is
+	// shared with the control API and must not be modified.
+	Result *DeployResult
+}
+
+// SetDeployEvents sets the channel deploy events are sent to, or disables
+// them when ch is nil. Like signal.Notify, the watcher does not block on
+// ch: events that do not fit into its buffer are dropped, so ch should be
+// buffered. It must be called before Run.
+func (w *Watcher) SetDeployEvents(ch chan<- DeployEvent) {
+	w.deployEvents = ch
+}
+
+// emit sends an event about the deploy of result, if deploy events are
+// enabled
+func (w *Watcher) emit(eventType DeployEventType, result *DeployResult) {
+	if w.deployEvents == nil {
+		return
+	}
+
+	event := DeployEvent{
+		Type:      eventType,
+		Time:      time.Now(),
+		Tarball:   result.Tarball,
+		Image:     result.Image,
+		Container: result.Container,
+	}
+	if eventType == EventCompleted || eventType == EventFailed {
+		event.Error = result.Error
+		event.Result = result
+	}
+
+	select {
+	case w.deployEvents <- event:
+	default:
+		w.metrics.Add("fws_watcher_deploy_events_dropped_total", "Number of deploy events dropped because the receiver was not ready.", 1)
+		w.logger.Debug("Dropped %s deploy event for %s, the receiver is not ready", eventType, result.Tarball)
+	}
+}
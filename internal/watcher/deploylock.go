@@ -0,0 +1,75 @@
+package watcher
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/dlock"
+)
+
+// newLocker creates the distributed deploy lock client, if configured
+func (w *Watcher) newLocker() (dlock.Locker, error) {
+	if !w.config().DeployLock.Enabled() {
+		return nil, nil
+	}
+	lock := w.config().DeployLock
+	w.logger.Info("Using %s deploy lock at %s", lock.Backend, strings.Join(lock.Endpoints, ", "))
+	return dlock.New(dlock.Options{
+		Backend:   lock.Backend,
+		Endpoints: lock.Endpoints,
+		TTL:       lock.TTL.Duration(),
+		Token:     lock.Token,
+	})
+}
+
+// deployLockKey returns the lock key of a deploy file, based on its path
+// below the watch directory so all watchers of a shared directory agree
+func (w *Watcher) deployLockKey(path string) string {
+	name := filepath.Base(path)
+	if dir, err := filepath.EvalSymlinks(w.config().WatchDirectory); err == nil {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = filepath.ToSlash(rel)
+		}
+	}
+	return w.config().DeployLock.KeyPrefix + name
+}
+
+// acquireDeployLock takes the distributed lock of a deploy file so no other
+// watcher deploys it too. It reports false if the file must be skipped for
+// now: another watcher holds the lock or the lock backend failed. The file
+// is then handled again after the lock TTL, in case the other watcher died
+// before removing it. The returned function releases the lock.
+func (w *Watcher) acquireDeployLock(path string) (func(), bool) {
+	if w.locker == nil {
+		return func() {}, true
+	}
+
+	key := w.deployLockKey(path)
+	ctx, cancel := context.WithTimeout(w.ctx, 30*time.Second)
+	defer cancel()
+	lock, err := w.locker.TryLock(ctx, key)
+	if err != nil || lock == nil {
+		if err != nil {
+			w.metrics.Add("fws_watcher_deploy_lock_errors_total", "Number of times the distributed deploy lock could not be taken because of backend errors.", 1)
+			w.logger.Error("Failed to take deploy lock %s, retrying later: %v", key, err)
+		} else {
+			w.metrics.Add("fws_watcher_deploy_lock_skips_total", "Number of deploy files skipped because another watcher held their lock.", 1)
+			w.logger.Info("Skipping %s, another watcher is deploying it", path)
+		}
+		time.AfterFunc(w.config().DeployLock.TTL.Duration(), func() {
+			if w.ctx.Err() == nil {
+				w.settler.add(path)
+			}
+		})
+		return nil, false
+	}
+
+	w.logger.Debug("Took deploy lock %s", key)
+	return func() {
+		if err := lock.Release(); err != nil {
+			w.logger.Warn("%v", err)
+		}
+	}, true
+}
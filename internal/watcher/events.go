@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRecentEvents is the number of handled files kept for the control API
+const maxRecentEvents = 50
+
+// FileEvent is a settled file the watcher handled
+type FileEvent struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Action string    `json:"action"` // The file action, see file_actions
+}
+
+// eventLog keeps the most recent file events
+type eventLog struct {
+	mu     sync.Mutex
+	events []FileEvent
+}
+
+// add records an event, dropping the oldest one when full
+func (l *eventLog) add(event FileEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == maxRecentEvents {
+		l.events = l.events[1:]
+	}
+	l.events = append(l.events, event)
+}
+
+// list returns the events, newest first
+func (l *eventLog) list() []FileEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := make([]FileEvent, len(l.events))
+	for i, event := range l.events {
+		events[len(events)-1-i] = event
+	}
+	return events
+}
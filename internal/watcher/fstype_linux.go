@@ -0,0 +1,25 @@
+package watcher
+
+import "syscall"
+
+// networkFilesystems maps statfs magic numbers to the names of file
+// systems on which inotify does not see changes made by other hosts
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+	0x65735546: "fuse",
+	0x786f4256: "vboxsf",
+}
+
+// networkFilesystem returns the name of the network file system dir is on,
+// or "" for local file systems
+func networkFilesystem(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	return networkFilesystems[uint32(st.Type)]
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package watcher
+
+// networkFilesystem is only implemented on Linux, where inotify is used
+func networkFilesystem(dir string) string {
+	return ""
+}
@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// ErrDeployGated is returned for a deploy that pre_deploy_gate_command
+// vetoed. Nothing was changed; the running container keeps serving.
+var ErrDeployGated = errors.New("deploy vetoed by pre_deploy_gate_command")
+
+// checkDeployGate runs the deploy gate command, with the tarball, the
+// managed container and the deploy metadata in its environment. A
+// non-zero exit, or running past its timeout, vetoes the deploy.
+func (w *Watcher) checkDeployGate(result *DeployResult) error {
+	if w.config().PreDeployGateCommand == "" {
+		return nil
+	}
+
+	w.logger.Info("Checking deploy gate: %s", w.config().PreDeployGateCommand)
+
+	env := []string{
+		"FWS_TARBALL=" + result.Tarball,
+		"FWS_CONTAINER=" + w.containerName(),
+	}
+	env = append(env, metadataEnv(result.Metadata)...)
+	output, err := utils.ExecuteCommandWithEnv(w.ctx, w.config().PreDeployGateCommand, env, w.config().PreDeployGateTimeout.Duration())
+	if err != nil {
+		if w.ctx.Err() != nil {
+			return err
+		}
+		w.metrics.Add("fws_watcher_deploys_gated_total", "Number of deploys vetoed by the deploy gate command.", 1)
+		return fmt.Errorf("%w: %v", ErrDeployGated, err)
+	}
+
+	if strings.TrimSpace(output) != "" {
+		w.logger.Debug("Deploy gate output: %s", strings.TrimSpace(output))
+	}
+	w.logger.Info("Deploy gate passed")
+	return nil
+}
@@ -0,0 +1,112 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// managedPrefix starts the repositories fws tags deployed images with.
+// docker cannot add labels to an image after it was built, so ownership is
+// recorded as a tag instead: fws-managed/<container>:<deploy time>.
+const managedPrefix = "fws-managed/"
+
+// managedRepository returns the repository that marks images deployed to
+// container
+func managedRepository(container string) string {
+	return managedPrefix + untaggedRepository(container)
+}
+
+// tagManagedImage marks the image of a successful deploy as belonging to
+// its container
+func (w *Watcher) tagManagedImage(result *DeployResult) error {
+	if result.NewImageID == "" {
+		return fmt.Errorf("image of container %s is unknown", result.Container)
+	}
+	tag := managedRepository(result.Container) + ":" + time.Now().UTC().Format("20060102-150405.000")
+	if _, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker tag %s %s", result.NewImageID, tag), 30*time.Second); err != nil {
+		return fmt.Errorf("failed to tag %s as %s: %w", result.NewImageID, tag, err)
+	}
+	return nil
+}
+
+// collectImages removes all but the keep_images newest images deployed to
+// container. Only images carrying this container's managed tag are
+// considered; an image also tagged for another container is only untagged
+// from this one. Images still used by a container cannot be removed and
+// are tried again after the next deploy.
+func (w *Watcher) collectImages(container string) error {
+	repo := managedRepository(container)
+	output, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker images --no-trunc --format '{{.ID}}\t{{.Tag}}' %s", utils.ShellQuote(repo)), 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to list images of %s: %w", container, err)
+	}
+
+	// Managed tags per image, newest deploy first
+	tags := make(map[string][]string)
+	var ids []string
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	sort.Slice(lines, func(i, j int) bool {
+		return tagOf(lines[i]) > tagOf(lines[j])
+	})
+	for _, line := range lines {
+		id, tag, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if _, seen := tags[id]; !seen {
+			ids = append(ids, id)
+		}
+		tags[id] = append(tags[id], repo+":"+tag)
+	}
+
+	for i, id := range ids {
+		if i < w.config().KeepImages {
+			continue
+		}
+		targets, err := w.collectableRefs(id, repo)
+		if err != nil {
+			w.logger.Warn("Not removing image %s: %v", shortID(id), err)
+			continue
+		}
+		// The managed tags go last so a refused removal leaves the image marked
+		targets = append(targets, tags[id]...)
+		w.logger.Info("Removing old image of %s: %s", container, strings.Join(targets, ", "))
+		if output, err := utils.ExecuteCommand(w.ctx, "docker rmi "+strings.Join(targets, " "), time.Minute); err != nil {
+			w.logger.Warn("Failed to remove image %s: %s", shortID(id), strings.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+// collectableRefs returns the references of image id that may be removed
+// with it: all but the managed tags, or none if another container's
+// managed tag shows the image is in use elsewhere
+func (w *Watcher) collectableRefs(id, repo string) ([]string, error) {
+	output, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker image inspect -f '{{join .RepoTags \"\\n\"}}' %s", id), 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image: %w", err)
+	}
+
+	var refs []string
+	for _, ref := range strings.Fields(output) {
+		switch {
+		case strings.HasPrefix(ref, repo+":"):
+		case strings.HasPrefix(ref, managedPrefix):
+			w.logger.Debug("Image %s is also deployed as %s, only untagging it", shortID(id), ref)
+			return nil, nil
+		default:
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// tagOf returns the tag column of a docker images line
+func tagOf(line string) string {
+	_, tag, _ := strings.Cut(line, "\t")
+	return tag
+}
@@ -0,0 +1,33 @@
+package watcher
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIdleTimeout is returned by Run when no tarball was deployed within
+// idle_timeout
+var ErrIdleTimeout = errors.New("no deploy within idle timeout")
+
+// idleRemaining returns how much longer the watcher may stay idle. Any
+// deploy, successful or not and however it was triggered, resets the idle
+// period; a deploy in progress keeps the watcher busy.
+func (w *Watcher) idleRemaining(started time.Time) time.Duration {
+	timeout := w.config().IdleTimeout.Duration()
+	if !w.deployMu.TryLock() {
+		return timeout
+	}
+	w.deployMu.Unlock()
+
+	last := started
+	w.lastMu.Lock()
+	if w.lastDeploy != nil {
+		finished := w.lastDeploy.StartedAt.Add(time.Duration(w.lastDeploy.DurationSeconds * float64(time.Second)))
+		if finished.After(last) {
+			last = finished
+		}
+	}
+	w.lastMu.Unlock()
+
+	return timeout - time.Since(last)
+}
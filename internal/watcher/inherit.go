@@ -0,0 +1,144 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// runtimeConfig is the configuration inherit_runtime_config carries over
+// from the running container
+type runtimeConfig struct {
+	Ports   []string // docker run -p values
+	Env     []string // KEY=value, without the variables set by the image
+	Volumes []string // docker run -v values
+}
+
+// plainValue matches environment values that need no shell quoting
+var plainValue = regexp.MustCompile(`^[A-Za-z0-9_./:,=@%+-]*$`)
+
+// captureRuntimeConfig remembers the ports, environment and volumes of the
+// managed container for the next container started. Without a container
+// the settings captured earlier are kept.
+func (w *Watcher) captureRuntimeConfig() {
+	if !w.config().InheritRuntimeConfig {
+		return
+	}
+
+	container := w.containerName()
+	inherited, err := w.inspectRuntimeConfig(container)
+	if err != nil {
+		w.logger.Warn("Failed to read the runtime config of %s, keeping the previous one: %v", container, err)
+		return
+	}
+
+	w.inheritMu.Lock()
+	defer w.inheritMu.Unlock()
+	w.inherited = inherited
+	w.logger.Debug("Inherited from %s: ports %v, environment %d variables, volumes %v", container, inherited.Ports, len(inherited.Env), inherited.Volumes)
+}
+
+// inheritedConfig returns the captured runtime config, or nil
+func (w *Watcher) inheritedConfig() *runtimeConfig {
+	w.inheritMu.Lock()
+	defer w.inheritMu.Unlock()
+	return w.inherited
+}
+
+// inspectRuntimeConfig reads the runtime config of container with docker
+// inspect
+func (w *Watcher) inspectRuntimeConfig(container string) (*runtimeConfig, error) {
+	if container == "" {
+		return nil, fmt.Errorf("no container deployed yet")
+	}
+
+	output, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker inspect --type container -f '{{json .}}' %s", container), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Image  string
+		Config struct {
+			Env []string
+		}
+		HostConfig struct {
+			Binds        []string
+			PortBindings map[string][]struct {
+				HostIP   string `json:"HostIp"`
+				HostPort string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		return nil, fmt.Errorf("failed to decode docker inspect output: %w", err)
+	}
+
+	// Variables the image sets are left to the new image
+	output, err = utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker image inspect -f '{{json .Config.Env}}' %s", info.Image), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var imageEnv []string
+	if err := json.Unmarshal([]byte(output), &imageEnv); err != nil {
+		return nil, fmt.Errorf("failed to decode docker image inspect output: %w", err)
+	}
+
+	inherited := &runtimeConfig{Volumes: info.HostConfig.Binds}
+	for _, env := range info.Config.Env {
+		if slices.Contains(imageEnv, env) {
+			continue
+		}
+		key, value, _ := strings.Cut(env, "=")
+		if !plainValue.MatchString(value) {
+			value = utils.ShellQuote(value)
+		}
+		inherited.Env = append(inherited.Env, key+"="+value)
+	}
+
+	proxyBinding := w.config().ProxyPortBinding()
+	for port, bindings := range info.HostConfig.PortBindings {
+		containerPort := strings.TrimSuffix(port, "/tcp")
+		for _, b := range bindings {
+			spec := containerPort
+			switch {
+			case strings.Contains(b.HostIP, ":"):
+				spec = "[" + b.HostIP + "]:" + b.HostPort + ":" + containerPort
+			case b.HostIP != "":
+				spec = b.HostIP + ":" + b.HostPort + ":" + containerPort
+			case b.HostPort != "":
+				spec = b.HostPort + ":" + containerPort
+			}
+			// The proxy binding is added for every container anyway
+			if spec == proxyBinding {
+				continue
+			}
+			inherited.Ports = append(inherited.Ports, spec)
+		}
+	}
+	slices.Sort(inherited.Ports)
+	return inherited, nil
+}
+
+// applyRuntimeConfig fills the ports, environment and volumes left empty in
+// the config with the inherited ones
+func (w *Watcher) applyRuntimeConfig(opts *config.RunOptions) {
+	inherited := w.inheritedConfig()
+	if inherited == nil {
+		return
+	}
+	if len(opts.Ports) == 0 {
+		opts.Ports = inherited.Ports
+	}
+	if len(opts.Env) == 0 {
+		opts.Env = inherited.Env
+	}
+	if len(opts.Volumes) == 0 {
+		opts.Volumes = inherited.Volumes
+	}
+}
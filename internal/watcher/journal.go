@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// downtimeSample is the number of recent deploys downtime is estimated from
+const downtimeSample = 20
+
+// appendJournal adds a finished deploy to the journal
+func (w *Watcher) appendJournal(result *DeployResult) error {
+	path := w.config().JournalPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode deploy result: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// Journal returns the recorded deploys, oldest first. A missing journal
+// yields no deploys.
+func (w *Watcher) Journal() ([]DeployResult, error) {
+	file, err := os.Open(w.config().JournalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	var results []DeployResult
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var result DeployResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			// Skip a line cut short by a crash
+			w.logger.Debug("Skipping unreadable journal entry: %v", err)
+			continue
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return results, nil
+}
+
+// DowntimeEstimate summarizes the downtime of recent successful deploys
+type DowntimeEstimate struct {
+	Deploys       int     `json:"deploys"` // Number of deploys the estimate is based on
+	MedianSeconds float64 `json:"median_seconds"`
+	P90Seconds    float64 `json:"p90_seconds"`
+	MaxSeconds    float64 `json:"max_seconds"`
+}
+
+// EstimateDowntime estimates the downtime of the next deploy from the last
+// successful deploys of the container. It returns nil if there are none.
+func (w *Watcher) EstimateDowntime(container string) (*DowntimeEstimate, error) {
+	results, err := w.Journal()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []float64
+	for i := len(results) - 1; i >= 0 && len(samples) < downtimeSample; i-- {
+		r := results[i]
+		if r.Outcome != OutcomeSuccess || r.DowntimeSeconds <= 0 {
+			continue
+		}
+		if container != "" && r.Container != "" && r.Container != container {
+			continue
+		}
+		samples = append(samples, r.DowntimeSeconds)
+	}
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	sort.Float64s(samples)
+	percentile := func(p float64) float64 {
+		return samples[int(p*float64(len(samples)-1)+0.5)]
+	}
+	return &DowntimeEstimate{
+		Deploys:       len(samples),
+		MedianSeconds: percentile(0.5),
+		P90Seconds:    percentile(0.9),
+		MaxSeconds:    samples[len(samples)-1],
+	}, nil
+}
@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// lockSuffix marks a deploy file that is still being written. Uploaders
+// that cannot upload under a temporary name and rename create
+// "<name>.lock" before writing "<name>" and remove it when done.
+const lockSuffix = ".lock"
+
+// lockRemaining reports whether path is locked by an uploader and, if the
+// lock can expire, how long until it is considered stale
+func (w *Watcher) lockRemaining(path string) (bool, time.Duration) {
+	info, err := os.Stat(path + lockSuffix)
+	if err != nil {
+		return false, 0
+	}
+
+	timeout := time.Duration(w.config().LockTimeout)
+	if timeout <= 0 {
+		return true, 0
+	}
+	age := time.Since(info.ModTime())
+	if age >= timeout {
+		w.logger.Warn("Ignoring stale lock %s%s (%v old)", path, lockSuffix, age.Round(time.Second))
+		return false, 0
+	}
+	return true, timeout - age
+}
+
+// waitForLock reports whether path is locked. A locked file is handled
+// again once its lock is removed, or becomes stale.
+func (w *Watcher) waitForLock(path string) bool {
+	locked, remaining := w.lockRemaining(path)
+	if !locked {
+		return false
+	}
+
+	w.logger.Info("Waiting for upload lock to be released: %s%s", path, lockSuffix)
+	if remaining > 0 {
+		time.AfterFunc(remaining, func() {
+			if w.ctx.Err() == nil {
+				w.settler.add(path)
+			}
+		})
+	}
+	return true
+}
+
+// handleLockEvent picks up the locked deploy file once its lock file is
+// removed. It reports whether path was a lock file.
+func (w *Watcher) handleLockEvent(event fsnotify.Event) bool {
+	if !strings.HasSuffix(event.Name, lockSuffix) {
+		return false
+	}
+	path := strings.TrimSuffix(event.Name, lockSuffix)
+	if !w.isDeployFile(path) {
+		return false
+	}
+
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && !utils.FileExists(event.Name) && utils.FileExists(path) {
+		w.logger.Debug("Upload lock released: %s", event.Name)
+		w.settler.add(path)
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// metadataSidecarSuffix names the metadata file uploaded next to a
+// tarball: "<tarball>.meta.json"
+const metadataSidecarSuffix = ".meta.json"
+
+// metadataEnvPrefix starts the hook environment variables of metadata keys
+const metadataEnvPrefix = "FWS_META_"
+
+// deployMetadata collects the metadata of a deploy: the named groups of
+// metadata_filename_regex matched against the tarball name, then the
+// sidecar file, then the trigger file, later sources overriding earlier
+// ones. Metadata is informational, so unreadable sources are only logged.
+func (w *Watcher) deployMetadata(tarballPath string, trigger *Trigger) map[string]string {
+	metadata := make(map[string]string)
+
+	if pattern := w.config().MetadataFilenameRegex; pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			w.logger.Warn("Invalid metadata_filename_regex: %v", err)
+		} else if match := re.FindStringSubmatch(filepath.Base(tarballPath)); match != nil {
+			for i, name := range re.SubexpNames() {
+				if name != "" && match[i] != "" {
+					metadata[name] = match[i]
+				}
+			}
+		} else {
+			w.logger.Debug("Tarball name does not match metadata_filename_regex: %s", filepath.Base(tarballPath))
+		}
+	}
+
+	if w.config().MetadataSidecar {
+		sidecar, err := readMetadataSidecar(tarballPath + metadataSidecarSuffix)
+		if err != nil {
+			w.logger.Warn("Ignoring metadata sidecar: %v", err)
+		}
+		for key, value := range sidecar {
+			metadata[key] = value
+		}
+	}
+
+	if trigger != nil {
+		for key, value := range trigger.Metadata {
+			metadata[key] = value
+		}
+	}
+
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// readMetadataSidecar reads a flat JSON object of strings. A missing file
+// yields no metadata.
+func readMetadataSidecar(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var metadata map[string]string
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode %s (expected an object of strings): %w", path, err)
+	}
+	return metadata, nil
+}
+
+// removeMetadataSidecar removes the sidecar of a tarball that left the
+// watch directory; its content is kept in the deploy journal
+func (w *Watcher) removeMetadataSidecar(tarballPath string) {
+	if !w.config().MetadataSidecar {
+		return
+	}
+	if err := os.Remove(tarballPath + metadataSidecarSuffix); err != nil && !os.IsNotExist(err) {
+		w.logger.Warn("Failed to remove metadata sidecar: %v", err)
+	}
+}
+
+// metadataEnv returns metadata as FWS_META_<KEY>=value variables for
+// hooks, with keys upper-cased and other characters than letters and
+// digits replaced by underscores
+func metadataEnv(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := strings.Map(func(r rune) rune {
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, strings.ToUpper(key))
+		env = append(env, metadataEnvPrefix+name+"="+metadata[key])
+	}
+	return env
+}
+
+// execEnvFlags passes env to a command run with docker exec
+func execEnvFlags(env []string) string {
+	var flags strings.Builder
+	for _, v := range env {
+		flags.WriteString(" -e " + utils.ShellQuote(v))
+	}
+	return flags.String()
+}
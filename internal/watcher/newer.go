@@ -0,0 +1,31 @@
+package watcher
+
+import (
+	"path/filepath"
+
+	"github.com/ahsanumar/fws/internal/imagetar"
+)
+
+// notNewer reports whether deploy_only_newer skips the tarball at path
+// because the timestamp in its name is not newer than the one of the last
+// deployed tarball. The file is left in place. Trigger files and tarballs
+// without a timestamp are always deployed.
+func (w *Watcher) notNewer(path string) bool {
+	if !w.config().DeployOnlyNewer || !isTarball(path) || w.isTriggerFile(path) {
+		return false
+	}
+
+	version := imagetar.NameTimestamp(filepath.Base(path))
+	if version == "" {
+		w.logger.Debug("No timestamp in the name of %s, deploying it regardless of deploy_only_newer", path)
+		return false
+	}
+	deployed := w.state.LastVersion()
+	if version > deployed {
+		return false
+	}
+
+	w.logger.Warn("Skipping %s: its timestamp %s is not newer than the deployed %s", path, version, deployed)
+	w.metrics.Add("fws_watcher_skipped_older_total", "Number of tarballs skipped because they were not newer than the deployed one.", 1)
+	return true
+}
@@ -0,0 +1,126 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ahsanumar/fws/internal/config"
+)
+
+// PlanStep is one step of the deploy pipeline
+type PlanStep struct {
+	Phase       string `json:"phase"`
+	Description string `json:"description"`
+	Downtime    bool   `json:"downtime"` // No container serves requests during this step
+}
+
+// Plan describes the steps of a deploy and how long the container is
+// expected to be down
+type Plan struct {
+	Container string            `json:"container"`
+	Steps     []PlanStep        `json:"steps"`
+	Downtime  *DowntimeEstimate `json:"estimated_downtime,omitempty"` // nil without deploy history
+}
+
+// Plan returns the steps the next deploy runs, with a downtime estimate
+// based on the recorded deploys of the container
+func (w *Watcher) Plan() (*Plan, error) {
+	container := w.ContainerName()
+	displayName := container
+	if displayName == "" {
+		displayName = w.config().ContainerName
+	}
+
+	plan := &Plan{Container: displayName}
+	step := func(phase, description string) {
+		plan.Steps = append(plan.Steps, PlanStep{Phase: phase, Description: description})
+	}
+
+	phases, err := config.DeployPhases(w.config().DeployStrategy)
+	if err != nil {
+		return nil, err
+	}
+	if w.config().PreDeployGateCommand != "" {
+		step("gate", fmt.Sprintf("run %q and skip the deploy unless it exits 0", w.config().PreDeployGateCommand))
+	}
+	for _, phase := range phases {
+		switch phase {
+		case "pre_load":
+			if n := len(w.config().PreLoadCommands); n > 0 {
+				step("pre_load", fmt.Sprintf("run %d pre-load command(s)%s", n, parallelNote(w.config().PreLoadParallelism)))
+			}
+		case "load":
+			description := "load the image from the tarball with docker load"
+			if w.config().PostLoadTransformCommand != "" {
+				description += fmt.Sprintf(", then run %q to pick the image to run", w.config().PostLoadTransformCommand)
+			}
+			if alias := w.config().StableAlias; alias != "" {
+				description += fmt.Sprintf(", tag it as %s:current", alias)
+			}
+			step("load", description)
+		case "stop":
+			if w.config().KeepPreviousContainer {
+				step("stop", fmt.Sprintf("stop container %s and keep it as %s%s", displayName, displayName, previousSuffix))
+			} else {
+				step("stop", fmt.Sprintf("stop and remove container %s", displayName))
+			}
+		}
+	}
+	blueGreen := w.config().DeployStrategy == config.BlueGreen
+	w.captureRuntimeConfig()
+	opts := w.runOptions("<image>", nil)
+	opts.Name = displayName
+	if blueGreen {
+		opts.Name += nextSuffix
+	}
+	step("start", w.buildDockerRunCommand(opts))
+
+	var readiness []string
+	if delay := w.config().WarmupDelay.Duration(); delay > 0 {
+		readiness = append(readiness, fmt.Sprintf("wait %v to warm up", delay))
+	}
+	if w.config().ReadinessCommand != "" {
+		readiness = append(readiness, fmt.Sprintf("retry %q for up to %v", w.config().ReadinessCommand, w.config().ReadinessTimeout.Duration()))
+	}
+	if len(readiness) > 0 {
+		step("readiness", strings.Join(readiness, ", then "))
+	}
+
+	if w.config().SmokeTestCommand != "" {
+		step("smoke_test", fmt.Sprintf("run %q", w.config().SmokeTestCommand))
+	}
+	if blueGreen {
+		stop := "stop and remove " + displayName
+		if w.config().KeepPreviousContainer {
+			stop = fmt.Sprintf("stop %s and keep it as %s%s", displayName, displayName, previousSuffix)
+		}
+		step("switch", fmt.Sprintf("point the proxy on %s at %s%s, %s, then rename %s%s to %s",
+			w.config().ProxyListen, displayName, nextSuffix, stop, displayName, nextSuffix, displayName))
+	}
+	if n := len(w.config().PostLoadCommands); n > 0 {
+		step("post_load", fmt.Sprintf("run %d post-load command(s)%s", n, parallelNote(w.config().PostLoadParallelism)))
+	}
+
+	names := make([]string, len(plan.Steps))
+	for i, s := range plan.Steps {
+		names[i] = s.Phase
+	}
+	for i, down := range downtimeSpan(names) {
+		plan.Steps[i].Downtime = down
+	}
+
+	estimate, err := w.EstimateDowntime(container)
+	if err != nil {
+		return nil, err
+	}
+	plan.Downtime = estimate
+	return plan, nil
+}
+
+// parallelNote describes the parallelism of a hook list in plan steps
+func parallelNote(parallelism int) string {
+	if parallelism <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(", up to %d at once", parallelism)
+}
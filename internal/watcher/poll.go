@@ -0,0 +1,145 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// polledFile is what poll mode knows about a deploy file
+type polledFile struct {
+	size    int64
+	modTime time.Time
+	pending bool // Changed since it was last handed to the settler
+}
+
+// poll lists the watched directories and hands new or changed deploy files
+// to the settler. A file is only handed over once its size and mtime are
+// unchanged between two polls, so files still being copied are skipped.
+// The first poll only records the files already present.
+func (w *Watcher) poll() {
+	first := w.polled == nil
+	if first {
+		w.polled = make(map[string]*polledFile)
+	}
+
+	seen := make(map[string]bool)
+	w.eachWatchedDir(func(dir string) {
+		w.pollDir(dir, first, seen)
+	})
+
+	// Forget removed files so they are seen as new if they come back
+	for path := range w.polled {
+		if !seen[path] {
+			delete(w.polled, path)
+		}
+	}
+}
+
+// pollDir compares the deploy files in dir with the previous poll
+func (w *Watcher) pollDir(dir string, first bool, seen map[string]bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.logger.Warn("Failed to list directory %s: %v", dir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if info.IsDir() {
+			if w.config().Recursive && !w.skipDir(entry.Name(), path) {
+				if err := w.addWatch(path); err != nil {
+					w.logger.Warn("Failed to watch directory %s: %v", path, err)
+				}
+			}
+			continue
+		}
+		if !w.isDeployFile(path) {
+			continue
+		}
+		seen[path] = true
+
+		known, ok := w.polled[path]
+		switch {
+		case !ok:
+			w.polled[path] = &polledFile{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				pending: !first && w.trigger&fsnotify.Create != 0,
+			}
+			if !first {
+				w.logger.Debug("Poll: new file %s", path)
+			}
+		case known.size != info.Size() || !known.modTime.Equal(info.ModTime()):
+			known.size = info.Size()
+			known.modTime = info.ModTime()
+			known.pending = known.pending || w.trigger&fsnotify.Write != 0
+			w.logger.Debug("Poll: changed file %s", path)
+		case known.pending:
+			// Unchanged since the last poll, the upload is complete unless
+			// the uploader still holds a lock
+			if locked, _ := w.lockRemaining(path); locked {
+				continue
+			}
+			known.pending = false
+			w.settler.add(path)
+		}
+	}
+}
+
+// startWatching watches dir with inotify or sets up poll mode. In auto
+// mode, directories on network file systems are polled, and polling is
+// also used when inotify cannot be set up.
+func (w *Watcher) startWatching(dir string) error {
+	mode := w.config().WatchMode
+	if mode == "" || mode == "auto" {
+		mode = "inotify"
+		if fs := networkFilesystem(dir); fs != "" {
+			w.logger.Info("Watch directory is on %s, where file events are unreliable; using poll mode", fs)
+			mode = "poll"
+		}
+	}
+
+	if mode == "inotify" {
+		err := w.watchEvents(dir)
+		if err == nil {
+			w.logger.Info("Watching directory: %s", dir)
+			return nil
+		}
+		if w.config().WatchMode == "inotify" {
+			return err
+		}
+		w.logger.Warn("File events unavailable (%v); using poll mode", err)
+	}
+
+	w.watched = make(map[string]bool)
+	if err := w.addWatch(dir); err != nil {
+		return fmt.Errorf("failed to add directory to watch: %w", err)
+	}
+	w.logger.Info("Polling directory %s every %v", dir, time.Duration(w.config().PollInterval))
+	return nil
+}
+
+// watchEvents creates the file system watcher and adds dir to it
+func (w *Watcher) watchEvents(dir string) error {
+	watcher, err := fsnotify.NewBufferedWatcher(w.config().EventBufferSize)
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	w.watcher = watcher
+	w.watched = make(map[string]bool)
+	if err := w.addWatch(dir); err != nil {
+		watcher.Close()
+		w.watcher = nil
+		return fmt.Errorf("failed to add directory to watch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// PortMapping is a published container port and the host address docker
+// bound it to. Ports published without a host port get an ephemeral one.
+type PortMapping struct {
+	ContainerPort string `json:"container_port"` // e.g. "8080/tcp"
+	HostIP        string `json:"host_ip"`
+	HostPort      string `json:"host_port"`
+}
+
+func (m PortMapping) String() string {
+	return fmt.Sprintf("%s -> %s", m.ContainerPort, net.JoinHostPort(m.HostIP, m.HostPort))
+}
+
+// PublishedPorts returns the port mappings of the managed container as
+// reported by docker port
+func (w *Watcher) PublishedPorts() ([]PortMapping, error) {
+	if w.containerName() == "" {
+		return nil, nil
+	}
+	output, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker port %s", w.containerName()), 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query published ports: %w", err)
+	}
+	return parseDockerPort(output), nil
+}
+
+// parseDockerPort parses docker port output, lines such as
+// "8080/tcp -> 0.0.0.0:32768" or "8080/tcp -> [::]:32768"
+func parseDockerPort(output string) []PortMapping {
+	var mappings []PortMapping
+	for _, line := range strings.Split(output, "\n") {
+		containerPort, host, ok := strings.Cut(strings.TrimSpace(line), " -> ")
+		if !ok {
+			continue
+		}
+		// Older docker versions print IPv6 bindings as ":::32768"
+		i := strings.LastIndex(host, ":")
+		if i < 0 {
+			continue
+		}
+		mappings = append(mappings, PortMapping{
+			ContainerPort: containerPort,
+			HostIP:        strings.Trim(host[:i], "[]"),
+			HostPort:      host[i+1:],
+		})
+	}
+	return mappings
+}
+
+// recordPorts logs the published ports of the new container and stores
+// them in result, so ephemeral host ports can be discovered
+func (w *Watcher) recordPorts(result *DeployResult) {
+	ports, err := w.PublishedPorts()
+	if err != nil {
+		w.logger.Warn("%v", err)
+		return
+	}
+	result.Ports = ports
+	for _, port := range ports {
+		w.logger.Info("Published port: %s", port)
+	}
+}
@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// previousSuffix names the stopped container kept for rollback with
+// keep_previous_container: "<container>-previous"
+const previousSuffix = "-previous"
+
+// previousContainerName returns the name the replaced container is kept
+// under
+func (w *Watcher) previousContainerName() string {
+	return w.containerName() + previousSuffix
+}
+
+// keepPreviousContainer stops the running container and renames it to
+// <container>-previous instead of removing it, replacing any older one.
+// Its restart policy is cleared so docker does not start it again when
+// the daemon restarts.
+func (w *Watcher) keepPreviousContainer() error {
+	name, previous := w.containerName(), w.previousContainerName()
+	id, err := containerID(w.ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to check for container %s: %w", name, err)
+	}
+	if id == "" {
+		w.logger.Debug("No container %s to keep", name)
+		return nil
+	}
+
+	w.logger.Info("Stopping container %s and keeping it as %s", name, previous)
+	if _, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker rm -f %s", previous), 30*time.Second); err != nil {
+		w.logger.Debug("Failed to remove older previous container (may not exist): %v", err)
+	}
+	for _, cmd := range []string{
+		fmt.Sprintf("docker update --restart no %s", name),
+		fmt.Sprintf("docker stop %s", name),
+		fmt.Sprintf("docker rename %s %s", name, previous),
+	} {
+		if _, err := utils.ExecuteCommand(w.ctx, cmd, 30*time.Second); err != nil {
+			return fmt.Errorf("failed to keep previous container: %w", err)
+		}
+	}
+	return nil
+}
+
+// restorePreviousContainer replaces the current container with the kept
+// previous one and starts it. Unless swap is set, the current container is
+// removed; otherwise it is stopped and kept as the previous container in
+// turn. It reports false without error if there is no previous container.
+func (w *Watcher) restorePreviousContainer(swap bool) (bool, error) {
+	name, previous := w.containerName(), w.previousContainerName()
+	id, err := containerID(w.ctx, previous)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for container %s: %w", previous, err)
+	}
+	if id == "" {
+		return false, nil
+	}
+
+	current, err := containerID(w.ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for container %s: %w", name, err)
+	}
+
+	// The current container moves aside under a temporary name while the
+	// previous one takes over its name
+	parked := name + "-rollback"
+	var commands []string
+	switch {
+	case current != "" && swap:
+		commands = append(commands,
+			fmt.Sprintf("docker update --restart no %s", name),
+			fmt.Sprintf("docker stop %s", name),
+			fmt.Sprintf("docker rename %s %s", name, parked))
+	case current != "":
+		commands = append(commands, fmt.Sprintf("docker rm -f %s", name))
+	}
+	commands = append(commands, fmt.Sprintf("docker rename %s %s", previous, name))
+	if current != "" && swap {
+		commands = append(commands, fmt.Sprintf("docker rename %s %s", parked, previous))
+	}
+	if policy := w.config().RestartPolicy; policy != "" {
+		commands = append(commands, fmt.Sprintf("docker update --restart %s %s", policy, name))
+	}
+	commands = append(commands, fmt.Sprintf("docker start %s", name))
+
+	for _, cmd := range commands {
+		if _, err := utils.ExecuteCommand(w.ctx, cmd, 30*time.Second); err != nil {
+			return false, fmt.Errorf("failed to restore previous container: %w", err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// nextSuffix names the container a blue-green deploy starts next to the
+// running one: "<container>-next"
+const nextSuffix = "-next"
+
+// proxyBackend returns the loopback address docker published the proxy
+// backend port of container on
+func (w *Watcher) proxyBackend(container string) (string, error) {
+	if container == "" {
+		return "", fmt.Errorf("no container deployed yet")
+	}
+	portCmd := fmt.Sprintf("docker port %s %d/tcp", container, w.config().ProxyBackendPort)
+	output, err := utils.ExecuteCommand(w.ctx, portCmd, 10*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to query port %d of %s: %w", w.config().ProxyBackendPort, container, err)
+	}
+
+	// Lines such as "127.0.0.1:32768"; container_ports may publish the
+	// port on other addresses as well
+	for _, line := range strings.Fields(output) {
+		host, port, err := net.SplitHostPort(line)
+		if err == nil && host == "127.0.0.1" {
+			return net.JoinHostPort(host, port), nil
+		}
+	}
+	return "", fmt.Errorf("port %d of %s is not published on 127.0.0.1", w.config().ProxyBackendPort, container)
+}
+
+// updateProxyBackend points the proxy at the managed container
+func (w *Watcher) updateProxyBackend() {
+	if w.proxy == nil {
+		return
+	}
+	backend, err := w.proxyBackend(w.containerName())
+	if err != nil {
+		w.logger.Warn("Failed to update proxy backend: %v", err)
+		return
+	}
+	w.proxy.SetBackend(backend)
+}
+
+// proxyEnv tells readiness and smoke test commands where the new
+// container's backend port is published, since with blue-green the proxy
+// still forwards to the old container while they run
+func (w *Watcher) proxyEnv() []string {
+	if w.config().ProxyListen == "" {
+		return nil
+	}
+	backend, err := w.proxyBackend(w.containerName())
+	if err != nil {
+		w.logger.Warn("%v", err)
+		return nil
+	}
+	return []string{"FWS_BACKEND=" + backend}
+}
+
+// startNextContainer makes the deploy work on <container>-next, removing
+// one left behind by an interrupted deploy
+func (w *Watcher) startNextContainer() {
+	next := w.containerName() + nextSuffix
+	w.logger.Info("Starting the new container as %s next to the running one", next)
+	if _, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker rm -f %s", next), 30*time.Second); err != nil {
+		w.logger.Debug("Failed to remove stale container %s (may not exist): %v", next, err)
+	}
+	w.setContainer(next)
+}
+
+// discardNextContainer removes the new container of a failed blue-green
+// deploy, leaving the old one serving
+func (w *Watcher) discardNextContainer() {
+	next := w.containerName()
+	w.setContainer(strings.TrimSuffix(next, nextSuffix))
+	w.logger.Warn("Removing new container %s, %s keeps serving", next, w.containerName())
+	if _, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker rm -f %s", next), 30*time.Second); err != nil {
+		w.logger.Warn("Failed to remove container %s: %v", next, err)
+	}
+}
+
+// switchToNextContainer points the proxy at the ready <container>-next,
+// stops the old container and gives the new one its name
+func (w *Watcher) switchToNextContainer() error {
+	next := w.containerName()
+	name := strings.TrimSuffix(next, nextSuffix)
+
+	backend, err := w.proxyBackend(next)
+	if err != nil {
+		w.discardNextContainer()
+		return err
+	}
+	w.proxy.SetBackend(backend)
+
+	// Connections still open to the old container end when it stops
+	w.setContainer(name)
+	if err := w.stopAndRemoveContainer(); err != nil {
+		w.logger.Warn("Failed to stop/remove existing container: %v", err)
+	}
+
+	renameCmd := fmt.Sprintf("docker rename %s %s", next, name)
+	if _, err := utils.ExecuteCommand(w.ctx, renameCmd, 30*time.Second); err != nil {
+		w.setContainer(next)
+		return fmt.Errorf("failed to rename %s to %s: %w", next, name, err)
+	}
+	w.logger.Info("Switched to the new container, renamed %s to %s", next, name)
+	return nil
+}
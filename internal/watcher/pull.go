@@ -0,0 +1,144 @@
+package watcher
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/storage"
+)
+
+// pullFromS3 periodically moves new tarballs and trigger files from the
+// configured bucket into the watch directory, where they are picked up
+// like local uploads
+func (w *Watcher) pullFromS3() {
+	store, err := storage.NewS3(storage.S3Options{
+		Endpoint: w.config().S3.Endpoint,
+		Region:   w.config().S3.Region,
+		Bucket:   w.config().S3.Bucket,
+		Prefix:   w.config().S3.Prefix,
+	})
+	if err != nil {
+		w.logger.Error("Failed to set up S3 pulling: %v", err)
+		return
+	}
+
+	w.logger.Info("Pulling tarballs from s3://%s/%s every %v", w.config().S3.Bucket, w.config().S3.Prefix, time.Duration(w.config().S3PollInterval))
+	w.pullLoop("S3", "fws_watcher_s3_pull_errors_total", time.Duration(w.config().S3PollInterval), func() (storage.Storage, func(), error) {
+		return store, func() {}, nil
+	})
+}
+
+// pullLoop pulls from the store connect opens every interval until the
+// watcher stops, counting failed pulls in errorsMetric
+func (w *Watcher) pullLoop(source, errorsMetric string, interval time.Duration, connect func() (storage.Storage, func(), error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		store, closeStore, err := connect()
+		if err == nil {
+			err = w.pullOnce(store, source)
+			closeStore()
+		}
+		if err != nil {
+			w.metrics.Add(errorsMetric, fmt.Sprintf("Number of failed %s pulls.", source), 1)
+			w.logger.Error("%s pull failed: %v", source, err)
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pulledNamePattern matches the file names pulled from a bucket or another
+// host: no path separators, shell metacharacters or leading dash or dot
+var pulledNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._+@:,=-]*$`)
+
+// validPulledName reports whether a file name from a less trusted place,
+// such as a bucket listing or a trigger file, is safe to use
+func validPulledName(name string) bool {
+	return pulledNamePattern.MatchString(name)
+}
+
+// pullOnce downloads every deploy file in store. Tarballs are pulled
+// before trigger files so a trigger never references a missing tarball.
+func (w *Watcher) pullOnce(store storage.Storage, source string) error {
+	names, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	var pull []string
+	for _, name := range names {
+		if !isTarball(name) && !w.isDeployFile(name) {
+			continue
+		}
+		if !validPulledName(name) {
+			w.logger.Warn("Not pulling %q from %s, only letters, digits and ._+@:,=- are allowed in names", name, source)
+			continue
+		}
+		pull = append(pull, name)
+	}
+	sort.SliceStable(pull, func(i, j int) bool {
+		return isTarball(pull[i]) && !isTarball(pull[j])
+	})
+
+	for _, name := range pull {
+		if w.ctx.Err() != nil {
+			return nil
+		}
+
+		dest := filepath.Join(w.config().WatchDirectory, name)
+		if _, err := os.Stat(dest); err == nil {
+			w.logger.Debug("Skipping %s, already in watch directory", name)
+			continue
+		}
+
+		w.logger.Info("Pulling %s from %s", name, source)
+		if err := downloadObject(store, name, dest); err != nil {
+			return err
+		}
+		if err := store.Delete(name); err != nil {
+			w.logger.Warn("Failed to delete %s from %s: %v", name, source, err)
+		}
+	}
+	return nil
+}
+
+// downloadObject writes an object to a temporary file next to dest and
+// renames it into place once complete
+func downloadObject(store storage.Storage, name, dest string) error {
+	r, err := store.Get(name)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	defer r.Close()
+
+	tmp := dest + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move %s into place: %w", name, err)
+	}
+	return nil
+}
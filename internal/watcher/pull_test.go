@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// memoryStore serves a fixed listing, like a bucket or an ssh_source
+// directory
+type memoryStore map[string]string
+
+func (s memoryStore) Put(name string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	s[name] = string(data)
+	return err
+}
+
+func (s memoryStore) List() ([]string, error) {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s memoryStore) Get(name string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewBufferString(s[name])), nil
+}
+
+func (s memoryStore) Delete(name string) error {
+	delete(s, name)
+	return nil
+}
+
+func TestPullOnceSkipsUnsafeNames(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWatcher(&config.WatcherConfig{WatchDirectory: dir}, utils.NewLogger("error"))
+	defer w.cancel()
+
+	store := memoryStore{
+		"myapp_v2_20240101-120000.tar": "image",
+		"a$(touch pwned).tar":          "image",
+		"-rf.tar":                      "image",
+		"a;id.tar":                     "image",
+		"a b.tar":                      "image",
+		"x\n$(id).tar":                 "image",
+		"notes.txt":                    "text",
+	}
+	if err := w.pullOnce(store, "SSH"); err != nil {
+		t.Fatalf("pullOnce: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pulled []string
+	for _, entry := range entries {
+		pulled = append(pulled, entry.Name())
+	}
+	if len(pulled) != 1 || pulled[0] != "myapp_v2_20240101-120000.tar" {
+		t.Errorf("pulled %q, want only the safely named tarball", pulled)
+	}
+
+	// Skipped objects stay where they are
+	left, _ := store.List()
+	sort.Strings(left)
+	if len(left) != 6 {
+		t.Errorf("left %q in the store, want the 6 skipped files", left)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a$(touch pwned).tar")); !os.IsNotExist(err) {
+		t.Errorf("unsafe name was downloaded: %v", err)
+	}
+}
+
+func TestValidPulledName(t *testing.T) {
+	tests := map[string]bool{
+		"myapp_v1_20240101-120000.tar": true,
+		"myapp_1.2.3+build.tar.zst":    true,
+		"release.deploy.json":          true,
+		"":                             false,
+		"a$(id).tar":                   false,
+		"a`id`.tar":                    false,
+		"-rf.tar":                      false,
+		".hidden.tar":                  false,
+		"../escape.tar":                false,
+		"dir/app.tar":                  false,
+		"a b.tar":                      false,
+		"a'b.tar":                      false,
+	}
+	for name, want := range tests {
+		if got := validPulledName(name); got != want {
+			t.Errorf("validPulledName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// quarantineReportInterval is how often the size of the quarantine is
+// logged and old files are pruned while watching
+const quarantineReportInterval = time.Hour
+
+// QuarantinedFile is a file kept in the quarantine directory after a
+// failed deploy: a tarball, trigger file or script
+type QuarantinedFile struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ListQuarantine returns the quarantined files, newest first
+func (w *Watcher) ListQuarantine() ([]QuarantinedFile, error) {
+	dir := w.config().QuarantinePath()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine directory: %w", err)
+	}
+
+	var files []QuarantinedFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, QuarantinedFile{
+			Name:    entry.Name(),
+			Path:    filepath.Join(dir, entry.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime.After(files[j].ModTime)
+	})
+	return files, nil
+}
+
+// ClearQuarantine removes all quarantined files and returns them
+func (w *Watcher) ClearQuarantine() ([]QuarantinedFile, error) {
+	files, err := w.ListQuarantine()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []QuarantinedFile
+	for _, file := range files {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove %s: %w", file.Path, err)
+		}
+		removed = append(removed, file)
+	}
+	return removed, nil
+}
+
+// pruneQuarantine removes the quarantined files beyond quarantine_keep and
+// those older than quarantine_max_age
+func (w *Watcher) pruneQuarantine() {
+	keep := w.config().QuarantineKeep
+	maxAge := w.config().QuarantineMaxAge.Duration()
+	if keep <= 0 && maxAge <= 0 {
+		return
+	}
+
+	files, err := w.ListQuarantine()
+	if err != nil {
+		w.logger.Warn("Failed to prune quarantine: %v", err)
+		return
+	}
+	for i, file := range files {
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && time.Since(file.ModTime) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		w.logger.Info("Removing old quarantined file: %s", file.Path)
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			w.logger.Warn("Failed to remove quarantined file: %v", err)
+		}
+	}
+}
+
+// reportQuarantine prunes the quarantine and logs and exports its size
+func (w *Watcher) reportQuarantine() {
+	w.pruneQuarantine()
+
+	files, err := w.ListQuarantine()
+	if err != nil {
+		w.logger.Warn("Failed to read quarantine: %v", err)
+		return
+	}
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+
+	w.metrics.Set("fws_watcher_quarantine_files", "Number of files in the quarantine directory.", float64(len(files)))
+	w.metrics.Set("fws_watcher_quarantine_bytes", "Total size of the files in the quarantine directory.", float64(size))
+	if len(files) > 0 {
+		w.logger.Info("Quarantine holds %d file(s), %s, in %s", len(files), utils.FormatBytes(size), w.config().QuarantinePath())
+	}
+}
@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"time"
+)
+
+// deployWindow is the period MaxDeploysPerMinute applies to
+const deployWindow = time.Minute
+
+// deployLimiter is a sliding-window circuit breaker for deploys
+type deployLimiter struct {
+	max     int
+	recent  []time.Time
+	tripped bool
+}
+
+// allow records a deploy attempt at now and reports whether it may proceed.
+// The second result reports whether the breaker state changed, so callers
+// can log the transition once rather than for every event.
+func (l *deployLimiter) allow(now time.Time) (bool, bool) {
+	if l.max <= 0 {
+		return true, false
+	}
+
+	// Drop attempts that left the window
+	cutoff := now.Add(-deployWindow)
+	kept := l.recent[:0]
+	for _, t := range l.recent {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	l.recent = kept
+
+	if len(l.recent) >= l.max {
+		changed := !l.tripped
+		l.tripped = true
+		return false, changed
+	}
+
+	changed := l.tripped
+	l.tripped = false
+	l.recent = append(l.recent, now)
+	return true, changed
+}
+
+// reopensIn returns how long after now the oldest recorded attempt leaves
+// the window, freeing a slot for the next deploy
+func (l *deployLimiter) reopensIn(now time.Time) time.Duration {
+	if len(l.recent) == 0 {
+		return 0
+	}
+	return l.recent[0].Add(deployWindow).Sub(now)
+}
+
+// retryWhenAllowed remembers path, skipped while the breaker is tripped,
+// and hands the latest path skipped that way back to the settler once the
+// breaker lets deploys through again, so the newest tarball of a storm is
+// still deployed
+func (w *Watcher) retryWhenAllowed(path string, now time.Time) {
+	w.skippedMu.Lock()
+	defer w.skippedMu.Unlock()
+
+	w.skipped = path
+	if w.skippedRetry != nil {
+		return
+	}
+	w.skippedRetry = time.AfterFunc(w.limiter.reopensIn(now), func() {
+		w.skippedMu.Lock()
+		path := w.skipped
+		w.skipped = ""
+		w.skippedRetry = nil
+		w.skippedMu.Unlock()
+
+		if w.ctx.Err() == nil {
+			w.logger.Info("Retrying %s, the newest tarball skipped while deploys were paused", path)
+			w.settler.add(path)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// readinessInterval is the pause between readiness command attempts
+const readinessInterval = 2 * time.Second
+
+// waitForReadiness waits for the warm-up delay and then retries the
+// readiness command until it succeeds or the readiness timeout expires
+func (w *Watcher) waitForReadiness() error {
+	if delay := w.config().WarmupDelay.Duration(); delay > 0 {
+		w.logger.Info("Waiting %v for container to warm up...", delay)
+		select {
+		case <-time.After(delay):
+		case <-w.ctx.Done():
+			return fmt.Errorf("interrupted during warm-up")
+		}
+	}
+
+	if w.config().ReadinessCommand == "" {
+		return nil
+	}
+
+	readinessCmd := w.config().ReadinessCommand
+	if w.config().ReadinessInContainer {
+		readinessCmd = fmt.Sprintf("docker exec %s sh -c %s",
+			w.containerName(), utils.ShellQuote(w.config().ReadinessCommand))
+	}
+
+	w.logger.Info("Waiting for container to become ready: %s", w.config().ReadinessCommand)
+
+	env := w.proxyEnv()
+	deadline := time.Now().Add(w.config().ReadinessTimeout.Duration())
+	for attempt := 1; ; attempt++ {
+		output, err := utils.ExecuteCommandWithEnv(w.ctx, readinessCmd, env, w.config().ReadinessTimeout.Duration())
+		if err == nil {
+			w.logger.Info("Container is ready")
+			return nil
+		}
+
+		w.logger.Debug("Readiness attempt %d failed: %s", attempt, strings.TrimSpace(output))
+		if time.Now().Add(readinessInterval).After(deadline) {
+			return fmt.Errorf("readiness command still failing after %v: %w", w.config().ReadinessTimeout.Duration(), err)
+		}
+
+		select {
+		case <-time.After(readinessInterval):
+		case <-w.ctx.Done():
+			return fmt.Errorf("interrupted while waiting for readiness")
+		}
+	}
+}
+
+// runSmokeTest runs the configured smoke test against the new container.
+// The container name, image, port mappings and deploy metadata are passed
+// in the environment.
+func (w *Watcher) runSmokeTest(image string, metadata map[string]string) error {
+	if w.config().SmokeTestCommand == "" {
+		return nil
+	}
+
+	w.logger.Info("Running smoke test: %s", w.config().SmokeTestCommand)
+
+	env := []string{
+		"FWS_CONTAINER=" + w.containerName(),
+		"FWS_IMAGE=" + image,
+		"FWS_PORTS=" + strings.Join(w.config().ContainerPort, ","),
+	}
+	env = append(env, metadataEnv(metadata)...)
+	env = append(env, w.proxyEnv()...)
+	output, err := utils.ExecuteCommandWithEnv(w.ctx, w.config().SmokeTestCommand, env, w.config().SmokeTestTimeout.Duration())
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(output) != "" {
+		w.logger.Debug("Smoke test output: %s", strings.TrimSpace(output))
+	}
+	w.logger.Info("Smoke test passed")
+	return nil
+}
+
+// currentContainerImage returns the image ID of the managed container, or
+// an empty string if it does not exist
+func (w *Watcher) currentContainerImage() string {
+	inspectCmd := fmt.Sprintf("docker inspect -f '{{.Image}}' %s", w.containerName())
+	output, err := utils.ExecuteCommand(w.ctx, inspectCmd, 10*time.Second)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(output)
+}
+
+// rollback replaces a failed container with the previous container kept by
+// keep_previous_container, or else with one running the previous image. It
+// reports whether the previous image is running again.
+func (w *Watcher) rollback(previousImage string) bool {
+	if !w.config().RollbackOnFailure {
+		return false
+	}
+
+	// Starting the kept container is faster than creating a new one
+	if w.config().KeepPreviousContainer {
+		w.logger.Warn("Rolling back container %s to %s", w.containerName(), w.previousContainerName())
+		restored, err := w.restorePreviousContainer(false)
+		if err != nil {
+			w.logger.Warn("Failed to restore previous container, restarting the previous image instead: %v", err)
+		} else if restored {
+			w.logger.Info("Rollback completed: %s is running the previous container", w.containerName())
+			return true
+		}
+	}
+
+	if previousImage == "" {
+		w.logger.Warn("Rollback skipped: no previous container image known")
+		return false
+	}
+
+	w.logger.Warn("Rolling back container %s to previous image %s", w.containerName(), previousImage)
+
+	removeCmd := fmt.Sprintf("docker rm -f %s", w.containerName())
+	if _, err := utils.ExecuteCommand(w.ctx, removeCmd, 30*time.Second); err != nil {
+		w.logger.Debug("Failed to remove failed container: %v", err)
+	}
+
+	if err := w.startContainer(previousImage, nil); err != nil {
+		w.logger.Error("Rollback failed: %v", err)
+		return false
+	}
+
+	w.logger.Info("Rollback completed: %s is running the previous image", w.containerName())
+	return true
+}
@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"slices"
+	"time"
+)
+
+// Deploy outcomes
+const (
+	OutcomeSuccess    = "success"
+	OutcomeFailed     = "failed"
+	OutcomeRolledBack = "rolled_back"
+)
+
+// PhaseResult is the timing and outcome of one step of a deploy
+type PhaseResult struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+
+	start time.Time
+}
+
+// DeployResult is the canonical description of a finished deploy. The
+// control API, metrics and logs all report from it rather than re-deriving
+// the details.
+type DeployResult struct {
+	Tarball         string        `json:"tarball"`
+	Image           string        `json:"image,omitempty"`             // Image reference the container was started from
+	Container       string        `json:"container,omitempty"`         // Name of the container that was replaced
+	PreviousImageID string        `json:"previous_image_id,omitempty"` // Image ID of the container that was replaced
+	NewImageID      string        `json:"new_image_id,omitempty"`      // Image ID of the new container
+	Ports           []PortMapping `json:"ports,omitempty"`             // Ports published by the new container
+	StartedAt       time.Time     `json:"started_at"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	DowntimeSeconds float64       `json:"downtime_seconds,omitempty"` // From stopping the old container until the new one was ready
+	Phases          []PhaseResult `json:"phases"`
+	Outcome         string        `json:"outcome"`
+	Error           string        `json:"error,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"` // Deploy metadata from the file name, sidecar and trigger file
+
+	// Run-once pre-load commands executed by this deploy
+	onceCommands []string
+	// Overrides from the trigger file, if the deploy was triggered by one
+	trigger *Trigger
+	// Images docker load reported loading
+	loaded loadedImages
+}
+
+func newDeployResult(tarballPath string) *DeployResult {
+	return &DeployResult{
+		Tarball:   tarballPath,
+		StartedAt: time.Now(),
+	}
+}
+
+// phase runs one step of the deploy and records its duration and error
+func (r *DeployResult) phase(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	p := PhaseResult{Name: name, DurationSeconds: time.Since(start).Seconds(), start: start}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	r.Phases = append(r.Phases, p)
+	return err
+}
+
+// FailedPhase returns the name of the phase that failed, or an empty string
+func (r *DeployResult) FailedPhase() string {
+	for _, p := range r.Phases {
+		if p.Error != "" {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// downtimeSpan reports which phases no container serves requests in:
+// everything from stopping the old container until the new one is ready
+// (or started, when there is no readiness phase)
+func downtimeSpan(phases []string) []bool {
+	end := slices.Index(phases, "readiness")
+	if end < 0 {
+		end = slices.Index(phases, "start")
+	}
+	down := make([]bool, len(phases))
+	start := slices.Index(phases, "stop")
+	if start < 0 {
+		return down
+	}
+	for i := start; i < len(phases) && (end < start || i <= end); i++ {
+		down[i] = true
+	}
+	return down
+}
+
+// finish records the outcome of the deploy
+func (r *DeployResult) finish(err error, rolledBack bool) {
+	r.DurationSeconds = time.Since(r.StartedAt).Seconds()
+	names := make([]string, len(r.Phases))
+	for i, p := range r.Phases {
+		names[i] = p.Name
+	}
+	for i, down := range downtimeSpan(names) {
+		if down {
+			r.DowntimeSeconds += r.Phases[i].DurationSeconds
+		}
+	}
+	switch {
+	case err == nil:
+		r.Outcome = OutcomeSuccess
+	case rolledBack:
+		r.Outcome = OutcomeRolledBack
+	default:
+		r.Outcome = OutcomeFailed
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
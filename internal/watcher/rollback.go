@@ -0,0 +1,173 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// Rollback methods, fastest first
+const (
+	RollbackPreviousContainer = "previous_container" // Started the container kept by keep_previous_container
+	RollbackPreviousImage     = "previous_image"     // Started a new container from the image of the previous deploy
+	RollbackPreviousTarball   = "previous_tarball"   // Redeployed the archived tarball of the previous deploy
+)
+
+// RollbackResult is the outcome of a rollback
+type RollbackResult struct {
+	Container string `json:"container"`
+	Method    string `json:"method"`             // One of the Rollback* methods
+	ImageID   string `json:"image_id,omitempty"` // Image ID of the container now running
+	Tarball   string `json:"tarball,omitempty"`  // Redeployed tarball, for previous_tarball
+	State     string `json:"state"`              // Container state after the rollback
+	Ready     bool   `json:"ready"`              // Whether the container passed the readiness check
+	Error     string `json:"error,omitempty"`
+}
+
+// Rollback returns the container to the previous deploy, using the
+// fastest way available: the container kept by keep_previous_container,
+// else a new container from the previous deploy's image if docker still
+// has it, else the previous deploy's tarball from the archive directory.
+// The rolled back container is checked for readiness. Rolling back again
+// switches forward.
+func (w *Watcher) Rollback() (*RollbackResult, error) {
+	if err := w.loadState(); err != nil {
+		return nil, err
+	}
+	if w.containerName() == "" {
+		return nil, fmt.Errorf("no container has been deployed yet")
+	}
+
+	result, err := w.rollbackContainerOrImage()
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		// Redeploying takes the deploy lock itself
+		return w.rollbackTarball()
+	}
+
+	if err := w.waitForReadiness(); err != nil {
+		result.Error = fmt.Sprintf("container did not become ready: %v", err)
+	} else {
+		result.Ready = true
+	}
+	w.finishRollback(result)
+	if result.Error != "" {
+		return result, fmt.Errorf("%s", result.Error)
+	}
+	return result, nil
+}
+
+// rollbackContainerOrImage rolls back by starting the kept previous
+// container or the previous image. It returns nil if neither is available.
+func (w *Watcher) rollbackContainerOrImage() (*RollbackResult, error) {
+	w.deployMu.Lock()
+	defer w.deployMu.Unlock()
+
+	if w.config().KeepPreviousContainer {
+		w.logger.Info("Rolling back container %s to %s", w.containerName(), w.previousContainerName())
+		restored, err := w.restorePreviousContainer(true)
+		if err != nil {
+			return nil, err
+		}
+		if restored {
+			return &RollbackResult{Container: w.containerName(), Method: RollbackPreviousContainer}, nil
+		}
+		w.logger.Info("No previous container %s, looking for the previous deploy", w.previousContainerName())
+	}
+
+	previous, err := w.previousDeploy()
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil || previous.NewImageID == "" || !imageExists(w.ctx, previous.NewImageID) {
+		return nil, nil
+	}
+
+	w.logger.Info("Rolling back container %s to image %s of the deploy at %s", w.containerName(),
+		previous.NewImageID, previous.StartedAt.Format(time.RFC3339))
+	if err := w.stopAndRemoveContainer(); err != nil {
+		w.logger.Warn("Failed to stop/remove existing container: %v", err)
+	}
+	if err := w.startContainer(previous.NewImageID, nil); err != nil {
+		return nil, fmt.Errorf("failed to start previous image: %w", err)
+	}
+	return &RollbackResult{Container: w.containerName(), Method: RollbackPreviousImage}, nil
+}
+
+// rollbackTarball redeploys the archived tarball of the previous deploy
+func (w *Watcher) rollbackTarball() (*RollbackResult, error) {
+	previous, err := w.previousDeploy()
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return nil, fmt.Errorf("nothing to roll back to: no earlier successful deploy of %s in the journal", w.containerName())
+	}
+	if w.config().ArchiveDirectory == "" {
+		return nil, fmt.Errorf("nothing to roll back to: image %s of the previous deploy is gone and archive_directory is not configured", previous.NewImageID)
+	}
+	tarball := filepath.Join(w.config().ArchiveDirectory, filepath.Base(previous.Tarball))
+	if !utils.FileExists(tarball) {
+		return nil, fmt.Errorf("nothing to roll back to: image %s of the previous deploy is gone and %s is not archived", previous.NewImageID, tarball)
+	}
+
+	w.logger.Info("Rolling back container %s by redeploying %s", w.containerName(), tarball)
+	deploy, err := w.processTarball(tarball, true, nil)
+	result := &RollbackResult{
+		Container: w.containerName(),
+		Method:    RollbackPreviousTarball,
+		Tarball:   tarball,
+		ImageID:   deploy.NewImageID,
+		Ready:     err == nil,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	w.finishRollback(result)
+	return result, err
+}
+
+// previousDeploy returns the latest successful deploy of the container
+// that did not deploy the image it runs now, or nil if there is none
+func (w *Watcher) previousDeploy() (*DeployResult, error) {
+	results, err := w.Journal()
+	if err != nil {
+		return nil, err
+	}
+
+	current := w.currentContainerImage()
+	for i := len(results) - 1; i >= 0; i-- {
+		r := results[i]
+		if r.Outcome == OutcomeSuccess && r.Container == w.containerName() && r.NewImageID != current {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// finishRollback records the state of the rolled back container
+func (w *Watcher) finishRollback(result *RollbackResult) {
+	if result.ImageID == "" {
+		result.ImageID = w.currentContainerImage()
+	}
+	w.updateProxyBackend()
+	info, err := w.InspectContainer()
+	if err != nil {
+		w.logger.Warn("Failed to inspect container after rollback: %v", err)
+	}
+	result.State = info.State
+	if result.Ready {
+		w.logger.Info("Rollback completed: %s is %s with image %s", result.Container, result.State, result.ImageID)
+	}
+}
+
+// imageExists reports whether docker has the image
+func imageExists(ctx context.Context, image string) bool {
+	_, err := utils.ExecuteCommand(ctx, fmt.Sprintf("docker image inspect %s", image), 10*time.Second)
+	return err == nil
+}
@@ -0,0 +1,63 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// secretsDir returns the host directory holding the secret files of
+// container
+func (w *Watcher) secretsDir(container string) string {
+	return filepath.Join(w.config().SecretsDirectory, container)
+}
+
+// writeSecrets reads the configured secrets and writes them to files only
+// the watcher's user can read. Each file is replaced by a rename, so a
+// container still running keeps the value it was started with.
+func (w *Watcher) writeSecrets(container string) error {
+	if len(w.config().Secrets) == 0 {
+		return nil
+	}
+
+	dir := w.secretsDir(container)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return fmt.Errorf("failed to restrict secrets directory: %w", err)
+	}
+
+	for _, secret := range w.config().Secrets {
+		value, err := secret.Value()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, secret.Name)
+		tmp := path + ".tmp"
+		os.Remove(tmp)
+		if err := os.WriteFile(tmp, value, 0400); err != nil {
+			return fmt.Errorf("failed to write secret %s: %w", secret.Name, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write secret %s: %w", secret.Name, err)
+		}
+		w.logger.Debug("Wrote secret %s for %s", secret.Name, secret.TargetPath())
+	}
+	return nil
+}
+
+// secretMounts returns the docker run options mounting the secret files of
+// container read-only at their targets
+func (w *Watcher) secretMounts(container string) []string {
+	var mounts []string
+	for _, secret := range w.config().Secrets {
+		source := filepath.Join(w.secretsDir(container), secret.Name)
+		mount := fmt.Sprintf("type=bind,source=%s,target=%s,readonly", source, secret.TargetPath())
+		mounts = append(mounts, "--mount "+utils.ShellQuote(mount))
+	}
+	return mounts
+}
@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// settler implements the "settle then newest wins" policy for event bursts.
+// Every event for a path restarts that path's timer and the path is only
+// handed on once no further events arrived for the settle delay, so a file
+// written in many chunks is processed exactly once in its final state.
+type settler struct {
+	ctx     context.Context
+	delay   time.Duration
+	ready   chan string
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+}
+
+func newSettler(ctx context.Context, delay time.Duration) *settler {
+	return &settler{
+		ctx:     ctx,
+		delay:   delay,
+		ready:   make(chan string),
+		pending: make(map[string]*time.Timer),
+	}
+}
+
+// add records an event for path. It reports whether the event superseded an
+// earlier one that was still settling.
+func (s *settler) add(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if timer, ok := s.pending[path]; ok && timer.Stop() {
+		timer.Reset(s.delay)
+		return true
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.delay, func() {
+		s.mu.Lock()
+		if s.pending[path] == timer {
+			delete(s.pending, path)
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.ready <- path:
+		case <-s.ctx.Done():
+		}
+	})
+	s.pending[path] = timer
+	return false
+}
+
+// len returns the number of paths still settling
+func (s *settler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pending)
+}
@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/ahsanumar/fws/internal/storage"
+)
+
+// pullFromSSH periodically moves new tarballs and trigger files from the
+// ssh_source directory into the watch directory. A new connection is made
+// for every pull, so a dropped connection only delays the next one.
+func (w *Watcher) pullFromSSH() {
+	src := w.config().SSHSource
+	w.logger.Info("Pulling tarballs from %s@%s:%s every %v", src.User, src.Host, src.Directory, time.Duration(w.config().SSHSourcePollInterval))
+	w.pullLoop("SSH", "fws_watcher_ssh_pull_errors_total", time.Duration(w.config().SSHSourcePollInterval), func() (storage.Storage, func(), error) {
+		client, err := w.dialSSHSource()
+		if err != nil {
+			return nil, nil, err
+		}
+		return storage.NewSSH(client, src.Directory), func() { client.Close() }, nil
+	})
+}
+
+// dialSSHSource connects to the ssh_source host. The host key must match
+// host_key_fingerprint or ~/.ssh/known_hosts; unknown hosts are refused.
+func (w *Watcher) dialSSHSource() (*ssh.Client, error) {
+	src := w.config().SSHSource
+
+	key, err := os.ReadFile(src.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh_source key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh_source key: %w", err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if src.HostKeyFingerprint != "" {
+		hostKeyCallback = storage.PinnedHostKey(src.HostKeyFingerprint)
+	} else {
+		hostKeyCallback, err = knownhosts.New(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts, add the host or set ssh_source.host_key_fingerprint: %w", err)
+		}
+	}
+
+	port := src.Port
+	if port == 0 {
+		port = 22
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(src.Host, strconv.Itoa(port)), &ssh.ClientConfig{
+		User:            src.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", src.Host, err)
+	}
+	return client, nil
+}
@@ -0,0 +1,46 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/ahsanumar/fws/internal/tracing"
+)
+
+// SetTracer sets the exporter deploys are traced to
+func (w *Watcher) SetTracer(tracer *tracing.Exporter) {
+	w.tracer = tracer
+}
+
+// deployTrace describes a finished deploy as a trace: one span for the
+// deploy with a child span per phase
+func deployTrace(result *DeployResult) *tracing.Span {
+	root := &tracing.Span{
+		Name:  "deploy",
+		Start: result.StartedAt,
+		End:   result.StartedAt.Add(seconds(result.DurationSeconds)),
+		Error: result.Error,
+		Attributes: map[string]string{
+			"fws.tarball": result.Tarball,
+			"fws.outcome": result.Outcome,
+		},
+	}
+	if result.Image != "" {
+		root.Attributes["fws.image"] = result.Image
+	}
+	if result.Container != "" {
+		root.Attributes["fws.container"] = result.Container
+	}
+	for key, value := range result.Metadata {
+		root.Attributes["fws.meta."+key] = value
+	}
+
+	for _, p := range result.Phases {
+		span := root.Child(p.Name, p.start, p.start.Add(seconds(p.DurationSeconds)))
+		span.Error = p.Error
+	}
+	return root
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
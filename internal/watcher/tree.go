@@ -0,0 +1,142 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// addWatch adds dir to the file system watcher. In recursive mode its
+// subdirectories are added too, following symlinks. Every directory is
+// tracked by its resolved path, so symlink cycles and directories reachable
+// through several links are only watched once.
+func (w *Watcher) addWatch(dir string) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if w.watched[resolved] {
+		w.logger.Debug("Skipping already watched directory %s (%s)", dir, resolved)
+		return nil
+	}
+
+	// In poll mode the directory is only recorded and listed periodically
+	if w.watcher != nil {
+		if err := w.watcher.Add(resolved); err != nil {
+			return err
+		}
+	}
+	w.watched[resolved] = true
+
+	if !w.config().Recursive {
+		return nil
+	}
+
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		sub := filepath.Join(resolved, entry.Name())
+		if w.skipDir(entry.Name(), sub) {
+			continue
+		}
+
+		info, err := os.Stat(sub)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if err := w.addWatch(sub); err != nil {
+			w.logger.Warn("Failed to watch directory %s: %v", sub, err)
+		}
+	}
+
+	return nil
+}
+
+// skipDir reports whether a subdirectory should not be watched: hidden
+// directories and the directories the watcher itself writes to
+func (w *Watcher) skipDir(name, path string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	for _, own := range []string{w.config().QuarantinePath(), w.config().ArchiveDirectory, w.config().BlobPath(), w.config().BasePath()} {
+		if own == "" {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(own); err == nil && resolved == path {
+			return true
+		}
+	}
+	return false
+}
+
+// rescan looks through all watched directories for deploy files and new
+// subdirectories. It recovers events that were dropped when the event
+// queue overflowed; files found are handled as if they had just been
+// written.
+func (w *Watcher) rescan() {
+	found := 0
+	w.eachWatchedDir(func(dir string) {
+		found += w.rescanDir(dir)
+	})
+
+	w.logger.Info("Rescan found %d file(s) to process", found)
+}
+
+// eachWatchedDir calls fn for every watched directory, including those
+// added while iterating
+func (w *Watcher) eachWatchedDir(fn func(dir string)) {
+	scanned := make(map[string]bool)
+	for {
+		// Directories picked up during the scan are scanned in the next round
+		var dirs []string
+		for dir := range w.watched {
+			if !scanned[dir] {
+				dirs = append(dirs, dir)
+			}
+		}
+		if len(dirs) == 0 {
+			return
+		}
+		for _, dir := range dirs {
+			scanned[dir] = true
+			fn(dir)
+		}
+	}
+}
+
+// rescanDir handles the entries of a single watched directory and returns
+// the number of deploy files found
+func (w *Watcher) rescanDir(dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.logger.Warn("Failed to rescan directory %s: %v", dir, err)
+		return 0
+	}
+
+	found := 0
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if info.IsDir() {
+			if w.config().Recursive && !w.skipDir(entry.Name(), path) {
+				if err := w.addWatch(path); err != nil {
+					w.logger.Warn("Failed to watch directory %s: %v", path, err)
+				}
+			}
+			continue
+		}
+
+		if w.isDeployFile(path) {
+			w.settler.add(path)
+			found++
+		}
+	}
+	return found
+}
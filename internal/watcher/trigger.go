@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/imagetar"
+)
+
+// Trigger is the content of a trigger file. It names a tarball that was
+// fully uploaded next to it and carries per-deploy overrides.
+type Trigger struct {
+	Tarball        string   `json:"tarball"`         // Tarball file name, relative to the trigger file
+	Image          string   `json:"image"`           // Image to run instead of the resolved one (optional)
+	ContainerEnv   []string `json:"container_env"`   // Environment variables added to container_env (optional)
+	ContainerPorts []string `json:"container_ports"` // Port mappings replacing container_ports (optional)
+
+	Metadata map[string]string `json:"metadata"` // Deploy metadata, overriding other sources (optional)
+}
+
+// readTrigger parses a trigger file and returns it with the path of the
+// tarball it refers to
+func readTrigger(path string) (*Trigger, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read trigger file: %w", err)
+	}
+
+	var trigger Trigger
+	if err := json.Unmarshal(data, &trigger); err != nil {
+		return nil, "", fmt.Errorf("failed to decode trigger file %s: %w", path, err)
+	}
+
+	// Only tarballs next to the trigger file may be referenced
+	name := trigger.Tarball
+	if !validPulledName(name) {
+		return nil, "", fmt.Errorf("invalid tarball in trigger file %s: %q", path, name)
+	}
+
+	// The upload directory is less trusted than the config, so the image
+	// must not be anything but a reference
+	if trigger.Image != "" {
+		if err := config.ValidateImageReference(trigger.Image); err != nil {
+			return nil, "", fmt.Errorf("invalid trigger file %s: %w", path, err)
+		}
+	}
+
+	return &trigger, filepath.Join(filepath.Dir(path), name), nil
+}
+
+// isDeployFile reports whether events for path should be handled: files
+// matching a file action, or without file_actions, trigger files when
+// trigger_file_pattern is set and tarballs otherwise
+func (w *Watcher) isDeployFile(path string) bool {
+	return w.fileAction(path) != ""
+}
+
+// isTriggerFile reports whether path matches trigger_file_pattern
+func (w *Watcher) isTriggerFile(path string) bool {
+	if w.config().TriggerFilePattern == "" {
+		return false
+	}
+	matched, _ := filepath.Match(w.config().TriggerFilePattern, filepath.Base(path))
+	return matched
+}
+
+// isTarball reports whether name is an image tarball, plain, zstd or gzip
+// compressed
+func isTarball(name string) bool {
+	return strings.HasSuffix(imagetar.TrimCompressionExt(name), ".tar")
+}
+
+// processTrigger deploys the tarball referenced by a trigger file. The
+// trigger file is removed after a successful deploy and quarantined with
+// the tarball after a failed one.
+func (w *Watcher) processTrigger(path string) error {
+	w.logger.Info("Processing trigger file: %s", path)
+
+	trigger, tarballPath, err := readTrigger(path)
+	if err != nil {
+		if qerr := w.quarantineTarball(path); qerr != nil {
+			w.logger.Warn("Failed to quarantine trigger file: %v", qerr)
+		}
+		return err
+	}
+
+	_, err = w.processTarball(tarballPath, false, trigger)
+	if errors.Is(err, ErrInterrupted) || errors.Is(err, ErrChecksumMismatch) || (errors.Is(err, ErrDeployGated) && !w.config().PreDeployGateQuarantine) {
+		return err
+	}
+	if err != nil && !errors.Is(err, ErrCleanupFailed) {
+		if qerr := w.quarantineTarball(path); qerr != nil {
+			w.logger.Warn("Failed to quarantine trigger file: %v", qerr)
+		}
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		w.logger.Warn("Failed to remove trigger file: %v", err)
+	}
+	return err
+}
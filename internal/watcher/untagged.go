@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahsanumar/fws/internal/utils"
+)
+
+// loadedImages is what docker load reported loading
+type loadedImages struct {
+	Refs []string // "Loaded image: <ref>" lines of tagged images
+	IDs  []string // "Loaded image ID: <id>" lines of untagged images
+}
+
+// parseLoadOutput collects the loaded images from docker load output
+func parseLoadOutput(output string) loadedImages {
+	var loaded loadedImages
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if id, ok := strings.CutPrefix(line, "Loaded image ID: "); ok {
+			loaded.IDs = append(loaded.IDs, strings.TrimSpace(id))
+		} else if ref, ok := strings.CutPrefix(line, "Loaded image: "); ok {
+			loaded.Refs = append(loaded.Refs, strings.TrimSpace(ref))
+		}
+	}
+	return loaded
+}
+
+// untaggedImage returns the image to run for a tarball without repo tags.
+// docker load only reports the ID of such an image, which is either run by
+// ID or, by default, tagged as <container_name>:latest first so it shows up
+// by name in docker ps and docker images.
+func (w *Watcher) untaggedImage(loaded loadedImages) (string, error) {
+	if len(loaded.IDs) == 0 {
+		w.logger.Warn("Tarball has no repo tags, using container name as image name")
+		return w.config().ContainerName, nil
+	}
+	id := loaded.IDs[0]
+	if len(loaded.IDs) > 1 {
+		w.logger.Warn("docker load reported %d untagged images, running the first: %s", len(loaded.IDs), id)
+	}
+
+	if w.config().UntaggedImages == "id" {
+		w.logger.Info("Tarball has no repo tags, running the loaded image by ID: %s", id)
+		return id, nil
+	}
+
+	tag := untaggedRepository(w.config().ContainerName) + ":latest"
+	if _, err := utils.ExecuteCommand(w.ctx, fmt.Sprintf("docker tag %s %s", id, tag), 30*time.Second); err != nil {
+		return "", fmt.Errorf("failed to tag untagged image %s as %s: %w", id, tag, err)
+	}
+	w.logger.Info("Tarball has no repo tags, tagged the loaded image %s as %s to run it by name (set untagged_images to \"id\" to run it by ID instead)", id, tag)
+	return tag, nil
+}
+
+// untaggedRepository turns a container name into a valid repository name:
+// lower case, with characters docker does not allow in repositories
+// replaced by dashes
+func untaggedRepository(container string) string {
+	repo := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, container)
+	return strings.TrimLeft(repo, "._-")
+}
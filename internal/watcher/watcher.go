@@ -2,34 +2,108 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
 	"github.com/ahsanumar/fws/internal/config"
+	"github.com/ahsanumar/fws/internal/dlock"
+	"github.com/ahsanumar/fws/internal/imagetar"
+	"github.com/ahsanumar/fws/internal/metrics"
+	"github.com/ahsanumar/fws/internal/proxy"
+	"github.com/ahsanumar/fws/internal/state"
+	"github.com/ahsanumar/fws/internal/tracing"
 	"github.com/ahsanumar/fws/internal/utils"
 )
 
 type Watcher struct {
-	config  *config.WatcherConfig
-	logger  *utils.Logger
-	watcher *fsnotify.Watcher
-	ctx     context.Context
-	cancel  context.CancelFunc
+	settings atomic.Pointer[config.WatcherConfig] // Replaced as a whole on reload, read with config()
+	logger   *utils.Logger
+	watcher  *fsnotify.Watcher
+	state    *state.State
+	limiter  deployLimiter
+	metrics  *metrics.Registry
+	watched  map[string]bool
+	trigger  fsnotify.Op
+	settler  *settler
+	locker   dlock.Locker // Distributed deploy lock, nil when not configured
+	polled   map[string]*polledFile
+	paused   atomic.Bool
+	deployMu sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	lastMu     sync.Mutex
+	lastDeploy *DeployResult
+	container  string // Container of the running or last deploy
+
+	reload func() (*config.WatcherConfig, error) // Loads the config for reload_config, nil when unavailable
+
+	cleanupFailures int   // Deploys in a row whose tarball cleanup failed, guarded by deployMu
+	stopErr         error // Returned by Run once the watcher stopped itself
+
+	tracer *tracing.Exporter // nil when tracing is not configured
+
+	events eventLog // Recently handled files
+
+	deployEvents chan<- DeployEvent // Receives deploy progress, nil when disabled
+
+	proxy *proxy.Proxy // Built-in proxy, nil when not configured
+
+	inheritMu sync.Mutex
+	inherited *runtimeConfig // Taken from the running container with inherit_runtime_config, nil until captured
+
+	skippedMu    sync.Mutex
+	skipped      string      // Newest file skipped by the deploy rate breaker
+	skippedRetry *time.Timer // Hands skipped back to the settler, nil when not scheduled
+
+	stableMu    sync.Mutex
+	stableSizes map[string]int64 // Size of deploy files found stable, until they are handled
+	sizeWaits   map[string]bool  // Deploy files whose size is being polled
 }
 
+// ErrInterrupted is returned for a deploy cut short by stopping the
+// watcher. Its tarball is left in place rather than quarantined.
+var ErrInterrupted = errors.New("deploy interrupted by shutdown")
+
 func NewWatcher(cfg *config.WatcherConfig, logger *utils.Logger) *Watcher {
-	ctx, cancel := context.WithCancel(context.Background())
-	return &Watcher{
-		config: cfg,
-		logger: logger,
-		ctx:    ctx,
-		cancel: cancel,
+	// Every command run with the watcher's context reaches the daemon to
+	// deploy to
+	ctx, cancel := context.WithCancel(utils.WithEnv(context.Background(), cfg.DockerEnv()...))
+	w := &Watcher{
+		logger:  logger,
+		limiter: deployLimiter{max: cfg.MaxDeploysPerMinute},
+		trigger: triggerOps(cfg.TriggerOn),
+		metrics: metrics.NewRegistry(),
+		ctx:     ctx,
+		cancel:  cancel,
+
+		stableSizes: make(map[string]int64),
+		sizeWaits:   make(map[string]bool),
 	}
+	w.settings.Store(cfg)
+	// A deploy by another fws process is picked up once the old backend
+	// stops answering
+	w.proxy = proxy.New(cfg.ProxyListen, func() (string, error) {
+		return w.proxyBackend(w.containerName())
+	}, logger)
+	return w
+}
+
+// config returns the current settings. A reload stores a new config
+// instead of changing this one, so it may be read without locking.
+func (w *Watcher) config() *config.WatcherConfig {
+	return w.settings.Load()
 }
 
 // Run starts the file watcher daemon
@@ -37,40 +111,117 @@ func (w *Watcher) Run() error {
 	w.logger.Info("Starting file watcher daemon...")
 
 	// Ensure watch directory exists
-	if err := utils.EnsureDir(w.config.WatchDirectory); err != nil {
+	if err := utils.EnsureDir(w.config().WatchDirectory); err != nil {
 		return fmt.Errorf("failed to create watch directory: %w", err)
 	}
 
-	// Create file system watcher
-	var err error
-	w.watcher, err = fsnotify.NewWatcher()
+	// Load persistent state
+	if err := w.loadState(); err != nil {
+		return err
+	}
+
+	// Resolve symlinks so event paths are stable
+	watchDir, err := filepath.EvalSymlinks(w.config().WatchDirectory)
 	if err != nil {
-		return fmt.Errorf("failed to create file watcher: %w", err)
+		return fmt.Errorf("failed to resolve watch directory: %w", err)
+	}
+	if watchDir != filepath.Clean(w.config().WatchDirectory) {
+		w.logger.Info("Watch directory %s resolves to %s", w.config().WatchDirectory, watchDir)
+	}
+
+	if err := w.startWatching(watchDir); err != nil {
+		return err
+	}
+	if w.watcher != nil {
+		defer w.watcher.Close()
+	}
+
+	w.settler = newSettler(w.ctx, time.Duration(w.config().SettleDelay))
+
+	if w.locker, err = w.newLocker(); err != nil {
+		return err
+	}
+
+	if w.proxy != nil {
+		w.updateProxyBackend()
+		if err := w.proxy.Start(); err != nil {
+			return fmt.Errorf("failed to start proxy: %w", err)
+		}
+		defer w.proxy.Close()
+	}
+
+	if w.config().S3.Enabled() {
+		go w.pullFromS3()
+	}
+	if w.config().SSHSource.Enabled() {
+		go w.pullFromSSH()
+	}
+
+	// Poll mode has no event channels; receiving from nil channels blocks
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	var pollTick <-chan time.Time
+	if w.watcher != nil {
+		events = w.watcher.Events
+		watchErrors = w.watcher.Errors
+	} else {
+		ticker := time.NewTicker(time.Duration(w.config().PollInterval))
+		defer ticker.Stop()
+		pollTick = ticker.C
+		w.poll()
 	}
-	defer w.watcher.Close()
 
-	// Add directory to watch
-	if err := w.watcher.Add(w.config.WatchDirectory); err != nil {
-		return fmt.Errorf("failed to add directory to watch: %w", err)
+	// Exit once nothing was deployed for idle_timeout
+	var idle <-chan time.Time
+	started := time.Now()
+	if timeout := w.config().IdleTimeout.Duration(); timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		idle = timer.C
+		w.logger.Info("Exiting after %v without a deploy", timeout)
 	}
 
-	w.logger.Info("Watching directory: %s", w.config.WatchDirectory)
+	// Keep an eye on the quarantine growing
+	w.reportQuarantine()
+	quarantineTick := time.NewTicker(quarantineReportInterval)
+	defer quarantineTick.Stop()
 
 	// Start processing events
 	for {
 		select {
 		case <-w.ctx.Done():
 			w.logger.Info("File watcher stopped")
-			return nil
-		case event, ok := <-w.watcher.Events:
+			return w.stopErr
+		case <-idle:
+			if remaining := w.idleRemaining(started); remaining > 0 {
+				idle = time.After(remaining)
+				continue
+			}
+			w.logger.Info("No deploy within %v, stopping file watcher", w.config().IdleTimeout.Duration())
+			w.cancel()
+			return ErrIdleTimeout
+		case event, ok := <-events:
 			if !ok {
 				return fmt.Errorf("file watcher events channel closed")
 			}
 			w.handleFileEvent(event)
-		case err, ok := <-w.watcher.Errors:
+		case <-pollTick:
+			w.poll()
+		case <-quarantineTick.C:
+			w.reportQuarantine()
+		case path := <-w.settler.ready:
+			w.handleSettled(path)
+		case err, ok := <-watchErrors:
 			if !ok {
 				return fmt.Errorf("file watcher errors channel closed")
 			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Events were dropped; look for anything that was missed
+				w.metrics.Add("fws_watcher_event_overflows_total", "Number of times the file event queue overflowed.", 1)
+				w.logger.Warn("File event queue overflowed, rescanning watched directories")
+				w.rescan()
+				continue
+			}
 			w.logger.Error("File watcher error: %v", err)
 		}
 	}
@@ -82,34 +233,179 @@ func (w *Watcher) Stop() {
 	w.cancel()
 }
 
+// Deploy runs the deploy pipeline for a tarball outside the watch loop.
+// The tarball is cleaned up, archived or quarantined like a watched one.
+func (w *Watcher) Deploy(tarballPath string) (*DeployResult, error) {
+	if err := w.loadState(); err != nil {
+		return nil, err
+	}
+	return w.processTarball(tarballPath, false, nil)
+}
+
+// Replay redeploys a tarball from the archive, leaving the file in place
+func (w *Watcher) Replay(tarballPath string) (*DeployResult, error) {
+	if err := w.loadState(); err != nil {
+		return nil, err
+	}
+	return w.processTarball(tarballPath, true, nil)
+}
+
+func (w *Watcher) loadState() error {
+	if w.state != nil {
+		return nil
+	}
+
+	st, err := state.Load(w.config().StatePath())
+	if err != nil {
+		return err
+	}
+	w.state = st
+	return nil
+}
+
 func (w *Watcher) handleFileEvent(event fsnotify.Event) {
-	// Only process .tar files
-	if !strings.HasSuffix(event.Name, ".tar") {
+	// Pick up new subdirectories in recursive mode
+	if w.config().Recursive && event.Op&fsnotify.Create == fsnotify.Create {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := w.addWatch(event.Name); err != nil {
+				w.logger.Warn("Failed to watch new directory %s: %v", event.Name, err)
+			}
+			return
+		}
+	}
+
+	// A removed lock releases the file it protected
+	if w.handleLockEvent(event) {
+		return
+	}
+
+	// Only process tarballs, or trigger files when configured
+	if !w.isDeployFile(event.Name) {
 		return
 	}
 
 	w.logger.Debug("File event: %s %s", event.Op, event.Name)
 
-	// Handle file creation and write events
-	if event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Write == fsnotify.Write {
-		w.logger.Info("New tarball detected: %s", event.Name)
+	// Only react to the configured operations
+	if event.Op&w.trigger == 0 {
+		return
+	}
+
+	// A rename is reported under the old name, which usually no longer
+	// exists; the file's new name arrives as a create event
+	if event.Op&fsnotify.Rename == fsnotify.Rename && !utils.FileExists(event.Name) {
+		w.logger.Debug("Ignoring rename away from %s", event.Name)
+		return
+	}
+
+	// Wait for the file to settle; only its final state is processed
+	if w.settler.add(event.Name) {
+		w.metrics.Add("fws_watcher_discarded_events_total", "Number of intermediate file events superseded by a later event for the same path.", 1)
+		w.logger.Debug("Tarball still changing, waiting for it to settle: %s", event.Name)
+		return
+	}
+
+	w.logger.Info("New tarball detected: %s", event.Name)
+}
+
+// handleSettled processes a tarball once no more events arrived for it
+// within the settle delay
+func (w *Watcher) handleSettled(path string) {
+	if !utils.FileExists(path) {
+		w.logger.Debug("Tarball disappeared before it settled: %s", path)
+		return
+	}
+
+	// Another uploader is still writing the file
+	if w.waitForLock(path) {
+		return
+	}
+
+	// The file was modified too recently to be trusted as complete
+	if w.waitForAge(path) {
+		return
+	}
 
-		// Wait a bit to ensure file is fully written
-		time.Sleep(2 * time.Second)
+	// The file is still growing, e.g. on a slow link without file events
+	if w.waitForStableSize(path) {
+		return
+	}
+
+	if w.Paused() {
+		w.logger.Warn("Skipping tarball while processing is paused: %s", path)
+		return
+	}
+
+	action := w.fileAction(path)
+	w.events.add(FileEvent{Time: time.Now(), Path: path, Action: action})
+
+	// Scripts and config reloads are not deploys
+	switch action {
+	case config.ActionRunScript:
+		w.runScriptFile(path)
+		return
+	case config.ActionReloadConfig:
+		w.reloadConfig(path)
+		return
+	}
+
+	// An older build left in the directory must not replace a newer one
+	if w.notNewer(path) {
+		return
+	}
 
-		// Process the tarball
-		if err := w.processTarball(event.Name); err != nil {
-			w.logger.Error("Failed to process tarball %s: %v", event.Name, err)
+	// Guard against deploy storms
+	now := time.Now()
+	allowed, changed := w.limiter.allow(now)
+	if !allowed {
+		if changed {
+			w.logger.Warn("More than %d deploys in the last minute, pausing processing until the rate subsides", w.config().MaxDeploysPerMinute)
 		}
+		w.logger.Warn("Skipping tarball while deploys are paused: %s", path)
+		w.retryWhenAllowed(path, now)
+		return
+	}
+	if changed {
+		w.logger.Info("Deploy rate back to normal, resuming processing")
+	}
+
+	// Another watcher sharing the directory may be deploying the file
+	release, ok := w.acquireDeployLock(path)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Process the trigger file or tarball
+	if w.isTriggerFile(path) {
+		err := w.processTrigger(path)
+		if err != nil && !errors.Is(err, ErrDeployGated) && !errors.Is(err, ErrChecksumMismatch) {
+			w.logger.Error("Failed to process trigger file %s: %v", path, err)
+		}
+		w.stopOnCleanupFailure(err)
+		return
 	}
+	_, err := w.processTarball(path, false, nil)
+	if err != nil && !errors.Is(err, ErrDeployGated) && !errors.Is(err, ErrChecksumMismatch) {
+		w.logger.Error("Failed to process tarball %s: %v", path, err)
+	}
+	w.stopOnCleanupFailure(err)
 }
 
-func (w *Watcher) processTarball(tarballPath string) error {
+// processTarball deploys a tarball, applying the overrides of trigger if
+// set. Unless keep is set, the tarball is removed (or archived) after a
+// successful deploy and quarantined after a failed one.
+func (w *Watcher) processTarball(tarballPath string, keep bool, trigger *Trigger) (*DeployResult, error) {
 	w.logger.Info("Processing tarball: %s", tarballPath)
+	result := newDeployResult(tarballPath)
+	result.trigger = trigger
+	result.Metadata = w.deployMetadata(tarballPath, trigger)
 
 	// Check if file exists and is readable
 	if !utils.FileExists(tarballPath) {
-		return fmt.Errorf("tarball does not exist: %s", tarballPath)
+		err := fmt.Errorf("tarball does not exist: %s", tarballPath)
+		result.finish(err, false)
+		return result, err
 	}
 
 	// Get file size for logging
@@ -120,68 +416,405 @@ func (w *Watcher) processTarball(tarballPath string) error {
 		w.logger.Info("Processing tarball: %s (%s)", filepath.Base(tarballPath), utils.FormatBytes(size))
 	}
 
-	// Execute pre-load commands
-	if err := w.executePreLoadCommands(); err != nil {
-		return fmt.Errorf("pre-load commands failed: %w", err)
+	// A truncated or incomplete tarball would fail in docker load
+	if err := w.verifyChecksum(tarballPath); err != nil {
+		result.finish(err, false)
+		if errors.Is(err, ErrChecksumMismatch) {
+			w.logger.Warn("Skipping %s, leaving it in place: %v", filepath.Base(tarballPath), err)
+		}
+		return result, err
+	}
+
+	// Only one deploy may run at a time
+	w.deployMu.Lock()
+	defer w.deployMu.Unlock()
+
+	// External systems may veto the deploy before anything changes
+	if err := w.checkDeployGate(result); err != nil {
+		result.finish(err, false)
+		if !errors.Is(err, ErrDeployGated) {
+			return result, fmt.Errorf("%w: %v", ErrInterrupted, err)
+		}
+		w.logger.Warn("Skipping deploy of %s, the running container keeps serving: %v", filepath.Base(tarballPath), err)
+		if !keep && w.config().PreDeployGateQuarantine {
+			w.removeMetadataSidecar(tarballPath)
+			w.removeChecksumFile(tarballPath)
+			if qerr := w.quarantineTarball(tarballPath); qerr != nil {
+				w.logger.Warn("Failed to quarantine tarball: %v", qerr)
+			}
+		}
+		return result, err
+	}
+
+	// Run the deploy pipeline
+	result.StartedAt = time.Now()
+	w.emit(EventStarted, result)
+	rolledBack, err := w.deploy(result)
+	if rolledBack {
+		w.updateProxyBackend()
+	}
+	result.finish(err, rolledBack)
+	w.recordDeploy(result)
+	if err != nil {
+		w.emit(EventFailed, result)
+	}
+	if err != nil && w.ctx.Err() != nil {
+		w.logger.Warn("Deploy of %s interrupted by shutdown, leaving it in place", filepath.Base(tarballPath))
+		return result, fmt.Errorf("%w: %v", ErrInterrupted, err)
+	}
+	// An interrupted deploy is retried with its metadata and checksum after
+	// a restart
+	if !keep {
+		w.removeMetadataSidecar(tarballPath)
+		w.removeChecksumFile(tarballPath)
+	}
+	if err != nil {
+		// Keep the failing artifact around for debugging
+		if !keep {
+			if qerr := w.quarantineTarball(tarballPath); qerr != nil {
+				w.logger.Warn("Failed to quarantine tarball: %v", qerr)
+			}
+		}
+		return result, err
+	}
+
+	// Layers of earlier slim tarballs are no longer needed
+	w.pruneBlobs(tarballPath)
+
+	// Clean up tarball only once the deploy is confirmed
+	var cleanupErr error
+	if !keep {
+		cleanupErr = w.cleanupDeployedTarball(tarballPath)
 	}
 
-	// Load Docker image from tarball
-	if err := w.loadDockerImage(tarballPath); err != nil {
-		return fmt.Errorf("failed to load Docker image: %w", err)
+	// Remember the container, run-once commands and version now that the
+	// deploy succeeded
+	w.state.SetContainer(result.Container)
+	w.state.MarkOnce(result.onceCommands...)
+	if version := imagetar.NameTimestamp(filepath.Base(tarballPath)); version != "" {
+		w.state.SetVersion(version)
+	}
+	if err := w.state.Save(); err != nil {
+		w.logger.Warn("Failed to save state: %v", err)
 	}
 
-	// Stop and remove existing container
-	if err := w.stopAndRemoveContainer(); err != nil {
-		w.logger.Warn("Failed to stop/remove existing container: %v", err)
+	// Remove images of older deploys to this container
+	if w.config().KeepImages > 0 {
+		if err := w.tagManagedImage(result); err != nil {
+			w.logger.Warn("Failed to mark deployed image: %v", err)
+		} else if err := w.collectImages(result.Container); err != nil {
+			w.logger.Warn("Failed to remove old images: %v", err)
+		}
+	}
+
+	w.showLogsAfterDeploy()
+
+	w.emit(EventCompleted, result)
+	w.logger.Info("Tarball processing completed successfully in %.1fs", result.DurationSeconds)
+	return result, cleanupErr
+}
+
+// deploy runs the deploy pipeline for a tarball, recording each phase in
+// result. The deploy is only considered successful once the new container
+// is ready and the post-load commands have passed; a failure once the old
+// container was stopped, including one of the post-load commands, rolls
+// back with rollback_on_failure. It reports whether a failed deploy was
+// rolled back to the previous image.
+func (w *Watcher) deploy(result *DeployResult) (bool, error) {
+	phases, err := config.DeployPhases(w.config().DeployStrategy)
+	if err != nil {
+		return false, err
+	}
+
+	// Read the runtime config before the old container is stopped
+	w.captureRuntimeConfig()
+
+	// Once the old container is gone, any failure restarts the previous image
+	stopped := false
+	fail := func(err error) (bool, error) {
+		if stopped {
+			return w.rollback(result.PreviousImageID), err
+		}
+		return false, err
+	}
+
+	var image string
+	for _, phase := range phases {
+		switch phase {
+		case "pre_load":
+			// Execute pre-load commands
+			err := result.phase("pre_load", func() error {
+				var err error
+				result.onceCommands, err = w.executePreLoadCommands(metadataEnv(result.Metadata))
+				return err
+			})
+			if err != nil {
+				return fail(fmt.Errorf("pre-load commands failed: %w", err))
+			}
+		case "load":
+			// Load Docker image from tarball
+			err := result.phase("load", func() error {
+				return w.retry(func() error {
+					var err error
+					result.loaded, err = w.loadDockerImage(result.Tarball)
+					return err
+				})
+			})
+			if err != nil {
+				return fail(fmt.Errorf("failed to load Docker image: %w", err))
+			}
+			if image, err = w.prepareContainer(result); err != nil {
+				return fail(err)
+			}
+			w.emit(EventImageLoaded, result)
+		case "stop":
+			// Remember the image of the running container for rollback
+			result.PreviousImageID = w.currentContainerImage()
+
+			// Stop and remove existing container
+			result.phase("stop", func() error {
+				if err := w.stopAndRemoveContainer(); err != nil {
+					w.logger.Warn("Failed to stop/remove existing container: %v", err)
+				}
+				return nil
+			})
+			stopped = true
+			w.emit(EventContainerStopped, result)
+		}
+	}
+
+	// With blue-green the new container starts next to the running one,
+	// which keeps serving until the new one passed its checks
+	var blueGreen bool
+	if w.config().DeployStrategy == config.BlueGreen {
+		result.PreviousImageID = w.currentContainerImage()
+		if blueGreen = result.PreviousImageID != ""; blueGreen {
+			w.startNextContainer()
+		}
+	}
+	abort := func(err error) (bool, error) {
+		if blueGreen {
+			w.discardNextContainer()
+			return false, err
+		}
+		return w.rollback(result.PreviousImageID), err
 	}
 
 	// Start new container
-	if err := w.startContainer(); err != nil {
-		return fmt.Errorf("failed to start container: %w", err)
+	err = result.phase("start", func() error {
+		return w.retry(func() error { return w.startContainer(image, result.trigger) })
+	})
+	if err != nil {
+		return abort(fmt.Errorf("failed to start container: %w", err))
 	}
+	result.NewImageID = w.currentContainerImage()
+	w.recordPorts(result)
+	if !blueGreen {
+		w.updateProxyBackend()
+	}
+	w.emit(EventContainerStarted, result)
 
-	// Execute post-load commands
-	if err := w.executePostLoadCommands(); err != nil {
-		w.logger.Warn("Post-load commands failed: %v", err)
+	// Wait for the new container to become ready
+	if err := result.phase("readiness", w.waitForReadiness); err != nil {
+		return abort(fmt.Errorf("container did not become ready: %w", err))
 	}
+	w.emit(EventHealthPassed, result)
 
-	// Clean up tarball
-	if err := w.cleanupTarball(tarballPath); err != nil {
-		w.logger.Warn("Failed to cleanup tarball: %v", err)
+	// Run the application's smoke test against the ready container
+	if err := result.phase("smoke_test", func() error { return w.runSmokeTest(image, result.Metadata) }); err != nil {
+		return abort(fmt.Errorf("smoke test failed: %w", err))
 	}
 
-	w.logger.Info("Tarball processing completed successfully")
-	return nil
+	// Send new connections to the new container and retire the old one
+	if blueGreen {
+		if err := result.phase("switch", w.switchToNextContainer); err != nil {
+			return false, fmt.Errorf("failed to switch to the new container: %w", err)
+		}
+		w.emit(EventContainerStopped, result)
+	}
+
+	// Execute post-load commands
+	err = result.phase("post_load", func() error {
+		onceCommands, err := w.executePostLoadCommands(metadataEnv(result.Metadata))
+		result.onceCommands = append(result.onceCommands, onceCommands...)
+		return err
+	})
+	if err != nil {
+		// The new container already serves, blue-green included, so it is
+		// replaced by the previous image like after any later failure
+		return w.rollback(result.PreviousImageID), fmt.Errorf("post-load commands failed: %w", err)
+	}
+
+	return false, nil
 }
 
-func (w *Watcher) executePreLoadCommands() error {
-	if len(w.config.PreLoadCommands) == 0 {
-		return nil
+// prepareContainer resolves the image and container name of a loaded
+// tarball and checks the new container's options, so that with the default
+// strategy problems surface while the old container is still running
+func (w *Watcher) prepareContainer(result *DeployResult) (string, error) {
+	image, err := w.resolveImage(result.Tarball, result.trigger, result.loaded)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve image name: %w", err)
+	}
+	if image, err = w.transformImage(image); err != nil {
+		return "", err
+	}
+	result.Image = image
+	container, err := w.renderContainerName(image, result.Tarball)
+	if err != nil {
+		return "", err
+	}
+	result.Container = container
+	w.setContainer(container)
+	if err := w.runOptions(image, result.trigger).Validate(); err != nil {
+		return "", fmt.Errorf("invalid docker run options: %w", err)
+	}
+	if w.config().StableAlias != "" {
+		if image, err = w.tagStableAlias(image); err != nil {
+			return "", err
+		}
+		result.Image = image
+	}
+	return image, nil
+}
+
+// executePreLoadCommands runs the pre-load commands, skipping run-once
+// commands that already completed. It returns the run-once commands that
+// were executed so they can be recorded once the deploy succeeds.
+func (w *Watcher) executePreLoadCommands(env []string) ([]string, error) {
+	if len(w.config().PreLoadCommands) == 0 {
+		return nil, nil
+	}
+
+	var commands []utils.ShellCommand
+	var onceCommands []string
+	for _, cmd := range w.config().PreLoadCommands {
+		if cmd.Once {
+			if w.state.OnceDone(cmd.String()) {
+				w.logger.Debug("Skipping run-once command: %s", cmd)
+				continue
+			}
+			onceCommands = append(onceCommands, cmd.String())
+		}
+		commands = append(commands, cmd.ShellCommand())
 	}
 
 	w.logger.Info("Executing pre-load commands...")
-	return utils.ExecuteCommands(w.config.PreLoadCommands, 5*time.Minute, w.logger)
+	if err := utils.ExecuteCommandsParallel(w.ctx, commands, env, w.config().PreLoadParallelism, 5*time.Minute, w.logger); err != nil {
+		return nil, err
+	}
+	return onceCommands, nil
 }
 
-func (w *Watcher) loadDockerImage(tarballPath string) error {
+// loadDockerImage loads the image archive and returns the images docker
+// load reports
+func (w *Watcher) loadDockerImage(tarballPath string) (loadedImages, error) {
 	w.logger.Info("Loading Docker image from tarball: %s", tarballPath)
 
-	loadCmd := fmt.Sprintf("docker load -i %s", tarballPath)
-	output, err := utils.ExecuteCommand(loadCmd, 10*time.Minute)
+	output, err := w.runDockerLoad(tarballPath)
 	if err != nil {
-		return err
+		return loadedImages{}, err
 	}
 
 	w.logger.Debug("Docker load output: %s", strings.TrimSpace(output))
-	return nil
+	return parseLoadOutput(output), nil
+}
+
+// runDockerLoad feeds the tarball to docker load and returns its output
+func (w *Watcher) runDockerLoad(tarballPath string) (string, error) {
+	// Tarballs from base_image uploads lack the base layers
+	if err := w.ensureBaseImage(tarballPath); err != nil {
+		return "", err
+	}
+
+	// Slim tarballs from incremental uploads are reassembled on the fly
+	index, err := imagetar.ReadLayerIndex(tarballPath)
+	if err != nil {
+		return "", err
+	}
+	if index != nil {
+		return w.loadSlimImage(tarballPath, len(index.Layers))
+	}
+
+	format, err := imagetar.DetectCompression(tarballPath)
+	if err != nil {
+		return "", err
+	}
+	if format != "" {
+		return w.loadCompressedImage(tarballPath, format)
+	}
+
+	loadCmd := fmt.Sprintf("docker load -i %s", utils.ShellQuote(tarballPath))
+	return utils.ExecuteCommand(w.ctx, loadCmd, 10*time.Minute)
+}
+
+// loadSlimImage streams the reassembled image archive of a slim tarball
+// into docker load
+func (w *Watcher) loadSlimImage(tarballPath string, layers int) (string, error) {
+	w.logger.Info("Reassembling slim tarball with %d layers from %s", layers, w.config().BlobPath())
+
+	pr, pw := io.Pipe()
+	reconstructErr := make(chan error, 1)
+	go func() {
+		err := imagetar.Reconstruct(tarballPath, w.config().BlobPath(), pw)
+		pw.CloseWithError(err)
+		reconstructErr <- err
+	}()
+
+	output, err := utils.ExecuteCommandWithInput(w.ctx, "docker load", pr, 10*time.Minute)
+	pr.Close()
+	// A closed pipe only means docker load stopped reading; its own error
+	// says why
+	if rerr := <-reconstructErr; rerr != nil && !errors.Is(rerr, io.ErrClosedPipe) {
+		return "", fmt.Errorf("failed to reassemble slim tarball: %w", rerr)
+	}
+	return output, err
+}
+
+// loadCompressedImage streams a zstd or gzip compressed tarball into
+// docker load, decompressing it on the fly instead of writing the archive
+// to disk
+func (w *Watcher) loadCompressedImage(tarballPath, format string) (string, error) {
+	w.logger.Info("Decompressing %s tarball into docker load", format)
+
+	file, err := imagetar.Open(tarballPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(pw, file)
+		pw.CloseWithError(err)
+		copyErr <- err
+	}()
+
+	output, err := utils.ExecuteCommandWithInput(w.ctx, "docker load", pr, 10*time.Minute)
+	pr.Close()
+	// A closed pipe only means docker load stopped reading; its own error
+	// says why
+	if cerr := <-copyErr; cerr != nil && !errors.Is(cerr, io.ErrClosedPipe) {
+		return "", fmt.Errorf("failed to decompress tarball: %w", cerr)
+	}
+	return output, err
 }
 
 func (w *Watcher) stopAndRemoveContainer() error {
-	w.logger.Info("Stopping and removing existing container: %s", w.config.ContainerName)
+	if w.config().KeepPreviousContainer {
+		err := w.keepPreviousContainer()
+		if err == nil {
+			return nil
+		}
+		w.logger.Warn("%v, removing the container instead", err)
+	}
+
+	w.logger.Info("Stopping and removing existing container: %s", w.containerName())
 
 	// Stop container
-	stopCmd := fmt.Sprintf("docker stop %s", w.config.ContainerName)
-	output, err := utils.ExecuteCommand(stopCmd, 30*time.Second)
+	stopCmd := fmt.Sprintf("docker stop %s", w.containerName())
+	output, err := utils.ExecuteCommand(w.ctx, stopCmd, 30*time.Second)
 	if err != nil {
 		w.logger.Debug("Failed to stop container (may not exist): %v", err)
 	} else {
@@ -189,8 +822,8 @@ func (w *Watcher) stopAndRemoveContainer() error {
 	}
 
 	// Remove container
-	removeCmd := fmt.Sprintf("docker rm %s", w.config.ContainerName)
-	output, err = utils.ExecuteCommand(removeCmd, 30*time.Second)
+	removeCmd := fmt.Sprintf("docker rm %s", w.containerName())
+	output, err = utils.ExecuteCommand(w.ctx, removeCmd, 30*time.Second)
 	if err != nil {
 		w.logger.Debug("Failed to remove container (may not exist): %v", err)
 	} else {
@@ -200,81 +833,474 @@ func (w *Watcher) stopAndRemoveContainer() error {
 	return nil
 }
 
-func (w *Watcher) startContainer() error {
-	w.logger.Info("Starting new container: %s", w.config.ContainerName)
+// retry runs fn with the configured retry policy, failing fast on errors
+// that are not transient
+func (w *Watcher) retry(fn func() error) error {
+	retry := w.config().Retry
+	classifier := utils.NewRetryClassifier(retry.RetryablePatterns, retry.NonRetryablePatterns)
+	return utils.Retry(retry.Attempts, retry.Delay.Duration(), classifier, w.logger, fn)
+}
+
+// startContainer runs the managed container from image, applying the
+// overrides of trigger if set
+func (w *Watcher) startContainer(image string, trigger *Trigger) error {
+	w.logger.Info("Starting new container: %s", w.containerName())
 
-	// Build docker run command
-	runCmd := w.buildDockerRunCommand()
+	// Build docker run command, refusing options docker would reject
+	opts := w.runOptions(image, trigger)
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("invalid docker run options: %w", err)
+	}
+	if err := w.clearNameCollision(opts.Name); err != nil {
+		return err
+	}
+	if err := w.writeSecrets(opts.Name); err != nil {
+		return err
+	}
+	runCmd := w.buildDockerRunCommand(opts)
 
-	output, err := utils.ExecuteCommand(runCmd, 2*time.Minute)
+	output, err := utils.ExecuteCommand(w.ctx, runCmd, 2*time.Minute)
 	if err != nil {
+		w.removeFailedContainer(opts.Name)
 		return err
 	}
 
 	w.logger.Debug("Docker run output: %s", strings.TrimSpace(output))
-	w.logger.Info("Container started successfully: %s", w.config.ContainerName)
+	w.logger.Info("Container started successfully: %s", w.containerName())
 	return nil
 }
 
-func (w *Watcher) buildDockerRunCommand() string {
+// removeFailedContainer removes the container docker run created but could
+// not start, e.g. because its port is taken, so it does not block the next
+// start with "name already in use". Its logs are kept in the log for
+// diagnosis.
+func (w *Watcher) removeFailedContainer(name string) {
+	// Use a context that is not cancelled, so the container is also removed
+	// when the start was interrupted by shutdown
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(w.ctx), time.Minute)
+	defer cancel()
+
+	id, err := containerID(ctx, name)
+	if err != nil {
+		w.logger.Warn("Failed to check for container %s after failed start: %v", name, err)
+		return
+	}
+	if id == "" {
+		return
+	}
+
+	if logs, err := utils.ExecuteCommand(ctx, fmt.Sprintf("docker logs --tail 50 %s 2>&1", name), 10*time.Second); err == nil && strings.TrimSpace(logs) != "" {
+		w.logger.Error("Output of failed container %s:\n%s", name, strings.TrimRight(logs, "\n"))
+	}
+
+	if _, err := utils.ExecuteCommand(ctx, fmt.Sprintf("docker rm -f %s", name), 30*time.Second); err != nil {
+		w.logger.Warn("Failed to remove failed container %s: %v", name, err)
+		return
+	}
+	w.logger.Info("Removed container %s (%s), which failed to start", name, shortID(id))
+}
+
+// runOptions returns the docker run options for image, with the runtime
+// config inherited from the running container and the overrides of trigger
+// if set
+func (w *Watcher) runOptions(image string, trigger *Trigger) config.RunOptions {
+	opts := w.config().RunOptions()
+	opts.Name = w.containerName()
+	opts.Image = image
+	w.applyRuntimeConfig(&opts)
+	if trigger != nil {
+		if len(trigger.ContainerPorts) > 0 {
+			opts.Ports = trigger.ContainerPorts
+		}
+		opts.Env = append(append([]string{}, opts.Env...), trigger.ContainerEnv...)
+	}
+	if binding := w.config().ProxyPortBinding(); binding != "" {
+		opts.Ports = append(append([]string{}, opts.Ports...), binding)
+	}
+	return opts
+}
+
+func (w *Watcher) buildDockerRunCommand(opts config.RunOptions) string {
 	var cmd strings.Builder
 	cmd.WriteString("docker run -d")
 
 	// Add container name
-	cmd.WriteString(fmt.Sprintf(" --name %s", w.config.ContainerName))
+	cmd.WriteString(fmt.Sprintf(" --name %s", opts.Name))
 
 	// Add restart policy
-	if w.config.RestartPolicy != "" {
-		cmd.WriteString(fmt.Sprintf(" --restart %s", w.config.RestartPolicy))
+	if opts.RestartPolicy != "" {
+		cmd.WriteString(fmt.Sprintf(" --restart %s", opts.RestartPolicy))
+	}
+
+	// Add pull policy
+	if opts.PullPolicy != "" {
+		cmd.WriteString(fmt.Sprintf(" --pull %s", opts.PullPolicy))
 	}
 
 	// Add port mappings
-	for _, port := range w.config.ContainerPort {
-		cmd.WriteString(fmt.Sprintf(" -p %s", port))
+	for _, port := range opts.Ports {
+		cmd.WriteString(fmt.Sprintf(" -p %s", utils.ShellQuote(port)))
 	}
 
 	// Add environment variables
-	for _, env := range w.config.ContainerEnv {
-		cmd.WriteString(fmt.Sprintf(" -e %s", env))
+	for _, e := range opts.Env {
+		cmd.WriteString(fmt.Sprintf(" -e %s", utils.ShellQuote(e)))
+	}
+
+	// Add labels; inline labels override those from the label file
+	if opts.LabelFile != "" {
+		cmd.WriteString(fmt.Sprintf(" --label-file %s", utils.ShellQuote(opts.LabelFile)))
+	}
+	for _, label := range opts.Labels {
+		cmd.WriteString(fmt.Sprintf(" --label %s", utils.ShellQuote(label)))
+	}
+
+	// Add GPU and device access
+	if gpus := w.config().GPUs; gpus != "" {
+		// docker parses --gpus as CSV, so device lists need inner quotes
+		if strings.Contains(gpus, ",") {
+			gpus = `"` + gpus + `"`
+		}
+		cmd.WriteString(fmt.Sprintf(" --gpus %s", utils.ShellQuote(gpus)))
+	}
+	for _, device := range w.config().Devices {
+		cmd.WriteString(fmt.Sprintf(" --device %s", utils.ShellQuote(device)))
 	}
 
 	// Add volume mappings
-	for _, volume := range w.config.ContainerVolumes {
-		cmd.WriteString(fmt.Sprintf(" -v %s", volume))
+	for _, volume := range opts.Volumes {
+		cmd.WriteString(fmt.Sprintf(" -v %s", utils.ShellQuote(volume)))
+	}
+
+	// Add secret files
+	for _, mount := range w.secretMounts(opts.Name) {
+		cmd.WriteString(" " + mount)
 	}
 
-	// Extract image name from tarball filename
-	imageName := w.extractImageNameFromTarball()
-	cmd.WriteString(fmt.Sprintf(" %s", imageName))
+	// Add image
+	cmd.WriteString(fmt.Sprintf(" %s", utils.ShellQuote(opts.Image)))
 
 	return cmd.String()
 }
 
-func (w *Watcher) extractImageNameFromTarball() string {
-	// This is a simplified version - in a real implementation, you might want to
-	// parse the tarball or maintain a mapping of tarball names to image names
-	// For now, we'll assume the image name is derived from the container name
-	return w.config.ContainerName
+// resolveImage determines the image to run for a tarball. An image named
+// in the trigger file wins, then a configured image_name_command, then
+// image_name_from_filename_regex, then the default naming.
+func (w *Watcher) resolveImage(tarballPath string, trigger *Trigger, loaded loadedImages) (string, error) {
+	if trigger != nil && trigger.Image != "" {
+		w.logger.Info("Using image from trigger file: %s", trigger.Image)
+		return trigger.Image, nil
+	}
+
+	if w.config().ImageNameCommand != "" {
+		nameCmd := fmt.Sprintf("%s %s", w.config().ImageNameCommand, utils.ShellQuote(tarballPath))
+		output, err := utils.ExecuteCommand(w.ctx, nameCmd, time.Minute)
+		if err != nil {
+			return "", fmt.Errorf("image_name_command failed: %w", err)
+		}
+
+		image := strings.TrimSpace(output)
+		if image == "" || strings.ContainsAny(image, " \t\n") {
+			return "", fmt.Errorf("image_name_command printed an invalid image name: %q", image)
+		}
+
+		w.logger.Info("Resolved image via image_name_command: %s", image)
+		return image, nil
+	}
+
+	if w.config().ImageNameFromFilenameRegex != "" {
+		image, err := imageFromFilename(w.config().ImageNameFromFilenameRegex, filepath.Base(tarballPath))
+		if err != nil {
+			return "", err
+		}
+
+		w.logger.Info("Resolved image from file name: %s", image)
+		return image, nil
+	}
+
+	// A templated container name is rendered from the image, so the
+	// image has to come from elsewhere
+	if w.config().ContainerNameIsTemplate() {
+		return "", fmt.Errorf("container_name is a template; set image_name_command, image_name_from_filename_regex or an image in the trigger file")
+	}
+
+	return w.extractImageNameFromTarball(tarballPath, loaded)
 }
 
-func (w *Watcher) executePostLoadCommands() error {
-	if len(w.config.PostLoadCommands) == 0 {
-		return nil
+// transformImage runs post_load_transform_command with the loaded image and
+// returns the image it prints, which is run instead. Without the command
+// the image is returned unchanged.
+func (w *Watcher) transformImage(image string) (string, error) {
+	if w.config().PostLoadTransformCommand == "" {
+		return image, nil
+	}
+
+	transformCmd := fmt.Sprintf("%s %s", w.config().PostLoadTransformCommand, utils.ShellQuote(image))
+	output, err := utils.ExecuteCommand(w.ctx, transformCmd, 5*time.Minute)
+	if err != nil {
+		return "", fmt.Errorf("post_load_transform_command failed: %w", err)
+	}
+
+	// Only the last line is the image, so the command may log progress
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	transformed := strings.TrimSpace(lines[len(lines)-1])
+	if transformed == "" || strings.ContainsAny(transformed, " \t") {
+		return "", fmt.Errorf("post_load_transform_command printed an invalid image name: %q", transformed)
+	}
+
+	if transformed != image {
+		w.logger.Info("Running image %s instead of %s (post_load_transform_command)", transformed, image)
+	}
+	return transformed, nil
+}
+
+// imageFromFilename extracts an image reference from a tarball file name
+// using the "repo" and optional "tag" groups of pattern. The tag defaults
+// to "latest". Anyone who can upload names the file, so the result must be
+// a valid image reference.
+func imageFromFilename(pattern, name string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid image_name_from_filename_regex: %w", err)
+	}
+
+	match := re.FindStringSubmatch(name)
+	if match == nil {
+		return "", fmt.Errorf("tarball name %s does not match image_name_from_filename_regex %s", name, pattern)
+	}
+
+	repo := match[re.SubexpIndex("repo")]
+	if repo == "" {
+		return "", fmt.Errorf("image_name_from_filename_regex matched an empty repo in %s", name)
+	}
+
+	tag := "latest"
+	if i := re.SubexpIndex("tag"); i >= 0 && match[i] != "" {
+		tag = match[i]
+	}
+	image := repo + ":" + tag
+	if err := config.ValidateImageReference(image); err != nil {
+		return "", fmt.Errorf("image_name_from_filename_regex matched %s: %w", name, err)
+	}
+	return image, nil
+}
+
+func (w *Watcher) extractImageNameFromTarball(tarballPath string, loaded loadedImages) (string, error) {
+	// The first repo tag in the tarball's manifest names the loaded image
+	tags, err := imagetar.ReadRepoTags(tarballPath)
+	if err != nil {
+		w.logger.Warn("Failed to read image name from tarball, using container name: %v", err)
+		return w.config().ContainerName, nil
+	}
+	if len(tags) == 0 {
+		return w.untaggedImage(loaded)
+	}
+	if len(tags) > 1 {
+		w.logger.Debug("Tarball has %d repo tags, running %s", len(tags), tags[0])
+	}
+	return tags[0], nil
+}
+
+// executePostLoadCommands runs the post-load commands once the new
+// container is up. Commands marked in_container run inside it via docker
+// exec. Like pre-load commands, completed run-once commands are skipped and
+// the executed ones are returned.
+func (w *Watcher) executePostLoadCommands(env []string) ([]string, error) {
+	if len(w.config().PostLoadCommands) == 0 {
+		return nil, nil
+	}
+
+	var commands []utils.ShellCommand
+	var onceCommands []string
+	checkedRunning := false
+	for _, cmd := range w.config().PostLoadCommands {
+		if cmd.Once {
+			if w.state.OnceDone(cmd.String()) {
+				w.logger.Debug("Skipping run-once command: %s", cmd)
+				continue
+			}
+			onceCommands = append(onceCommands, cmd.String())
+		}
+
+		if cmd.InContainer {
+			if !checkedRunning {
+				if err := w.ensureContainerRunning(); err != nil {
+					return nil, err
+				}
+				checkedRunning = true
+			}
+			commands = append(commands, utils.ShellCommand{
+				Line: fmt.Sprintf("docker exec%s %s sh -c %s",
+					execEnvFlags(env), w.containerName(), utils.ShellQuote(cmd.Cmd)),
+				SuccessCodes: cmd.SuccessCodes,
+			})
+			continue
+		}
+		commands = append(commands, cmd.ShellCommand())
 	}
 
 	w.logger.Info("Executing post-load commands...")
-	return utils.ExecuteCommands(w.config.PostLoadCommands, 5*time.Minute, w.logger)
+	if err := utils.ExecuteCommandsParallel(w.ctx, commands, env, w.config().PostLoadParallelism, 5*time.Minute, w.logger); err != nil {
+		return nil, err
+	}
+	return onceCommands, nil
+}
+
+// ensureContainerRunning fails if the managed container is not running
+func (w *Watcher) ensureContainerRunning() error {
+	inspectCmd := fmt.Sprintf("docker inspect -f '{{.State.Running}}' %s", w.containerName())
+	output, err := utils.ExecuteCommand(w.ctx, inspectCmd, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("container %s does not exist, cannot run in_container commands: %w", w.containerName(), err)
+	}
+	if strings.TrimSpace(output) != "true" {
+		return fmt.Errorf("container %s is not running, cannot run in_container commands", w.containerName())
+	}
+	return nil
 }
 
 func (w *Watcher) cleanupTarball(tarballPath string) error {
+	// Keep deployed tarballs for replay if an archive is configured
+	if w.config().ArchiveDirectory != "" {
+		if err := utils.EnsureDir(w.config().ArchiveDirectory); err != nil {
+			return fmt.Errorf("failed to create archive directory: %w", err)
+		}
+
+		target := filepath.Join(w.config().ArchiveDirectory, filepath.Base(tarballPath))
+		w.logger.Info("Archiving tarball: %s", target)
+		return os.Rename(tarballPath, target)
+	}
+
 	w.logger.Info("Cleaning up tarball: %s", tarballPath)
 	return os.Remove(tarballPath)
 }
 
+// ArchivedTarball is a tarball kept in the archive directory
+type ArchivedTarball struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ListArchive returns the archived tarballs, newest first
+func (w *Watcher) ListArchive() ([]ArchivedTarball, error) {
+	if w.config().ArchiveDirectory == "" {
+		return nil, fmt.Errorf("archive_directory is not configured")
+	}
+
+	entries, err := os.ReadDir(w.config().ArchiveDirectory)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	var tarballs []ArchivedTarball
+	for _, entry := range entries {
+		if entry.IsDir() || !isTarball(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		tarballs = append(tarballs, ArchivedTarball{
+			Name:    entry.Name(),
+			Path:    filepath.Join(w.config().ArchiveDirectory, entry.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(tarballs, func(i, j int) bool {
+		return tarballs[i].ModTime.After(tarballs[j].ModTime)
+	})
+	return tarballs, nil
+}
+
+// quarantineTarball moves the tarball of a failed deploy into the
+// quarantine directory instead of deleting it
+func (w *Watcher) quarantineTarball(tarballPath string) error {
+	if !utils.FileExists(tarballPath) {
+		return nil
+	}
+
+	quarantineDir := w.config().QuarantinePath()
+	if err := utils.EnsureDir(quarantineDir); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	target := filepath.Join(quarantineDir, filepath.Base(tarballPath))
+	w.logger.Warn("Moving failed tarball to quarantine: %s", target)
+	if err := os.Rename(tarballPath, target); err != nil {
+		return err
+	}
+
+	// Keep repeatedly failing uploads from filling the disk
+	w.pruneQuarantine()
+	return nil
+}
+
+// Container states reported by InspectContainer
+const (
+	ContainerNotFound = "not_found" // Never deployed, or removed
+	ContainerRunning  = "running"
+	ContainerStopped  = "stopped" // Exists but is not running
+)
+
+// ContainerInfo describes the managed container
+type ContainerInfo struct {
+	Name   string
+	State  string // One of the Container* states
+	Status string // Docker's description, e.g. "Up 2 hours"
+
+	Ports []PortMapping // Published ports, while running
+}
+
+// InspectContainer reports whether the managed container exists and is
+// running. Errors are only returned when docker itself fails, not when the
+// container does not exist.
+func (w *Watcher) InspectContainer() (ContainerInfo, error) {
+	info := ContainerInfo{Name: w.ContainerName(), State: ContainerNotFound}
+	if info.Name == "" {
+		return info, nil
+	}
+
+	inspectCmd := fmt.Sprintf("docker inspect --type container -f '{{.State.Running}}' %s", info.Name)
+	output, err := utils.ExecuteCommand(w.ctx, inspectCmd, 10*time.Second)
+	if err != nil {
+		var cmdErr *utils.CommandError
+		if errors.As(err, &cmdErr) && strings.Contains(strings.ToLower(cmdErr.Output), "no such") {
+			return info, nil
+		}
+		return info, err
+	}
+
+	info.State = ContainerStopped
+	if strings.TrimSpace(output) == "true" {
+		info.State = ContainerRunning
+	}
+	if info.Status, err = w.GetContainerStatus(); err != nil {
+		return info, err
+	}
+	if info.State == ContainerRunning {
+		if info.Ports, err = w.PublishedPorts(); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
 // GetContainerStatus returns the status of the managed container
 func (w *Watcher) GetContainerStatus() (string, error) {
-	statusCmd := fmt.Sprintf("docker ps -a --filter name=%s --format '{{.Status}}'", w.config.ContainerName)
-	output, err := utils.ExecuteCommand(statusCmd, 10*time.Second)
+	if w.containerName() == "" {
+		return "", nil
+	}
+	// Anchor the name filter, which otherwise matches substrings
+	statusCmd := fmt.Sprintf("docker ps -a --filter name=%s --format '{{.Status}}'", utils.ShellQuote("^/?"+w.containerName()+"$"))
+	output, err := utils.ExecuteCommand(w.ctx, statusCmd, 10*time.Second)
 	if err != nil {
 		return "", err
 	}
@@ -284,11 +1310,54 @@ func (w *Watcher) GetContainerStatus() (string, error) {
 
 // GetContainerLogs returns the logs of the managed container
 func (w *Watcher) GetContainerLogs(lines int) (string, error) {
-	logsCmd := fmt.Sprintf("docker logs --tail %d %s", lines, w.config.ContainerName)
-	output, err := utils.ExecuteCommand(logsCmd, 30*time.Second)
+	if w.containerName() == "" {
+		return "", fmt.Errorf("no container has been deployed yet")
+	}
+	logsCmd := fmt.Sprintf("docker logs --tail %d %s", lines, w.containerName())
+	output, err := utils.ExecuteCommand(w.ctx, logsCmd, 30*time.Second)
 	if err != nil {
 		return "", err
 	}
 
 	return output, nil
 }
+
+// showLogsAfterDeploy logs the last show_logs_after_deploy lines of the
+// new container's output, so a successful deploy also shows that the app
+// booted as expected
+func (w *Watcher) showLogsAfterDeploy() {
+	lines := w.config().ShowLogsAfterDeploy
+	if lines <= 0 {
+		return
+	}
+	output, err := w.GetContainerLogs(lines)
+	if err != nil {
+		w.logger.Warn("Failed to get container logs: %v", err)
+		return
+	}
+	if output = strings.TrimRight(output, "\n"); output == "" {
+		w.logger.Info("Container %s has not logged anything yet", w.containerName())
+		return
+	}
+	w.logger.Info("Last %d lines of %s:\n%s", lines, w.containerName(), output)
+}
+
+// triggerOps converts the configured trigger_on names into an fsnotify
+// operation mask. Files moved into place show up as a create event under
+// their new name, so "rename" also enables create events.
+func triggerOps(names []string) fsnotify.Op {
+	var ops fsnotify.Op
+	for _, name := range names {
+		switch name {
+		case "create":
+			ops |= fsnotify.Create
+		case "write":
+			ops |= fsnotify.Write
+		case "rename":
+			ops |= fsnotify.Rename | fsnotify.Create
+		case "chmod":
+			ops |= fsnotify.Chmod
+		}
+	}
+	return ops
+}